@@ -0,0 +1,193 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/alabsi91/win-tools/commands/utils"
+)
+
+const (
+	OnErrorStop     = "stop"
+	OnErrorContinue = "continue"
+)
+
+// DefaultApplyOrder is the order in which the config sections are applied when none is configured
+var DefaultApplyOrder = []string{"backup", "environmentVariables", "packages", "scripts"}
+
+// applyStep describes how a single config section is applied
+type applyStep struct {
+	isEmpty func(utils.ConfigYamlType) bool
+	run     func(context.Context, utils.ConfigYamlType) sectionResult
+
+	// skipReason, when set, returns why the section is skipped with a warning, or an empty string to apply it
+	skipReason func(utils.ConfigYamlType) string
+}
+
+// applySteps maps the section names accepted in "apply.order" to their steps
+var applySteps = map[string]applyStep{
+	"backup": {
+		isEmpty:    func(c utils.ConfigYamlType) bool { return len(c.Backup.Paths) == 0 },
+		run:        backupData,
+		skipReason: backupSkipReason,
+	},
+	"restore": {
+		isEmpty: func(c utils.ConfigYamlType) bool { return len(c.Backup.Paths) == 0 },
+		run:     restoreData,
+	},
+	"environmentVariables": {
+		isEmpty: func(c utils.ConfigYamlType) bool { return len(c.EnvironmentVariables) == 0 },
+		run:     setEnvs,
+	},
+	"packages": {
+		isEmpty: func(c utils.ConfigYamlType) bool { return len(c.Packages) == 0 },
+		run: func(ctx context.Context, c utils.ConfigYamlType) sectionResult {
+			if err := requireAdmin(ctx, "you need admin privileges to install packages"); err != nil {
+				result := sectionResult{Name: "packages", Skipped: len(c.Packages)}
+				result.abort(err)
+				return result
+			}
+			return installPackages(ctx, c)
+		},
+	},
+	"scripts": {
+		isEmpty: func(c utils.ConfigYamlType) bool { return len(c.Scripts) == 0 },
+		run:     runScripts,
+	},
+}
+
+// ApplyArgs holds the flags of the apply command
+type ApplyArgs struct {
+	ConfigPath *string `arg:"--config" placeholder:"[PATH]" help:"YAML config file path"`
+	Order      *string `arg:"--order" placeholder:"[SECTIONS]" help:"Comma separated list of sections to apply in order, e.g. \"packages,scripts\""`
+	OnError    *string `arg:"--on-error" placeholder:"[stop|continue]" help:"Whether to stop or continue when a section fails"`
+}
+
+// applyCommand implements the "apply" command
+type applyCommand struct {
+	args ApplyArgs
+}
+
+func (*applyCommand) Name() string  { return "apply" }
+func (*applyCommand) Title() string { return "Apply config" }
+func (*applyCommand) Help() string {
+	return "Apply all sections of a YAML configuration file (backup, environment variables, packages and scripts) in order and print a combined summary."
+}
+func (c *applyCommand) Flags() any { return &c.args }
+func (c *applyCommand) Run(ctx context.Context) error {
+	return Apply(ctx, c.args.ConfigPath, c.args.Order, c.args.OnError)
+}
+
+// Apply runs every section of the config file in order and prints a combined summary
+//   - The order is taken from the "order" argument, then from "apply.order" in the config file, then from DefaultApplyOrder
+//   - The error policy is taken from the "onError" argument, then from "apply.onError" in the config file, defaults to "stop"
+//   - Sections without any entries are skipped
+//   - The backup section is skipped with a warning when its target is not set or does not exist yet, e.g. on a new machine,
+//     "win-tools backup" creates the target
+//   - When ctx is cancelled, the running section stops and the next ones do not start
+//   - Returns the errors of all the sections that did not complete successfully
+func Apply(ctx context.Context, configFilePath *string, order *string, onError *string) error {
+	yamlData, err := loadConfig(configFilePath)
+	if err != nil {
+		return err
+	}
+
+	// resolve the order of the sections
+	sections := append([]string{}, DefaultApplyOrder...)
+	if len(yamlData.Apply.Order) > 0 {
+		sections = append([]string{}, yamlData.Apply.Order...)
+	}
+	if order != nil {
+		sections = strings.Split(*order, ",")
+	}
+
+	for i, name := range sections {
+		sections[i] = strings.TrimSpace(name)
+		if _, exists := applySteps[sections[i]]; !exists {
+			return utils.NewError(utils.ErrConfig, `unknown section "%s" in the apply order`, sections[i])
+		}
+	}
+
+	// resolve the error policy
+	policy := OnErrorStop
+	if yamlData.Apply.OnError != "" {
+		policy = yamlData.Apply.OnError
+	}
+	if onError != nil {
+		policy = *onError
+	}
+
+	if policy != OnErrorStop && policy != OnErrorContinue {
+		return utils.NewError(utils.ErrConfig, `invalid error policy "%s", expected "%s" or "%s"`, policy, OnErrorStop, OnErrorContinue)
+	}
+
+	Log.Info("\n"+fmt.Sprintf(`Applying sections: %s`, strings.Join(sections, ", ")), "\n")
+
+	// run the sections
+	var results []sectionResult
+	var errs []error
+	stopped := false
+	for _, name := range sections {
+		step := applySteps[name]
+
+		if ctx.Err() != nil {
+			results = append(results, sectionResult{Name: name, Reason: "not started, cancelled by the user"})
+			continue
+		}
+
+		if stopped {
+			results = append(results, sectionResult{Name: name, Reason: "stopped after a previous failure"})
+			continue
+		}
+
+		if step.isEmpty(yamlData) {
+			results = append(results, sectionResult{Name: name, Reason: "nothing to apply"})
+			continue
+		}
+
+		if step.skipReason != nil {
+			if reason := step.skipReason(yamlData); reason != "" {
+				Log.Warning("\n"+fmt.Sprintf(`Skipping section "%s": %s`, name, reason), "\n")
+				results = append(results, sectionResult{Name: name, Reason: reason})
+				continue
+			}
+		}
+
+		Log.Info("\n"+fmt.Sprintf(`Applying section: "%s"`, name), "\n")
+
+		result := step.run(ctx, yamlData)
+		results = append(results, result)
+
+		if err := result.err(); err != nil {
+			errs = append(errs, err)
+		}
+
+		if !result.ok() && policy == OnErrorStop {
+			stopped = true
+		}
+	}
+
+	printSummary(results)
+
+	return errors.Join(errs...)
+}
+
+// backupSkipReason skips the backup section of apply when the backup target is not set or does not exist
+func backupSkipReason(c utils.ConfigYamlType) string {
+	if strings.TrimSpace(c.Backup.Target) == "" {
+		return `"backup.target" is not set`
+	}
+
+	target, err := utils.PathExpander.Expand(c.Backup.Target)
+	if err != nil {
+		return err.Error()
+	}
+
+	if !utils.IsPathExists(target) {
+		return fmt.Sprintf(`the backup target "%s" does not exist, run "win-tools backup" to create it`, target)
+	}
+
+	return ""
+}
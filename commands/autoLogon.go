@@ -1,17 +1,52 @@
 package commands
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"path/filepath"
 
+	"github.com/alabsi91/win-tools/commands/utils"
+	"github.com/alabsi91/win-tools/commands/utils/shellquote"
 	"github.com/charmbracelet/huh"
 )
 
+// AutoLogonArgs holds the flags of the auto-logon command
+type AutoLogonArgs struct {
+	Username     *string `arg:"--username" placeholder:"" help:"The username of the user to automatically logon as"`
+	Domain       *string `arg:"--domain" placeholder:"" help:"The domain of the user to automatically logon as"`
+	AutoLogon    *int    `arg:"--logon-count" placeholder:"" help:"The number of logons that auto logon will be enabled"`
+	RemovePrompt *bool   `arg:"--remove-prompt" help:"Removes the system banner to ensure interventionless logon"`
+	BackupFile   *string `arg:"--backup-file" placeholder:"" help:"If specified the existing settings such as the system banner text will be backed up to the specified file"`
+}
+
+// autoLogonCommand implements the "auto-logon" command
+type autoLogonCommand struct {
+	args AutoLogonArgs
+}
+
+func (*autoLogonCommand) Name() string  { return "auto-logon" }
+func (*autoLogonCommand) Title() string { return "Enable auto logon" }
+func (*autoLogonCommand) Help() string {
+	return "Enables auto logon when the computer starts."
+}
+func (c *autoLogonCommand) Flags() any { return &c.args }
+func (c *autoLogonCommand) Run(ctx context.Context) error {
+	return AutoLogon(ctx, c.args.Username, c.args.Domain, c.args.AutoLogon, c.args.RemovePrompt, c.args.BackupFile)
+}
+
 // askForUsername prompts the user to enter their username
 //   - Validates if the username is not empty
+//   - Uses the "username" answer from the answers file when provided
 //   - Returns an error if the user cancels the prompt
 func askForUsername() (string, error) {
+	if answer, found, err := utils.AnswerFor("username", utils.Answers.Username); found || err != nil {
+		if err == nil && answer == "" {
+			err = utils.NewError(utils.ErrConfig, `the "username" answer must not be empty`)
+		}
+		return answer, err
+	}
+
 	var results string
 
 	validate := func(str string) error {
@@ -33,54 +68,52 @@ func askForUsername() (string, error) {
 		),
 	).Run()
 
-	return results, err
+	return results, utils.PromptError(err)
 }
 
-func AutoLogon(username *string, domain *string, autoLogonCount *int, removeLegalPrompt *bool, backupFile *string) {
+func AutoLogon(ctx context.Context, username *string, domain *string, autoLogonCount *int, removeLegalPrompt *bool, backupFile *string) error {
 	// has admin privileges
-	isAdmin := Powershell.IsAdmin()
-
-	if !isAdmin {
-		Log.Error("\nyou need admin privileges to run this command\n")
-		Log.Info("Please run this command from an elevated powershell session\n")
-		return
+	if err := requireAdmin(ctx, "you need admin privileges to run this command"); err != nil {
+		return err
 	}
 
 	// check if username is provided, if not ask for it
 	if username == nil {
 		answer, err := askForUsername()
 		if err != nil {
-			Log.Error("failed to get user input\n")
-			return
+			return fmt.Errorf("failed to get user input: %w", err)
 		}
 		username = &answer
 	}
 
-	scriptArgs := fmt.Sprintf(`-Username "%s"`, *username)
+	scriptArgs := "-Username " + shellquote.PowerShell(*username)
 
 	if domain != nil {
-		scriptArgs = fmt.Sprintf(`%s -Domain "%s"`, scriptArgs, *domain)
+		scriptArgs += " -Domain " + shellquote.PowerShell(*domain)
 	}
 
 	if autoLogonCount != nil {
-		scriptArgs = fmt.Sprintf(`%s -AutoLogonCount "%d"`, scriptArgs, *autoLogonCount)
+		scriptArgs += fmt.Sprintf(" -AutoLogonCount %d", *autoLogonCount)
 	}
 
 	if removeLegalPrompt != nil {
-		scriptArgs = fmt.Sprintf(`%s -RemoveLegalPrompt`, scriptArgs)
+		scriptArgs += " -RemoveLegalPrompt"
 	}
 
 	scriptPath := filepath.Join(AssetsPath, "autologon.ps1")
 
 	err := Powershell.RunPathThroughCmd(
+		ctx,
 		"Set-ExecutionPolicy -ExecutionPolicy Bypass -Scope Process -Force;",
-		fmt.Sprintf(`&"%s"`, scriptPath),
+		"& "+shellquote.PowerShell(scriptPath),
 		scriptArgs,
 	)
 
 	if err != nil {
-		Log.Fatal("\n"+err.Error(), "\n")
+		return fmt.Errorf("failed to enable auto logon: %w", err)
 	}
 
 	Log.Success("\nDone!\n")
+
+	return nil
 }
@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -12,70 +14,302 @@ var Powershell = utils.Powershell
 var Log = utils.Log
 var AssetsPath = utils.AssetsPath
 var Chocolatey = utils.Chocolatey
+var Options = utils.Options
 
-func BackupData(configFilePath *string) {
+// BackupArgs holds the flags and the subcommands of the backup command
+type BackupArgs struct {
+	ConfigPath *string        `arg:"--config" placeholder:"[PATH]" help:"YAML config file path"`
+	ListFiles  bool           `arg:"--list" help:"Print the files each backup path would include, without backing them up"`
+	List       *ConfigPathArg `arg:"subcommand:list" help:"List the snapshots of the backup target and the retention rules keeping them"`
+	Prune      *ConfigPathArg `arg:"subcommand:prune" help:"Delete the snapshots of the backup target not kept by the retention rules"`
+}
 
-	// no config file path provided, ask for it
-	if configFilePath == nil {
+// backupCommand implements the "backup" command
+type backupCommand struct {
+	args BackupArgs
+}
 
-		answer, err := utils.AskForConfigFilePath()
-		if err != nil {
-			Log.Error("failed to get user input\n")
-			return
-		}
+func (*backupCommand) Name() string  { return "backup" }
+func (*backupCommand) Title() string { return "Backup" }
+func (*backupCommand) Help() string {
+	return "Create a backup snapshot of specified paths as defined in a YAML configuration file, list the snapshots or prune the old ones."
+}
+func (c *backupCommand) Flags() any { return &c.args }
+func (c *backupCommand) Run(ctx context.Context) error {
+	switch {
+	case c.args.List != nil:
+		return ListSnapshots(configPathOf(c.args.List, c.args.ConfigPath))
+	case c.args.Prune != nil:
+		return PruneSnapshots(configPathOf(c.args.Prune, c.args.ConfigPath))
+	case c.args.ListFiles:
+		return ListBackupFiles(ctx, c.args.ConfigPath)
+	}
+
+	return BackupData(ctx, c.args.ConfigPath)
+}
+
+func BackupData(ctx context.Context, configFilePath *string) error {
+	yamlData, err := loadConfig(configFilePath)
+	if err != nil {
+		return err
+	}
+
+	return sectionError(ctx, backupData(ctx, yamlData))
+}
 
-		configFilePath = &answer
+// ListBackupFiles prints the files each backup path of the config file would include, see utils.BackupFilter
+func ListBackupFiles(ctx context.Context, configFilePath *string) error {
+	yamlData, err := loadConfig(configFilePath)
+	if err != nil {
+		return err
 	}
 
-	// config file path provided does not exist, ask for a new one
-	if !utils.IsPathExists(*configFilePath) {
-		Log.Error("\nfile not found. Please enter a valid path\n")
+	return sectionError(ctx, listBackupFiles(ctx, yamlData))
+}
+
+// listBackupFiles prints the files selected by the include and exclude patterns of each backup path and their total size
+func listBackupFiles(ctx context.Context, yamlData utils.ConfigYamlType) sectionResult {
+	result := sectionResult{Name: "backup"}
 
-		answer, err := utils.AskForConfigFilePath()
+	// paths is empty, exit
+	if len(yamlData.Backup.Paths) == 0 {
+		result.abort(utils.NewError(utils.ErrConfig, "the YAML file does not contain any backup paths"))
+		return result
+	}
+
+	var totalFiles int
+	var totalSize int64
+
+	for i, entry := range yamlData.Backup.Paths {
+		if result.cancelled(ctx, len(yamlData.Backup.Paths)-i) {
+			return result
+		}
+
+		if !result.checkWhen(ctx, fmt.Sprintf(`"%s"`, entry.Path), entry.When, yamlData) {
+			continue
+		}
+
+		files, size, err := printIncludedFiles(entry, yamlData.Backup)
 		if err != nil {
-			Log.Error("failed to get user input\n")
-			return
+			Log.Error("\n"+err.Error(), "\n")
+			result.Failed++
+			continue
 		}
 
-		configFilePath = &answer
+		totalFiles += files
+		totalSize += size
+		result.Succeeded++
+	}
+
+	Log.Info("\nTotal: " + utils.CountFiles(totalFiles, totalSize))
+
+	return result
+}
+
+// printIncludedFiles prints the files of a backup path selected by its filter
+//
+// Returns: the number of files and their total size
+func printIncludedFiles(entry utils.BackupPath, backup utils.BackupConfig) (int, int64, error) {
+	path, err := utils.PathExpander.Expand(entry.Path)
+	if err != nil {
+		return 0, 0, err
 	}
 
-	yamlData := utils.ReadConfigFile(*configFilePath)
+	filter, err := backup.Filter(entry)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	files, size, err := utils.ListIncludedFiles(path, filter)
+	if err != nil {
+		return 0, 0, fmt.Errorf(`failed to list the files of "%s": %w`, path, err)
+	}
+
+	Log.Info(fmt.Sprintf("\n\"%s\": %s", path, utils.CountFiles(len(files), size)))
+	for _, file := range files {
+		fmt.Println("  " + file)
+	}
+
+	return len(files), size, nil
+}
+
+// backupData copies the backup paths of the given config to a new snapshot of the backup target, see utils.NewSnapshot
+//   - Only the files which changed since the last backup are copied, see utils.BackupManifest
+//   - The files are selected by the include and exclude patterns of each path and the .wintoolsignore file, see utils.BackupFilter
+//   - The files deleted from a backup path are deleted from the snapshot
+//   - The snapshots not kept by the retention rules are deleted once all the paths are backed up
+//   - A flat target is backed up into directly, replacing the previous backup
+//   - With the zip and tar.gz formats, all the paths are streamed into a single archive instead, see utils.BackupArchive
+func backupData(ctx context.Context, yamlData utils.ConfigYamlType) sectionResult {
+	result := sectionResult{Name: "backup"}
 
 	// paths is empty, exit
 	if len(yamlData.Backup.Paths) == 0 {
-		Log.Error("\nthe YAML file does not contain any backup paths\n")
-		return
+		result.abort(utils.NewError(utils.ErrConfig, "the YAML file does not contain any backup paths"))
+		return result
+	}
+
+	target, err := utils.PathExpander.Expand(yamlData.Backup.Target)
+	if err != nil {
+		result.abort(err)
+		return result
 	}
+	yamlData.Backup.Target = target
 
 	// create the target path
 	isTargetPathExists := utils.IsPathExists(yamlData.Backup.Target)
 	if !isTargetPathExists {
 		Log.Info("\nthe target path does not exist. It will be created")
 		// try to create the target path
-		err := os.MkdirAll(yamlData.Backup.Target, os.ModePerm)
+		if Options.DryRun {
+			Log.DryRun(fmt.Sprintf(`create the target directory "%s"`, yamlData.Backup.Target))
+		} else if err := os.MkdirAll(yamlData.Backup.Target, os.ModePerm); err != nil {
+			result.abort(fmt.Errorf(`failed to create the target path "%s": %w`, yamlData.Backup.Target, err))
+			return result
+		}
+	}
+
+	dir := yamlData.Backup.Target
+	var manifest *utils.BackupManifest
+	var archive *utils.BackupArchive
+
+	switch {
+	case yamlData.Backup.Format != "" && yamlData.Backup.Format != utils.BackupFormatFolder:
+		dir = utils.NewArchivePath(yamlData.Backup, yamlData.Backup.Target)
+		archive, err = utils.CreateBackupArchive(dir, yamlData.Backup.Format)
 		if err != nil {
-			Log.Error("\nthe YAML file does not contain any backup paths\n")
-			return
+			result.abort(err)
+			return result
+		}
+
+	case yamlData.Backup.Flat:
+		Log.Warning("\nFiles and folders with the same name will be overwritten.\n")
+
+		manifest, err = utils.LoadBackupManifest(dir)
+		if err != nil {
+			Log.Warning(err.Error() + ", every file will be copied\n")
+		}
+
+	default:
+		dir, manifest, err = utils.NewSnapshot(yamlData.Backup.Target, expandBackupPaths(yamlData.Backup.Paths))
+		if err != nil {
+			result.abort(err)
+			return result
 		}
 	}
 
-	Log.Warning("\nFiles and folders with the same name will be overwritten.\n")
-	Log.Info(fmt.Sprintf(`The target path is: "%s"`, yamlData.Backup.Target), "\n")
+	// a cancelled backup does not replace the previous archive with an incomplete one
+	abort := func() {
+		if archive != nil {
+			archive.Abort()
+		}
+	}
+
+	if manifest != nil {
+		manifest.SetBackupPaths(expandBackupPaths(yamlData.Backup.Paths))
+	}
+	if archive != nil {
+		archive.SetBackupPaths(expandBackupPaths(yamlData.Backup.Paths))
+	}
+
+	Log.Info(fmt.Sprintf(`The target path is: "%s"`, dir), "\n")
+
+	var total utils.BackupStats
 
 	// loop over paths and copy the files and folders to the target path
-	utils.PreparePathsString(yamlData.Backup.Paths)
-	for _, path := range yamlData.Backup.Paths {
+	for i, entry := range yamlData.Backup.Paths {
+		if result.cancelled(ctx, len(yamlData.Backup.Paths)-i) {
+			abort()
+			Log.Info("\n" + total.String())
+			return result
+		}
+
+		if !result.checkWhen(ctx, fmt.Sprintf(`"%s"`, entry.Path), entry.When, yamlData) {
+			continue
+		}
+
+		path, err := utils.PathExpander.Expand(entry.Path)
+		if err != nil {
+			Log.Error("\n"+err.Error(), "\n")
+			result.Failed++
+			continue
+		}
+
+		filter, err := yamlData.Backup.Filter(entry)
+		if err != nil {
+			Log.Error("\n"+err.Error(), "\n")
+			result.Failed++
+			continue
+		}
 
 		Log.Info(fmt.Sprintf(`Copying "%s"`, path))
 
-		err := utils.Copy(path, yamlData.Backup.Target)
+		var stats utils.BackupStats
+		if archive != nil {
+			archive.SetEntry(path, entry.Entry())
+			stats, err = archive.Add(ctx, path, filter)
+		} else {
+			manifest.SetEntry(path, entry.Entry())
+			stats, err = manifest.Sync(ctx, path, dir, filter)
+
+			// the manifest is saved after every path, an interrupted backup keeps what was copied
+			if saveErr := manifest.Save(dir); saveErr != nil {
+				Log.Warning(saveErr.Error())
+			}
+		}
+		total.Add(stats)
+
+		if errors.Is(err, utils.ErrCancelled) && result.cancelled(ctx, len(yamlData.Backup.Paths)-i) {
+			abort()
+			Log.Info("\n" + total.String())
+			return result
+		}
 
 		if err != nil {
 			formattedErr := strings.Join(strings.Split(err.Error(), ": "), "\n")
 			Log.Error("\nfailed to copy the path: ", path, "\n"+formattedErr, "\n")
+			result.Failed++
+			continue
+		}
+
+		Log.Info(stats.String())
+		result.Succeeded++
+	}
+
+	Log.Info("\n" + total.String())
+
+	if archive != nil {
+		if err := archive.Close(); err != nil {
+			result.abort(err)
+			return result
+		}
+	}
+
+	if result.Failed > 0 {
+		Log.Warning("\nBackup completed with errors\n")
+		return result
+	}
+
+	// a failed backup does not prune, the previous snapshots may be the last good ones
+	if !yamlData.Backup.Flat && yamlData.Backup.Retention.IsSet() {
+		if err := pruneSnapshots(yamlData.Backup.Target, yamlData.Backup.Retention); err != nil {
+			Log.Warning("\n" + err.Error())
 		}
 	}
 
 	Log.Success("\nBackup completed\n")
+
+	return result
+}
+
+// expandBackupPaths returns the expanded backup paths, the ones that cannot be expanded are reported when they are backed up
+func expandBackupPaths(entries []utils.BackupPath) []string {
+	var paths []string
+	for _, entry := range entries {
+		if path, err := utils.PathExpander.Expand(entry.Path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
 }
@@ -0,0 +1,115 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/alabsi91/win-tools/commands/utils"
+)
+
+// ListSnapshots prints the snapshots of the backup target, their size and the retention rules keeping them
+func ListSnapshots(configFilePath *string) error {
+	target, yamlData, err := loadSnapshotsTarget(configFilePath)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := utils.ListSnapshots(target)
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) == 0 {
+		Log.Info(fmt.Sprintf(`No snapshots in "%s"`, target))
+		return nil
+	}
+
+	Log.Info(fmt.Sprintf(`Snapshots in "%s"`, target), "\n")
+
+	kept := yamlData.Backup.Retention.KeptSnapshots(snapshots)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "SNAPSHOT\tHOST\tFILES\tSIZE\tKEPT BY")
+
+	for _, snapshot := range snapshots {
+		files, size := "-", "-"
+		if manifest, err := utils.LoadSnapshotManifest(snapshot); err == nil {
+			var total int64
+			for _, file := range manifest.Files {
+				total += file.Size
+			}
+			files, size = fmt.Sprint(len(manifest.Files)), utils.FormatBytes(total)
+		}
+
+		keptBy := "pruned on the next backup"
+		if rules, found := kept[snapshot.Name]; found {
+			keptBy = strings.Join(rules, ", ")
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", snapshot.Name, snapshot.Hostname, files, size, keptBy)
+	}
+
+	return writer.Flush()
+}
+
+// PruneSnapshots deletes the snapshots of the backup target which are not kept by the retention rules
+func PruneSnapshots(configFilePath *string) error {
+	target, yamlData, err := loadSnapshotsTarget(configFilePath)
+	if err != nil {
+		return err
+	}
+
+	if !yamlData.Backup.Retention.IsSet() {
+		Log.Warning("\nNo retention rules in \"backup.retention\", all the snapshots are kept\n")
+		return nil
+	}
+
+	if err := pruneSnapshots(target, yamlData.Backup.Retention); err != nil {
+		return err
+	}
+
+	Log.Success("\nDone!\n")
+
+	return nil
+}
+
+// loadSnapshotsTarget reads the config file and expands the backup target holding the snapshots
+//
+// Returns: an error of kind ErrConfig if the backup target is flat
+func loadSnapshotsTarget(configFilePath *string) (string, utils.ConfigYamlType, error) {
+	yamlData, err := loadConfig(configFilePath)
+	if err != nil {
+		return "", yamlData, err
+	}
+
+	if yamlData.Backup.Flat {
+		return "", yamlData, utils.NewError(utils.ErrConfig, `the backup target is flat ("backup.flat"), it has no snapshots`)
+	}
+
+	target, err := utils.PathExpander.Expand(yamlData.Backup.Target)
+	if err != nil {
+		return "", yamlData, err
+	}
+
+	return target, yamlData, nil
+}
+
+// pruneSnapshots deletes the snapshots not kept by the retention rules and prints them
+func pruneSnapshots(target string, retention utils.BackupRetention) error {
+	Log.Info("\nPruning the snapshots not kept by the retention rules")
+
+	pruned, err := utils.PruneSnapshots(target, retention)
+	for _, snapshot := range pruned {
+		if !Options.DryRun {
+			Log.Info(fmt.Sprintf(`Deleted the snapshot "%s"`, snapshot.Name))
+		}
+	}
+
+	if len(pruned) == 0 && err == nil {
+		Log.Info("No snapshots to prune")
+	}
+
+	return err
+}
@@ -1,81 +1,117 @@
 package commands
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/alabsi91/win-tools/commands/utils"
 )
 
-func InstallPackages(configFilePath *string) {
-	// has admin privileges
-	isAdmin := Powershell.IsAdmin()
-
-	if !isAdmin {
-		Log.Error("\nyou need admin privileges to install packages\n")
-		Log.Info("Please run this command from an elevated powershell session\n")
-		return
-	}
+// chocoInstallCommand implements the "choco-install" command
+type chocoInstallCommand struct {
+	args ConfigPathArg
+}
 
-	// no config file path provided, ask for it
-	if configFilePath == nil {
-		answer, err := utils.AskForConfigFilePath()
-		if err != nil {
-			Log.Error("failed to get user input\n")
-			return
-		}
+func (*chocoInstallCommand) Name() string  { return "choco-install" }
+func (*chocoInstallCommand) Title() string { return "Chocolatey install" }
+func (*chocoInstallCommand) Help() string {
+	return "Install Chocolatey packages according to the list provided in a YAML configuration file."
+}
+func (c *chocoInstallCommand) Flags() any { return &c.args }
+func (c *chocoInstallCommand) Run(ctx context.Context) error {
+	return InstallPackages(ctx, c.args.ConfigPath)
+}
 
-		configFilePath = &answer
+func InstallPackages(ctx context.Context, configFilePath *string) error {
+	// has admin privileges
+	if err := requireAdmin(ctx, "you need admin privileges to install packages"); err != nil {
+		return err
 	}
 
-	// config file path provided does not exist, ask for a new one
-	if !utils.IsPathExists(*configFilePath) {
-		Log.Error("\nfile not found. Please enter a valid path\n")
-
-		answer, err := utils.AskForConfigFilePath()
-		if err != nil {
-			Log.Error("failed to get user input\n")
-			return
-		}
-
-		configFilePath = &answer
+	yamlData, err := loadConfig(configFilePath)
+	if err != nil {
+		return err
 	}
 
-	yamlData := utils.ReadConfigFile(*configFilePath)
+	return sectionError(ctx, installPackages(ctx, yamlData))
+}
+
+// installPackages installs the packages of the given config using Chocolatey
+//   - Chocolatey will be installed first if the user agrees to it
+func installPackages(ctx context.Context, yamlData utils.ConfigYamlType) sectionResult {
+	result := sectionResult{Name: "packages"}
 
 	// packages is empty, exit
 	if len(yamlData.Packages) == 0 {
-		Log.Error("\nthe YAML file does not contain any packages\n")
-		return
+		result.abort(utils.NewError(utils.ErrConfig, "the YAML file does not contain any packages"))
+		return result
 	}
 
 	// check if chocolatey is installed
 	isChocolateyInstalled := Chocolatey.IsInstalled()
 	if !isChocolateyInstalled {
 		answer, err := Chocolatey.AskForInstallConfirmation()
-		if !answer || err != nil {
-			return
+		if err != nil {
+			result.Skipped = len(yamlData.Packages)
+			result.abort(fmt.Errorf("failed to get user input: %w", err))
+			return result
+		}
+		if !answer {
+			result.Skipped = len(yamlData.Packages)
+			result.abort(utils.NewError(utils.ErrCancelled, "chocolatey is not installed and its installation was declined"))
+			return result
 		}
 
 		// install chocolatey
-		Chocolatey.InstallSelf()
+		if err := Chocolatey.InstallSelf(ctx); err != nil {
+			result.Skipped = len(yamlData.Packages)
+			result.abort(err)
+			return result
+		}
 	}
 
 	Log.Info("\n" + fmt.Sprintf(`Found "%d" packages`, len(yamlData.Packages)))
 
 	// loop through packages and install them
-	for _, packageName := range yamlData.Packages {
+	for i, pkg := range yamlData.Packages {
+		if result.cancelled(ctx, len(yamlData.Packages)-i) {
+			return result
+		}
 
-		openInNewWindow := false
-		if strings.Contains(packageName, "--new-window") {
-			openInNewWindow = true
-			packageName = strings.ReplaceAll(packageName, "--new-window", "")
+		if !result.checkWhen(ctx, fmt.Sprintf(`"%s"`, pkg.Name), pkg.When, yamlData) {
+			continue
 		}
 
-		Log.Info("\n"+fmt.Sprintf(`Installing package: "%s"`, packageName), "\n")
+		Log.Info("\n"+fmt.Sprintf(`Installing package: "%s"`, pkg.Name), "\n")
 
-		Chocolatey.InstallPackage(packageName, openInNewWindow)
+		err := Chocolatey.InstallPackage(ctx, pkg)
+		if errors.Is(err, utils.ErrRebootRequired) {
+			Log.Warning("\n"+err.Error(), "\n")
+			result.RebootRequired = true
+			result.Succeeded++
+			continue
+		}
+		if err != nil && pkg.Optional {
+			Log.Warning("\nfailed to install the optional chocolatey package:", pkg.Name, "\n")
+			result.skip(fmt.Sprintf(`"%s"`, pkg.Name), "the optional package failed to install")
+			continue
+		}
+		if err != nil {
+			Log.Error("\nfailed to install chocolatey package:", pkg.Name, "\n")
+			result.Failed++
+			continue
+		}
+
+		result.Succeeded++
+	}
+
+	if result.Failed > 0 {
+		Log.Warning("\nFinished installing packages with errors\n")
+		return result
 	}
 
 	Log.Success("\nDone\n")
+
+	return result
 }
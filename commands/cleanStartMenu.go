@@ -1,38 +1,63 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+
+	"github.com/alabsi91/win-tools/commands/utils"
+	"github.com/alabsi91/win-tools/commands/utils/shellquote"
 )
 
-func CleanStartMenu() {
+// cleanStartMenuCommand implements the "clean-menu" command
+type cleanStartMenuCommand struct{}
+
+func (*cleanStartMenuCommand) Name() string  { return "clean-menu" }
+func (*cleanStartMenuCommand) Title() string { return "Clean start menu" }
+func (*cleanStartMenuCommand) Help() string {
+	return "Clean start menu from all icons."
+}
+func (*cleanStartMenuCommand) Flags() any                    { return &NoArgs{} }
+func (*cleanStartMenuCommand) Run(ctx context.Context) error { return CleanStartMenu(ctx) }
+
+func CleanStartMenu(ctx context.Context) error {
 	menuTemplatePath := filepath.Join(AssetsPath, "start2.bin")
 	targetPath := fmt.Sprintf(`C:\Users\%s\AppData\Local\Packages\Microsoft.Windows.StartMenuExperienceHost_cw5n1h2txyewy\LocalState`, os.Getenv("USERNAME"))
 	targetPath = filepath.Clean(targetPath)
 
 	Log.Info("\nCleaning the start menu ...\n")
 
-	shell := Powershell.GetShellName()
+	if Options.DryRun {
+		Log.DryRun(fmt.Sprintf(`copy "%s" to "%s"`, menuTemplatePath, targetPath))
+		Powershell.RestartWinExplorer()
+		return nil
+	}
 
-	cmd := exec.Command(
+	shell, err := Powershell.GetShellName()
+	if err != nil {
+		return err
+	}
+
+	cmd := utils.CommandContext(
+		ctx,
 		shell,
 		"-Command",
 		"Copy-Item",
-		"-Path", fmt.Sprintf(`"%s"`, menuTemplatePath),
-		"-Destination", fmt.Sprintf(`"%s"`, targetPath),
+		"-Path", shellquote.PowerShell(menuTemplatePath),
+		"-Destination", shellquote.PowerShell(targetPath),
 		"-Force",
 	)
 
-	_, err := cmd.Output()
+	_, err = cmd.Output()
 	if err != nil {
-		Log.Error("\nFailed to clean the start menu\n")
-		return
+		return fmt.Errorf("failed to clean the start menu: %w", err)
 	}
 
 	// restart explorer
 	Powershell.RestartWinExplorer()
 
 	Log.Success("\nDone!\n")
+
+	return nil
 }
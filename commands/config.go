@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alabsi91/win-tools/commands/utils"
+)
+
+// ConfigPathArg holds the flags of the commands reading a YAML config file
+type ConfigPathArg struct {
+	ConfigPath *string `arg:"--config" placeholder:"[PATH]" help:"YAML config file path"`
+}
+
+// configPathOf returns the config path of a subcommand, or the one passed to its parent command when it has none
+func configPathOf(args *ConfigPathArg, parentPath *string) *string {
+	if args.ConfigPath != nil {
+		return args.ConfigPath
+	}
+
+	return parentPath
+}
+
+// resolveConfigPath returns the path of the YAML config file to use
+//   - If no path is provided, the user will be asked for one
+//   - If the path does not exist, the user will be asked for a new one
+//   - Returns an error if the user cancels the prompt
+func resolveConfigPath(configFilePath *string) (string, error) {
+
+	// no config file path provided, ask for it
+	if configFilePath == nil {
+		answer, err := utils.AskForConfigFilePath()
+		if err != nil {
+			return "", fmt.Errorf("failed to get user input: %w", err)
+		}
+
+		configFilePath = &answer
+	}
+
+	// config file path provided does not exist, ask for a new one
+	if !utils.IsPathExists(*configFilePath) {
+		Log.Error("\nfile not found. Please enter a valid path\n")
+
+		answer, err := utils.AskForConfigFilePath()
+		if err != nil {
+			return "", fmt.Errorf("failed to get user input: %w", err)
+		}
+
+		configFilePath = &answer
+	}
+
+	return *configFilePath, nil
+}
+
+// loadConfig reads the YAML config file at the given path
+//   - The path is resolved with resolveConfigPath
+//   - Prints the names of the profiles selected for this machine
+//   - Returns an error if the user cancels the prompt or the config file is invalid
+func loadConfig(configFilePath *string) (utils.ConfigYamlType, error) {
+	path, err := resolveConfigPath(configFilePath)
+	if err != nil {
+		return utils.ConfigYamlType{}, err
+	}
+
+	config, err := utils.ReadConfigFile(path, true)
+	if err != nil {
+		return config, err
+	}
+
+	if len(config.ActiveProfiles) > 0 {
+		Log.Info(fmt.Sprintf("\nUsing the config profiles: %s", strings.Join(config.ActiveProfiles, ", ")))
+	}
+
+	return config, nil
+}
@@ -1,15 +1,48 @@
 package commands
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"strings"
 
+	"github.com/alabsi91/win-tools/commands/utils"
 	"github.com/charmbracelet/huh"
 )
 
+// CreateTemplateArgs holds the flags of the create-template command
+type CreateTemplateArgs struct {
+	TemplatePath *string `arg:"--save-path" placeholder:"[PATH]" help:"Output path for the template"`
+}
+
+// createTemplateCommand implements the "create-template" command
+type createTemplateCommand struct {
+	args CreateTemplateArgs
+}
+
+func (*createTemplateCommand) Name() string  { return "create-template" }
+func (*createTemplateCommand) Title() string { return "Create config template" }
+func (*createTemplateCommand) Help() string {
+	return "Generate a new YAML template for configuration, including placeholders for paths, scripts, and environment variables."
+}
+func (c *createTemplateCommand) Flags() any { return &c.args }
+func (c *createTemplateCommand) Run(context.Context) error {
+	return CreateConfigTemplate(c.args.TemplatePath)
+}
+
+// askForSavePath prompts the user to enter the path to save the config template to
+//   - Validates if the path ends with ".yaml"
+//   - Uses the "templatePath" answer from the answers file when provided
+//   - Returns an error if the user cancels the prompt
 func askForSavePath() (string, error) {
+	if answer, found, err := utils.AnswerFor("templatePath", utils.Answers.TemplatePath); found || err != nil {
+		if err == nil && !strings.HasSuffix(answer, ".yaml") {
+			err = utils.NewError(utils.ErrConfig, `the "templatePath" answer must have the .yaml extension`)
+		}
+		return answer, err
+	}
+
 	var results string
 
 	validate := func(str string) error {
@@ -31,18 +64,17 @@ func askForSavePath() (string, error) {
 		),
 	).Run()
 
-	return results, err
+	return results, utils.PromptError(err)
 }
 
-func CreateConfigTemplate(savePath *string) {
+func CreateConfigTemplate(savePath *string) error {
 
 	// check if the savePath is provided, if not, ask for it
 	if savePath == nil {
 
 		answer, err := askForSavePath()
 		if err != nil {
-			Log.Error("failed to get user input\n")
-			return
+			return fmt.Errorf("failed to get user input: %w", err)
 		}
 
 		savePath = &answer
@@ -54,23 +86,62 @@ func CreateConfigTemplate(savePath *string) {
 		Log.Error("\nfile extension must be .yaml\n")
 		answer, err := askForSavePath()
 		if err != nil {
-			Log.Error("failed to get user input\n")
-			return
+			return fmt.Errorf("failed to get user input: %w", err)
 		}
 
 		savePath = &answer
 	}
 
-	configTemplate := `backup:
+	configTemplate := "# yaml-language-server: $schema=" + utils.SchemaURL + "\n\n" + `# Other config files to merge into this one, relative to this file (the entries of this file win)
+# include:
+#   - base.yaml
+#   - roles/frontend.yaml
+
+# Variables used as ${name} in any value below, override them with "--var drive=E" or the WIN_TOOLS_VAR_drive environment variable
+#   write $${name} for a literal ${name}, e.g. in a script, an undefined ${name} like bash's ${HOME} is left as is in the scripts
+vars:
+  drive: F
+
+backup:
   # Files and folders paths to backup
   paths:
     - D:\data # Example: a folder path
     - F:\importantText.txt # Example: a file path
     - "%localappdata%\\app" # Example: a path with environment variable
     - C:\Users\%USERNAME%\Saved Games # Example: a path with environment variable
-
-  # backup/restore paths to/from this path
-  target: F:\backup # Example: a folder path
+    - "%GAMES_DIR:-D:\\Games%\\saves" # Example: an environment variable with a default value
+    - "{Documents}\\My Games" # Example: a known folder ({Desktop}, {Documents}, {Downloads}, {AppData}, {LocalAppData}, ...)
+    - ~\.gitconfig # Example: a path in the home directory
+
+    # Example: a path backed up only when a condition is true
+    #   functions: admin, build, hostname, env("NAME"), exists("path"), profile("name"), tag("name")
+    #   operators: !, &&, ||, ==, !=, <, <=, >, >= and parentheses
+    - path: "{LocalAppData}\\Steam\\config"
+      when: exists("{LocalAppData}\\Steam")
+
+    # Example: a project folder without its dependencies and build output
+    #   glob patterns relative to the path, ** matches any number of folders, a name without / matches at any depth
+    #   the patterns of the .wintoolsignore file next to this config file are excluded from every path
+    - path: D:\projects\website
+      exclude:
+        - node_modules
+        - .git/objects
+        - "**/bin/obj"
+      # include: ["src/**", "*.json"] # only these files when set
+
+  # backup/restore paths to/from this path, each backup creates a snapshot folder in it named by the time and the hostname
+  target: ${drive}:\backup # Example: a folder path using the "drive" variable
+
+  # flat: true # back up into the target folder itself, replacing the previous backup, instead of a new snapshot
+
+  # format: zip # or tar.gz, stream all the paths into a single archive instead of copying them into a folder
+
+  # Which snapshots to keep, the others are deleted after each backup and by "win-tools backup prune"
+  retention:
+    last: 3 # the last 3 snapshots
+    daily: 7 # the newest snapshot of each of the last 7 days
+    weekly: 4
+    monthly: 6
 
 # A list of environment variables to be set
 environmentVariables:
@@ -82,6 +153,12 @@ environmentVariables:
   - key: PATH
     value: F:\Android\Sdk\platform-tools
     scope: User
+    when: exists("F:\\Android\\Sdk") # set only when the path exists
+
+  # Example: an encrypted value, created with "win-tools secrets encrypt" (or "enc:..." instead of "!secret ...")
+  # - key: API_TOKEN
+  #   value: !secret AeC6xsw8Qi5UHy96B6PENhy5O7ljLUvALwMgfabwwJeWjsVbEiLKhqvHReLyc...
+  #   scope: User
 
 # A list of packages to be installed using Chocolatey
 packages:
@@ -102,6 +179,17 @@ packages:
   # --- DEV ---
   - visualstudio2022community --package-parameters "--passive --locale en-US" # Example: with parameters
 
+  # Example: with options
+  - name: nodejs-lts
+    version: 20.15.1 # the latest version when omitted
+    params: /InstallDir:D:\Apps\nodejs # package parameters
+    source: https://community.chocolatey.org/api/v2/ # where to install the package from
+    newWindow: false # install in a new terminal window without waiting for it to finish
+    ignoreChecksum: false
+    timeout: 1800 # seconds
+    optional: true # a failure does not fail the "packages" section
+    when: build >= 22000 && !env("CI") # installed only on Windows 11 outside of CI
+
 # A list of scripts to be executed
 scripts:
   # Example: single line with cmd shell
@@ -119,13 +207,108 @@ scripts:
   - >
     powershell $name = "David";
     echo "Hello $name!";
+
+  # Example: structured script
+  - name: greet
+    shell: pwsh # cmd, powershell, pwsh, bash or python
+    run: Write-Output "Hello $env:GREETING from $PWD"
+    cwd: "{Documents}" # relative paths are resolved against this config file
+    env:
+      GREETING: World
+    timeout: 60 # seconds before the script is stopped
+    continueOnError: true # keep running the next scripts when this one fails
+    exitCodes: [0, 3010] # exit codes meaning success
+    when: admin || profile("laptop") # run only as admin or when the "laptop" profile is selected
+
+  # Example: scripts safe to run again, skipped once their work is done
+  - name: clone dotfiles
+    run: git clone https://github.com/me/dotfiles "%USERPROFILE%\dotfiles"
+    creates: ~\dotfiles # skipped when this path exists
+  - name: create the dev user
+    shell: powershell
+    run: New-LocalUser -Name dev -NoPassword
+    unless: Get-LocalUser -Name dev # skipped when this command exits with 0
+    onlyIf: Get-Command New-LocalUser # run only when this command exits with 0
+
+  # Example: scripts depending on each other, with "--jobs 2" the two downloads run at the same time
+  - id: android-sdk
+    shell: powershell
+    run: sdkmanager "platform-tools" "platforms;android-34"
+  - id: flutter-sdk
+    run: git clone https://github.com/flutter/flutter.git -b stable F:\flutter
+    creates: F:\flutter
+  - name: flutter doctor
+    needs: [android-sdk, flutter-sdk] # starts once both succeeded
+    run: F:\flutter\bin\flutter doctor --android-licenses
+
+  # Example: script file, relative to this config file
+  - name: setup
+    shell: powershell
+    file: scripts/setup.ps1
+
+  # Example: scripts running a snippet, the values are quoted for the shell of the snippet
+  - name: git identity
+    use: git-identity
+    with:
+      name: John Doe
+      email: john@example.com
+
+# Reusable scripts with parameters, run by the scripts with "use", may be declared in an included file
+snippets:
+  git-identity:
+    description: Set the global git user
+    shell: powershell
+    params:
+      name:
+        required: true
+      email:
+        required: true
+        pattern: '[^@\s]+@[^@\s]+' # the whole value must match
+      signCommits:
+        type: bool # string (default), int or bool
+        default: "false"
+    run: |
+      git config --global user.name {{name}}
+      git config --global user.email {{email}}
+      if ({{signCommits}}) { git config --global commit.gpgsign true }
+
+  # Example: a snippet read from a file, relative to this config file
+  # dev-folders:
+  #   shell: powershell
+  #   params:
+  #     drive:
+  #       enum: [C, D, E, F]
+  #       default: D
+  #   file: snippets/dev-folders.ps1 # the parameters are written as {{name}} in the file too
+
+# Used by the "apply" command to run all the sections above at once
+apply:
+  # The sections to apply in order (backup, restore, environmentVariables, packages, scripts)
+  order:
+    - environmentVariables
+    - packages
+    - scripts
+
+  onError: stop # or continue (keep applying the next sections when one fails)
+
+# Overlays merged into the config above on some machines only
+profiles:
+  - name: laptop
+    hostnames: ["LAPTOP-*"] # Example: selected when the hostname matches
+    tags: [laptop] # Example: selected with "--tag laptop"
+    packages:
+      - powertoys
 `
 
+	if Options.DryRun {
+		Log.DryRun(fmt.Sprintf(`write the config file template to "%s"`, *savePath))
+		return nil
+	}
+
 	// Create the file
 	file, err := os.Create(*savePath)
 	if err != nil {
-		Log.Error("\n"+fmt.Sprintf(`error while creating the config file template at: "%s"`, *savePath), "\n")
-		return
+		return fmt.Errorf(`error while creating the config file template at: "%s": %w`, *savePath, err)
 	}
 	// Ensure the file is closed properly after writing
 	defer file.Close()
@@ -133,9 +316,10 @@ scripts:
 	// Write some text to the file
 	_, err = file.WriteString(configTemplate)
 	if err != nil {
-		Log.Error("\n"+fmt.Sprintf(`error while creating the config file template at: "%s"`, *savePath), "\n")
-		return
+		return fmt.Errorf(`error while creating the config file template at: "%s": %w`, *savePath, err)
 	}
 
 	Log.Success("\n" + fmt.Sprintf(`config file template created at: "%s"`, *savePath) + "\n")
+
+	return nil
 }
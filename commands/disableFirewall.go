@@ -1,30 +1,43 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
+
+	"github.com/alabsi91/win-tools/commands/utils/shellquote"
 )
 
-func DisableFirewall() {
-	// has admin privileges
-	isAdmin := Powershell.IsAdmin()
+// disableFirewallCommand implements the "disable-firewall" command
+type disableFirewallCommand struct{}
+
+func (*disableFirewallCommand) Name() string  { return "disable-firewall" }
+func (*disableFirewallCommand) Title() string { return "Disable Windows firewall" }
+func (*disableFirewallCommand) Help() string {
+	return "Disable Windows firewall, Windows Defender, and Windows Defender Cloud."
+}
+func (*disableFirewallCommand) Flags() any                    { return &NoArgs{} }
+func (*disableFirewallCommand) Run(ctx context.Context) error { return DisableFirewall(ctx) }
 
-	if !isAdmin {
-		Log.Error("\nyou need admin privileges to run this command\n")
-		Log.Info("Please run this command from an elevated powershell session\n")
-		return
+func DisableFirewall(ctx context.Context) error {
+	// has admin privileges
+	if err := requireAdmin(ctx, "you need admin privileges to run this command"); err != nil {
+		return err
 	}
 
 	scriptPath := filepath.Join(AssetsPath, "disableFirewall.ps1")
 
 	err := Powershell.RunPathThroughCmd(
+		ctx,
 		"Set-ExecutionPolicy -ExecutionPolicy Bypass -Scope Process -Force;",
-		fmt.Sprintf(`&"%s"`, scriptPath),
+		"& "+shellquote.PowerShell(scriptPath),
 	)
 
 	if err != nil {
-		Log.Fatal("\n"+err.Error(), "\n")
+		return fmt.Errorf("failed to disable the firewall: %w", err)
 	}
 
 	Log.Success("\nDone!\n")
+
+	return nil
 }
@@ -0,0 +1,24 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/alabsi91/win-tools/commands/utils"
+)
+
+// requireAdmin checks if the current user has admin privileges
+//   - In dry run mode, only a warning is logged so the plan can still be reviewed without elevation
+//
+// Returns: an error of kind ErrPrivilege with the given message when the privileges are missing
+func requireAdmin(ctx context.Context, message string) error {
+	if Powershell.IsAdmin(ctx) {
+		return nil
+	}
+
+	if Options.DryRun {
+		Log.Warning("\n" + message + ", continuing because of dry run mode\n")
+		return nil
+	}
+
+	return utils.NewError(utils.ErrPrivilege, "%s\nPlease run this command from an elevated powershell session", message)
+}
@@ -0,0 +1,61 @@
+package commands
+
+import "context"
+
+// Command is a single win-tools subcommand
+//   - The command line parser, the interactive menu and the help message are all generated from it
+type Command interface {
+	// Name is the subcommand name used on the command line
+	Name() string
+
+	// Title is the label of the command in the interactive menu
+	Title() string
+
+	// Help describes the command in the help message and the interactive menu
+	Help() string
+
+	// Flags returns a pointer to the struct holding the command line flags of the command
+	//   - The struct fields use the go-arg tags
+	//   - The parsed flags are copied into it before Run is called
+	Flags() any
+
+	// Run runs the command with the parsed flags
+	//   - ctx is cancelled when the user presses Ctrl+C, the running steps are stopped with their child processes
+	Run(ctx context.Context) error
+}
+
+// NoArgs is the flags struct of the commands without any flags
+type NoArgs struct{}
+
+// Commands lists every available command in the order they are shown in the help message and the interactive menu
+var Commands = []Command{
+	&applyCommand{},
+	&backupCommand{},
+	&restoreCommand{},
+	&chocoInstallCommand{},
+	&runScriptsCommand{},
+	&setEnvsCommand{},
+	&createTemplateCommand{},
+	&validateCommand{},
+	&schemaCommand{},
+	&showConfigCommand{},
+	&secretsCommand{},
+	&setRegistryCommand{},
+	&cleanStartMenuCommand{},
+	&autoLogonCommand{},
+	&disableFirewallCommand{},
+	&uninstallBloatCommand{},
+}
+
+// FindCommand looks up a command by its name
+//
+// Returns: nil if no command has the given name
+func FindCommand(name string) Command {
+	for _, command := range Commands {
+		if command.Name() == name {
+			return command
+		}
+	}
+
+	return nil
+}
@@ -1,72 +1,289 @@
 package commands
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/alabsi91/win-tools/commands/utils"
 )
 
-func RestoreData(configFilePath *string) {
-	// no config file path provided, ask for it
-	if configFilePath == nil {
-		answer, err := utils.AskForConfigFilePath()
-		if err != nil {
-			Log.Error("failed to get user input\n")
-			return
-		}
+// RestoreArgs holds the flags of the restore command
+type RestoreArgs struct {
+	ConfigPath *string `arg:"--config" placeholder:"[PATH]" help:"YAML config file path"`
+	Snapshot   *string `arg:"--snapshot" placeholder:"[NAME]" help:"The snapshot to restore, the newest one of this machine by default, see \"win-tools backup list\""`
+}
 
-		configFilePath = &answer
-	}
+// restoreCommand implements the "restore" command
+type restoreCommand struct {
+	args RestoreArgs
+}
 
-	// config file path provided does not exist, ask for a new one
-	if !utils.IsPathExists(*configFilePath) {
-		Log.Error("\nfile not found. Please enter a valid path\n")
+func (*restoreCommand) Name() string  { return "restore" }
+func (*restoreCommand) Title() string { return "Restore" }
+func (*restoreCommand) Help() string {
+	return "Restore files and directories from a backup using the paths specified in a YAML configuration file."
+}
+func (c *restoreCommand) Flags() any { return &c.args }
+func (c *restoreCommand) Run(ctx context.Context) error {
+	return RestoreData(ctx, c.args.ConfigPath, c.args.Snapshot)
+}
 
-		answer, err := utils.AskForConfigFilePath()
-		if err != nil {
-			Log.Error("failed to get user input\n")
-			return
-		}
+func RestoreData(ctx context.Context, configFilePath *string, snapshot *string) error {
+	yamlData, err := loadConfig(configFilePath)
+	if err != nil {
+		return err
+	}
 
-		configFilePath = &answer
+	name := ""
+	if snapshot != nil {
+		name = *snapshot
 	}
 
-	yamlData := utils.ReadConfigFile(*configFilePath)
+	return sectionError(ctx, restoreSnapshot(ctx, yamlData, name))
+}
+
+// restoreData copies the backup paths of the given config from the newest snapshot of the backup target back to their locations
+func restoreData(ctx context.Context, yamlData utils.ConfigYamlType) sectionResult {
+	return restoreSnapshot(ctx, yamlData, "")
+}
+
+// restoreSnapshot copies the backup paths of the given config from a snapshot of the backup target back to their locations
+//   - The paths are restored to the locations recorded in the manifest of the backup, see restoreItems
+//   - The paths of an archive are extracted to their locations in a single read of the archive, see extractItems
+//   - snapshot is the name of the snapshot, the newest one of this machine when empty, see utils.ResolveBackupSource
+func restoreSnapshot(ctx context.Context, yamlData utils.ConfigYamlType, snapshot string) sectionResult {
+	result := sectionResult{Name: "restore"}
 
 	// paths is empty, exit
 	if len(yamlData.Backup.Paths) == 0 {
-		Log.Error("\nthe YAML file does not contain any backup paths\n")
-		return
+		result.abort(utils.NewError(utils.ErrConfig, "the YAML file does not contain any backup paths"))
+		return result
+	}
+
+	target, err := utils.PathExpander.Expand(yamlData.Backup.Target)
+	if err != nil {
+		result.abort(err)
+		return result
 	}
+	yamlData.Backup.Target = target
 
 	// check the target path
 	isTargetPathExists := utils.IsPathExists(yamlData.Backup.Target)
 	if !isTargetPathExists {
-		Log.Error(fmt.Sprintf("\n"+`the target path does not exist: "%s"`, yamlData.Backup.Target), "\n")
-		return
+		result.abort(utils.NewError(utils.ErrConfig, `the target path does not exist: "%s"`, yamlData.Backup.Target))
+		return result
+	}
+
+	source, err := utils.ResolveBackupSource(yamlData.Backup, yamlData.Backup.Target, snapshot)
+	if err != nil {
+		result.abort(err)
+		return result
+	}
+	yamlData.Backup.Target = source
+
+	manifest, err := loadRestoreManifest(source)
+	if err != nil {
+		result.abort(err)
+		return result
 	}
 
+	items := restoreItems(yamlData, manifest)
+
 	Log.Warning("\nFiles and folders with the same name will be overwritten.\n")
 	Log.Info(fmt.Sprintf(`Restoring data from: "%s"`, yamlData.Backup.Target), "\n")
 
-	// loop over paths and copy the files and folders to the target path
-	utils.PreparePathsString(yamlData.Backup.Paths)
-	for _, path := range yamlData.Backup.Paths {
+	// the paths of an archive are extracted together once they are all known
+	var extracting []restoreItem
+
+	// loop over the backup paths and copy them back to their locations
+	for i, item := range items {
+		if result.cancelled(ctx, len(items)-i) {
+			return result
+		}
+
+		if item.entry != "" && !result.checkWhen(ctx, fmt.Sprintf(`"%s"`, item.entry), item.when, yamlData) {
+			continue
+		}
+
+		if item.err != nil {
+			Log.Error("\n"+item.err.Error(), "\n")
+			result.Failed++
+			continue
+		}
 
-		fromPath := filepath.Join(yamlData.Backup.Target, filepath.Base(path))
-		toPath := filepath.Dir(path)
+		if utils.IsBackupArchive(source) {
+			extracting = append(extracting, item)
+			continue
+		}
 
-		Log.Info(fmt.Sprintf(`Copying "%s" to "%s"`, fromPath, toPath))
+		// copied to the recorded location itself, the root of a drive is not named like its folder in the backup
+		fromPath := filepath.Join(source, filepath.FromSlash(item.root))
 
-		err := utils.Copy(fromPath, toPath)
+		Log.Info(fmt.Sprintf(`Copying "%s" to "%s"`, fromPath, item.destination))
+
+		err = utils.CopyFilteredAs(fromPath, item.destination, item.filter)
 
 		if err != nil {
 			formattedErr := strings.Join(strings.Split(err.Error(), ": "), "\n")
 			Log.Error("\nfailed to copy the path:", fromPath, "\n"+formattedErr, "\n")
+			result.Failed++
+			continue
 		}
+
+		result.Succeeded++
+	}
+
+	if len(extracting) > 0 && !extractItems(ctx, &result, source, extracting) {
+		return result
+	}
+
+	if result.Failed > 0 {
+		Log.Warning("\nRestore completed with errors\n")
+		return result
 	}
 
 	Log.Success("\nRestore completed\n")
+
+	return result
+}
+
+// extractItems extracts the backup paths of an archive to their locations, see utils.ExtractBackupPaths
+//
+// Returns: false if the restore was cancelled
+func extractItems(ctx context.Context, result *sectionResult, archivePath string, items []restoreItem) bool {
+	paths := make([]utils.ArchivePath, len(items))
+	for i, item := range items {
+		Log.Info(fmt.Sprintf(`Extracting "%s" to "%s"`, item.root, item.destination))
+		paths[i] = utils.ArchivePath{Root: item.root, Destination: item.destination, Filter: item.filter}
+	}
+
+	stats, errs, err := utils.ExtractBackupPaths(ctx, archivePath, paths)
+	if errors.Is(err, utils.ErrCancelled) && result.cancelled(ctx, len(items)) {
+		return false
+	}
+	if err != nil {
+		formattedErr := strings.Join(strings.Split(err.Error(), ": "), "\n")
+		Log.Error("\nfailed to read the archive:", archivePath, "\n"+formattedErr, "\n")
+		result.Failed += len(items)
+		return true
+	}
+
+	for i, item := range items {
+		if errs[i] != nil {
+			formattedErr := strings.Join(strings.Split(errs[i].Error(), ": "), "\n")
+			Log.Error("\nfailed to extract the path:", item.destination, "\n"+formattedErr, "\n")
+			result.Failed++
+			continue
+		}
+
+		Log.Info(fmt.Sprintf(`extracted "%s": %s`, item.destination, utils.CountFiles(stats[i].Copied, stats[i].CopiedBytes)))
+		result.Succeeded++
+	}
+
+	return true
+}
+
+// restoreItem is a backup path to restore, from its root in the backup to its location
+type restoreItem struct {
+	root        string // see utils.BackupManifest.Paths
+	destination string
+	entry       string // the path as written in the config file, empty for a path missing from it
+	when        string
+	filter      *utils.BackupFilter
+	err         error // the path cannot be restored
+}
+
+// loadRestoreManifest reads the manifest of the backup source, from the archive or the snapshot directory
+//
+// Returns: nil for a backup written before the manifest recorded the backup paths, its paths are found by their base name
+func loadRestoreManifest(source string) (*utils.BackupManifest, error) {
+	if utils.IsBackupArchive(source) {
+		return utils.LoadArchiveManifest(source)
+	}
+
+	manifest, err := utils.LoadBackupManifest(source)
+	if err != nil {
+		Log.Warning(err.Error() + ", the paths are restored by their base name\n")
+		return nil, nil
+	}
+	if len(manifest.Paths) == 0 {
+		return nil, nil
+	}
+
+	return manifest, nil
+}
+
+// restoreItems lists the backup paths to restore, each root of the backup once
+//   - A path of the config file is found in the backup by the path as written, see utils.BackupPath.Entry,
+//     and restored to its expanded value, e.g. to the profile of the current user when it was backed up by another one
+//   - A path the backup did not record as written is found by its expanded value and restored to the recorded location,
+//     the expanded path only differs by its case or its trailing separator
+//   - The paths of the config file missing from the backup are reported as errors,
+//     the paths of the backup missing from the config file are restored to their recorded location
+//   - Without a manifest, the paths of the config file are found in the backup by their base name
+func restoreItems(yamlData utils.ConfigYamlType, manifest *utils.BackupManifest) []restoreItem {
+	var items []restoreItem
+
+	entries, roots := map[string]string{}, map[string]string{}
+	if manifest != nil {
+		for root, entry := range manifest.Entries {
+			entries[entry] = root
+		}
+		for root, path := range manifest.Paths {
+			roots[strings.ToLower(filepath.Clean(path))] = root
+		}
+	}
+
+	restored := map[string]bool{}
+	for _, entry := range yamlData.Backup.Paths {
+		item := restoreItem{entry: entry.Path, when: entry.When}
+
+		path, err := utils.PathExpander.Expand(entry.Path)
+		if err == nil {
+			item.filter, err = yamlData.Backup.Filter(entry)
+		}
+		if err != nil {
+			item.err = err
+			items = append(items, item)
+			continue
+		}
+
+		item.root, item.destination = filepath.Base(path), path
+		if manifest != nil {
+			root, found := entries[entry.Entry()]
+			if !found {
+				root, found = roots[strings.ToLower(filepath.Clean(path))]
+				item.destination = manifest.Paths[root]
+			}
+
+			switch {
+			case !found:
+				item.err = fmt.Errorf(`"%s" is not in the backup`, path)
+			case restored[root]:
+				item.err = fmt.Errorf(`"%s" is already restored by another path of the config file`, path)
+			}
+			item.root, restored[root] = root, true
+		}
+
+		items = append(items, item)
+	}
+
+	if manifest == nil {
+		return items
+	}
+
+	// the paths removed from the config file since the backup are still restored
+	var missing []restoreItem
+	for root, path := range manifest.Paths {
+		if !restored[root] {
+			missing = append(missing, restoreItem{root: root, destination: path, filter: yamlData.Backup.IgnoreFilter()})
+		}
+	}
+	slices.SortFunc(missing, func(a, b restoreItem) int { return strings.Compare(a.root, b.root) })
+
+	return append(items, missing...)
 }
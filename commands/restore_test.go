@@ -0,0 +1,66 @@
+package commands
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alabsi91/win-tools/commands/utils"
+	"github.com/goccy/go-yaml"
+)
+
+func TestRestoreItems(t *testing.T) {
+	t.Setenv("WHO", "bob")
+
+	var config utils.ConfigYamlType
+	err := yaml.Unmarshal([]byte(`
+backup:
+  paths:
+    - /home/%WHO%/cfg
+    - path: /HOME/same/
+    - /home/none
+    - /home/%WHO%/cfg
+`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// backed up by alice, "home/same" by a version not recording the paths as written
+	manifest := &utils.BackupManifest{
+		Paths:   map[string]string{"home/alice/cfg": "/home/alice/cfg", "home/same": "/home/same", "home/old": "/home/old"},
+		Entries: map[string]string{"home/alice/cfg": "/home/%WHO%/cfg", "home/old": "/home/old"},
+	}
+
+	tests := []struct {
+		root        string
+		destination string
+		err         string
+	}{
+		{"home/alice/cfg", "/home/bob/cfg", ""},
+		{"home/same", "/home/same", ""},
+		{"", "", `"/home/none" is not in the backup`},
+		{"home/alice/cfg", "", `"/home/bob/cfg" is already restored by another path of the config file`},
+		{"home/old", "/home/old", ""},
+	}
+
+	items := restoreItems(config, manifest)
+	if len(items) != len(tests) {
+		t.Fatalf("restoreItems() = %+v, want %d items", items, len(tests))
+	}
+
+	for i, test := range tests {
+		item := items[i]
+		if test.err != "" {
+			if item.err == nil || !strings.Contains(item.err.Error(), test.err) {
+				t.Errorf("item %d error = %v, want it to contain %q", i, item.err, test.err)
+			}
+			continue
+		}
+
+		if item.err != nil {
+			t.Errorf("item %d returned an error: %v", i, item.err)
+		}
+		if item.root != test.root || item.destination != test.destination {
+			t.Errorf("item %d restores %q to %q, want %q to %q", i, item.root, item.destination, test.root, test.destination)
+		}
+	}
+}
@@ -1,83 +1,456 @@
 package commands
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/alabsi91/win-tools/commands/utils"
 )
 
-func RunScripts(configFilePath *string) {
+// runScriptsCommand implements the "run-scripts" command
+type runScriptsCommand struct {
+	args ConfigPathArg
+}
 
-	// no config file path provided, ask for it
-	if configFilePath == nil {
-		answer, err := utils.AskForConfigFilePath()
-		if err != nil {
-			Log.Error("failed to get user input\n")
-			return
-		}
+func (*runScriptsCommand) Name() string  { return "run-scripts" }
+func (*runScriptsCommand) Title() string { return "Run scripts" }
+func (*runScriptsCommand) Help() string {
+	return "Execute a series of scripts defined in a YAML configuration file."
+}
+func (c *runScriptsCommand) Flags() any                    { return &c.args }
+func (c *runScriptsCommand) Run(ctx context.Context) error { return RunScripts(ctx, c.args.ConfigPath) }
 
-		configFilePath = &answer
+func RunScripts(ctx context.Context, configFilePath *string) error {
+	yamlData, err := loadConfig(configFilePath)
+	if err != nil {
+		return err
 	}
 
-	// config file path provided does not exist, ask for a new one
-	if !utils.IsPathExists(*configFilePath) {
-		Log.Error("\nfile not found. Please enter a valid path\n")
+	return sectionError(ctx, runScripts(ctx, yamlData))
+}
 
-		answer, err := utils.AskForConfigFilePath()
-		if err != nil {
-			Log.Error("failed to get user input\n")
-			return
-		}
+// scriptState is the state of a script while the scripts are running
+type scriptState int
 
-		configFilePath = &answer
-	}
+const (
+	scriptPending scriptState = iota
+	scriptRunning
+	scriptSucceeded
+	scriptSkipped // skipped by its condition or a guard, the scripts needing it still run
+	scriptFailed
+	scriptBlocked // not run because a script it needs failed or was not run
+)
+
+// scriptOutcome is sent by a script running in the background once it is done
+type scriptOutcome struct {
+	index int
 
-	yamlData := utils.ReadConfigFile(*configFilePath)
+	// reason is set when a guard skipped the script
+	reason string
+
+	err error
+
+	// exitCode is nil when the script did not run or did not exit by itself
+	exitCode *int
+	duration time.Duration
+	logPath  string
+}
+
+// runScripts runs the scripts of the given config
+//   - A script starts once the scripts it needs are done, up to --jobs scripts run at the same time,
+//     the ready scripts start in the order they are declared
+//   - A script is skipped when its condition is false or one of its guards says so, see checkGuards
+//   - A script needing a script that failed is not run
+//   - No more scripts start once a script fails, unless the script has continueOnError set
+//   - When running more than one script at the same time, each line of their output starts with the label of the script
+//   - The output of each script and a run report are saved to a log directory, see scriptRun
+//   - When ctx is cancelled, the running scripts are stopped with their child processes and no more scripts start
+func runScripts(ctx context.Context, yamlData utils.ConfigYamlType) sectionResult {
+	result := sectionResult{Name: "scripts"}
 
 	// scripts is empty, exit
 	if len(yamlData.Scripts) == 0 {
-		Log.Error("\nthe YAML file does not contain any scripts\n")
-		return
+		result.abort(utils.NewError(utils.ErrConfig, "the YAML file does not contain any scripts"))
+		return result
+	}
+
+	scripts := yamlData.Scripts
+
+	dependencies, err := utils.ScriptDependencies(scripts)
+	if err != nil {
+		result.abort(utils.NewError(utils.ErrConfig, "%s", err.Error()))
+		return result
 	}
 
 	// has admin privileges
-	isAdmin := Powershell.IsAdmin()
+	isAdmin := Powershell.IsAdmin(ctx)
 	if !isAdmin {
 		Log.Warning("\nYou may need admin privileges to run some scripts")
 	}
 
-	// loop through the scripts
-	for i, script := range yamlData.Scripts {
-		Log.Info("\n"+fmt.Sprintf(`Running the script with the index "%d"`, i), "\n")
+	jobs := max(Options.Jobs, 1)
+	if jobs > 1 {
+		Log.Info("\n" + fmt.Sprintf(`Running up to "%d" scripts at the same time`, jobs))
+	}
+
+	run := newScriptRun(scripts)
+
+	states := make([]scriptState, len(scripts))
+	outcomes := make(chan scriptOutcome)
+	running := 0
+	stopping := false
+
+	for {
+		// start the ready scripts, until no more script changes its state
+		for changed := true; changed; {
+			changed = false
+
+			for i, script := range scripts {
+				if states[i] != scriptPending {
+					continue
+				}
+
+				ready, blockedBy := dependenciesState(states, dependencies[i])
+				if blockedBy >= 0 {
+					reason := fmt.Sprintf(`it needs the script %s, which was not run successfully`, scripts[blockedBy].DisplayName(blockedBy))
+					Log.Info(fmt.Sprintf(`Skipping the script %s, %s`, script.DisplayName(i), reason))
+					result.skip("the script "+script.DisplayName(i), reason)
+					run.record(i, statusNotRun, reason)
+					states[i] = scriptBlocked
+					changed = true
+					continue
+				}
 
-		shell := "cmd"
-		command := "/C"
+				if !ready || stopping || ctx.Err() != nil || running >= jobs {
+					continue
+				}
+
+				changed = true
+
+				failed := result.Failed
+				if !result.checkWhen(ctx, "the script "+script.DisplayName(i), script.When, yamlData) {
+					states[i] = scriptSkipped
+					run.record(i, statusSkipped, fmt.Sprintf(`the condition "%s" is false`, script.When))
+
+					// the condition could not be evaluated
+					if result.Failed > failed {
+						states[i] = scriptFailed
+						run.record(i, statusFailed, "the condition could not be evaluated")
+						stopping = stopping || !script.ContinueOnError
+					}
+					continue
+				}
+
+				prefix := ""
+				if jobs > 1 {
+					prefix = fmt.Sprintf("[%s] ", script.Label(i))
+				}
+
+				states[i] = scriptRunning
+				running++
+
+				go func(i int, script utils.ScriptEntry) {
+					outcomes <- runScriptJob(ctx, i, script, prefix, run)
+				}(i, script)
+			}
+		}
 
-		script, isPowershell := strings.CutPrefix(script, "powershell")
-		if isPowershell {
-			shell = Powershell.GetShellName()
-			command = "-Command"
+		if running == 0 {
+			break
 		}
 
-		cmd := exec.Command(shell, command, script)
+		outcome := <-outcomes
+		running--
 
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		script := scripts[outcome.index]
+		run.recordOutcome(outcome)
 
-		if err := cmd.Start(); err != nil {
-			Log.Error("\n" + fmt.Sprintf(`Failed to run the script with the index "%d"`, i))
-			return
+		switch {
+		case outcome.err != nil:
+			Log.Error("\n" + fmt.Sprintf(`Failed to run the script %s: %s`, script.DisplayName(outcome.index), outcome.err.Error()))
+			result.Failed++
+			states[outcome.index] = scriptFailed
+			stopping = stopping || !script.ContinueOnError
+
+		case outcome.reason != "":
+			Log.Info(fmt.Sprintf(`Skipping the script %s, %s`, script.DisplayName(outcome.index), outcome.reason))
+			result.skip("the script "+script.DisplayName(outcome.index), outcome.reason)
+			states[outcome.index] = scriptSkipped
+
+		default:
+			if jobs > 1 {
+				Log.Info(fmt.Sprintf(`The script %s is done`, script.DisplayName(outcome.index)))
+			}
+			result.Succeeded++
+			states[outcome.index] = scriptSucceeded
 		}
+	}
+
+	// the scripts not started because a script failed or the run was cancelled
+	reason := "a previous script failed"
+	if ctx.Err() != nil {
+		reason = "cancelled by the user"
+	}
 
-		if err := cmd.Wait(); err != nil {
-			Log.Error("\n" + fmt.Sprintf(`Failed to run the script with the index "%d"`, i))
-			return
+	notStarted := 0
+	for i, state := range states {
+		if state == scriptPending {
+			notStarted++
+			run.record(i, statusNotRun, reason)
 		}
 	}
+	result.Skipped += notStarted
+
+	run.finish()
+
+	if ctx.Err() != nil {
+		result.abort(utils.NewError(utils.ErrCancelled, "cancelled by the user, scripts not started: %d", notStarted))
+		return result
+	}
+
+	if result.Failed > 0 {
+		Log.Warning("\nFinished running the scripts with errors\n")
+		return result
+	}
 
 	Log.Success("\nAll scripts have been run successfully\n")
+
+	return result
+}
+
+// dependenciesState checks whether the scripts needed by a script are done
+//
+// Returns:
+//   - true if all the needed scripts succeeded or were skipped
+//   - The index of a needed script that failed or was not run, -1 if there is none
+func dependenciesState(states []scriptState, dependencies []int) (bool, int) {
+	ready := true
+	for _, dependency := range dependencies {
+		switch states[dependency] {
+		case scriptFailed, scriptBlocked:
+			return false, dependency
+		case scriptPending, scriptRunning:
+			ready = false
+		}
+	}
+
+	return ready, -1
+}
+
+// runScriptJob checks the guards of a script and runs it, see checkGuards and runScript
+//   - prefix: set when running more than one script at the same time, see runScript
+//   - The output of the script is saved to its log file in the log directory of the run
+func runScriptJob(ctx context.Context, index int, script utils.ScriptEntry, prefix string, run *scriptRun) scriptOutcome {
+	reason, err := checkGuards(ctx, script)
+	if err != nil || reason != "" {
+		return scriptOutcome{index: index, reason: reason, err: err}
+	}
+
+	Log.Info("\n"+fmt.Sprintf(`Running the script %s`, script.DisplayName(index)), "\n")
+
+	outcome := scriptOutcome{index: index}
+
+	var log io.Writer
+	logFile, err := run.createLog(index, script)
+	if err != nil {
+		Log.Warning(fmt.Sprintf(`The output of the script %s will not be saved: %s`, script.DisplayName(index), err.Error()))
+	}
+	if logFile != nil {
+		defer logFile.Close()
+		log = logFile
+		outcome.logPath = logFile.Name()
+	}
+
+	start := time.Now()
+	exitCode, err := runScript(ctx, script, prefix, log)
+	outcome.duration = time.Since(start)
+	outcome.err = err
+
+	if exitCode >= 0 {
+		outcome.exitCode = &exitCode
+	}
+
+	return outcome
+}
+
+// scriptOutput is where the input and the output of a command go, nil fields are discarded
+type scriptOutput struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+// runScript runs a single script and streams its output to the console
+//   - The script is stopped with its child processes when it runs longer than its timeout or ctx is cancelled
+//   - prefix: when set, each line of the output starts with it and the input of the console is not attached
+//   - log: when set, the output is written to it as well
+//
+// Returns:
+//   - The exit code of the script, -1 if it did not run or did not exit by itself
+//   - An error if the script could not start, timed out or exited with an unexpected exit code
+func runScript(ctx context.Context, script utils.ScriptEntry, prefix string, log io.Writer) (int, error) {
+	shell, args, err := script.Command()
+	if err != nil {
+		return -1, err
+	}
+
+	cwd, err := script.WorkingDir()
+	if err != nil {
+		return -1, err
+	}
+
+	if Options.DryRun {
+		message := fmt.Sprintf(`run: %s %s`, shell, strings.Join(args, " "))
+		if cwd != "" {
+			message += fmt.Sprintf(` in "%s"`, cwd)
+		}
+		Log.DryRun(message)
+		return -1, nil
+	}
+
+	output := scriptOutput{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+	if prefix != "" {
+		stdout := utils.NewPrefixWriter(os.Stdout, prefix)
+		stderr := utils.NewPrefixWriter(os.Stderr, prefix)
+		defer stdout.Flush()
+		defer stderr.Flush()
+
+		output = scriptOutput{stdout: stdout, stderr: stderr}
+	}
+
+	if log != nil {
+		fmt.Fprintf(log, "> %s\n\n", Log.Redacted(shell+" "+strings.Join(args, " ")))
+
+		redactWriter := utils.NewRedactWriter(log)
+		defer redactWriter.Flush()
+
+		log = &syncWriter{out: redactWriter}
+		output.stdout = io.MultiWriter(output.stdout, log)
+		output.stderr = io.MultiWriter(output.stderr, log)
+	}
+
+	exitCode, err := runCommand(ctx, script, shell, args, cwd, output)
+	if err != nil {
+		return exitCode, err
+	}
+
+	if !script.IsSuccess(exitCode) {
+		return exitCode, fmt.Errorf("exited with the code %d", exitCode)
+	}
+
+	return exitCode, nil
+}
+
+// checkGuards evaluates the "creates", "unless" and "onlyIf" guards of a script, in this order
+//   - In dry run mode, the guard commands are printed instead of being executed and the script is assumed to run
+//
+// Returns:
+//   - The reason to skip the script, empty when the script should run
+//   - An error if a guard could not be evaluated
+func checkGuards(ctx context.Context, script utils.ScriptEntry) (string, error) {
+	creates, err := script.CreatesPath()
+	if err != nil {
+		return "", err
+	}
+
+	if creates != "" && utils.IsPathExists(creates) {
+		return fmt.Sprintf(`the path "%s" already exists`, creates), nil
+	}
+
+	if script.Unless != "" {
+		succeeded, err := runGuard(ctx, script, "unless", script.Unless, false)
+		if err != nil {
+			return "", err
+		}
+		if succeeded {
+			return fmt.Sprintf(`the "unless" command succeeded: %s`, script.Unless), nil
+		}
+	}
+
+	if script.OnlyIf != "" {
+		succeeded, err := runGuard(ctx, script, "onlyIf", script.OnlyIf, true)
+		if err != nil {
+			return "", err
+		}
+		if !succeeded {
+			return fmt.Sprintf(`the "onlyIf" command failed: %s`, script.OnlyIf), nil
+		}
+	}
+
+	return "", nil
+}
+
+// runGuard runs a guard command of a script without showing its output
+//   - dryRunResult: the result assumed in dry run mode
+//
+// Returns: true if the command exited with 0
+func runGuard(ctx context.Context, script utils.ScriptEntry, name, command string, dryRunResult bool) (bool, error) {
+	shell, args, err := script.GuardCommand(command)
+	if err != nil {
+		return false, err
+	}
+
+	cwd, err := script.WorkingDir()
+	if err != nil {
+		return false, err
+	}
+
+	if Options.DryRun {
+		Log.DryRun(fmt.Sprintf(`run the "%s" guard: %s %s`, name, shell, strings.Join(args, " ")))
+		return dryRunResult, nil
+	}
+
+	exitCode, err := runCommand(ctx, script, shell, args, cwd, scriptOutput{})
+	if err != nil {
+		return false, fmt.Errorf(`the "%s" command %w`, name, err)
+	}
+
+	return exitCode == 0, nil
+}
+
+// runCommand runs a command with the working directory, the environment and the timeout of the script
+//
+// Returns:
+//   - The exit code of the command, -1 if it did not start or timed out
+//   - An error if the command could not start or timed out
+func runCommand(ctx context.Context, script utils.ScriptEntry, shell string, args []string, cwd string, output scriptOutput) (int, error) {
+	ctx, cancel := utils.WithStepTimeout(ctx, script.Timeout)
+	defer cancel()
+
+	cmd := utils.CommandContext(ctx, shell, args...)
+
+	// the arguments of cmd are already quoted for it, see ScriptEntry.Command
+	if shell == utils.ShellCmd {
+		utils.SetCommandLine(cmd, shell+" "+strings.Join(args, " "))
+	}
+
+	cmd.Dir = cwd
+	cmd.Env = script.Environ(os.Environ())
+	cmd.Stdin = output.stdin
+	cmd.Stdout = output.stdout
+	cmd.Stderr = output.stderr
+
+	err := cmd.Run()
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return -1, fmt.Errorf("timed out after %s", utils.StepTimeout(script.Timeout))
+	}
+	if ctx.Err() != nil {
+		return -1, utils.NewError(utils.ErrCancelled, "cancelled by the user")
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+
+	return 0, nil
 }
@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/alabsi91/win-tools/commands/utils"
+)
+
+// SchemaArgs holds the flags of the schema command
+type SchemaArgs struct {
+	SavePath *string `arg:"--save-path" placeholder:"[PATH]" help:"Output path for the JSON schema, printed to the console when omitted"`
+}
+
+// schemaCommand implements the "schema" command
+type schemaCommand struct {
+	args SchemaArgs
+}
+
+func (*schemaCommand) Name() string  { return "schema" }
+func (*schemaCommand) Title() string { return "Export config JSON schema" }
+func (*schemaCommand) Help() string {
+	return "Print or save the JSON schema of the YAML configuration file, for validation and auto completion in editors."
+}
+func (c *schemaCommand) Flags() any                { return &c.args }
+func (c *schemaCommand) Run(context.Context) error { return ExportSchema(c.args.SavePath) }
+
+// ExportSchema writes the JSON schema of the config file
+//   - Prints it to the console when no save path is provided
+func ExportSchema(savePath *string) error {
+	schema, err := json.MarshalIndent(utils.ConfigSchema(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to generate the config schema: %w", err)
+	}
+	schema = append(schema, '\n')
+
+	if savePath == nil {
+		fmt.Print(string(schema))
+		return nil
+	}
+
+	if Options.DryRun {
+		Log.DryRun(fmt.Sprintf(`write the config schema to "%s"`, *savePath))
+		return nil
+	}
+
+	if err := os.WriteFile(*savePath, schema, 0o644); err != nil {
+		return fmt.Errorf(`error while writing the config schema at: "%s": %w`, *savePath, err)
+	}
+
+	Log.Success("\n" + fmt.Sprintf(`config schema saved at: "%s"`, *savePath) + "\n")
+
+	return nil
+}
@@ -0,0 +1,240 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alabsi91/win-tools/commands/utils"
+)
+
+// Statuses of the scripts in the run report
+const (
+	statusSucceeded = "succeeded"
+	statusFailed    = "failed"
+	statusSkipped   = "skipped"
+	statusNotRun    = "not run"
+	statusCancelled = "cancelled"
+)
+
+// scriptReport is the report of a run of the scripts, saved as report.json and report.txt in the log directory
+type scriptReport struct {
+	StartedAt  time.Time      `json:"startedAt"`
+	FinishedAt time.Time      `json:"finishedAt"`
+	LogDir     string         `json:"logDir"`
+	Scripts    []scriptRecord `json:"scripts"`
+}
+
+// scriptRecord is the entry of a script in the run report
+type scriptRecord struct {
+	Index    int     `json:"index"`
+	Name     string  `json:"name,omitempty"`
+	ID       string  `json:"id,omitempty"`
+	Status   string  `json:"status"`
+	ExitCode *int    `json:"exitCode,omitempty"`
+	Duration float64 `json:"durationSeconds"`
+	LogPath  string  `json:"logPath,omitempty"`
+
+	// Reason explains why the script was skipped, not run or failed
+	Reason string `json:"reason,omitempty"`
+}
+
+// scriptRun saves the output of the scripts and the run report in a timestamped log directory
+//   - The log directory is created in --logs-dir, "win-tools\logs" in the local app data folder by default
+//   - Nothing is saved in dry run mode or when the log directory cannot be created
+type scriptRun struct {
+	dir    string
+	report scriptReport
+}
+
+// logFileNamePattern matches the characters not allowed in the name of a log file
+var logFileNamePattern = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// newScriptRun creates the log directory of a run of the given scripts
+//   - Logs a warning if the directory cannot be created, the scripts still run without saving their output
+func newScriptRun(scripts []utils.ScriptEntry) *scriptRun {
+	run := &scriptRun{report: scriptReport{StartedAt: time.Now()}}
+
+	for i, script := range scripts {
+		run.report.Scripts = append(run.report.Scripts, scriptRecord{Index: i, Name: Log.Redacted(script.Name), ID: script.ID, Status: statusNotRun})
+	}
+
+	logsDir, err := scriptLogsDir()
+	if err != nil {
+		Log.Warning("\n" + fmt.Sprintf(`The output of the scripts will not be saved: %s`, err.Error()))
+		return run
+	}
+
+	dir := filepath.Join(logsDir, run.report.StartedAt.Format("2006-01-02_15-04-05"))
+
+	if Options.DryRun {
+		Log.DryRun(fmt.Sprintf(`save the output of the scripts and the run report to "%s"`, dir))
+		return run
+	}
+
+	if err := os.MkdirAll(logsDir, os.ModePerm); err != nil {
+		Log.Warning("\n" + fmt.Sprintf(`The output of the scripts will not be saved: %s`, err.Error()))
+		return run
+	}
+
+	// runs started in the same second get their own directory
+	base := dir
+	for n := 2; ; n++ {
+		err := os.Mkdir(dir, os.ModePerm)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			Log.Warning("\n" + fmt.Sprintf(`The output of the scripts will not be saved: %s`, err.Error()))
+			return run
+		}
+		dir = fmt.Sprintf("%s_%d", base, n)
+	}
+
+	run.dir = dir
+	run.report.LogDir = dir
+
+	Log.Info(fmt.Sprintf(`The output of the scripts is saved to "%s"`, dir))
+
+	return run
+}
+
+// scriptLogsDir returns the directory holding the log directories of the runs
+func scriptLogsDir() (string, error) {
+	if Options.LogsDir != nil {
+		return utils.PathExpander.Expand(*Options.LogsDir)
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(cacheDir, "win-tools", "logs"), nil
+}
+
+// createLog creates the log file of a script
+//
+// Returns: the log file, nil when the output is not saved
+func (run *scriptRun) createLog(index int, script utils.ScriptEntry) (*os.File, error) {
+	if run.dir == "" {
+		return nil, nil
+	}
+
+	name := logFileNamePattern.ReplaceAllString(script.Label(index), "-")
+	if name != fmt.Sprint(index) {
+		name = fmt.Sprintf("%d-%s", index, strings.Trim(name, "-"))
+	}
+
+	return os.Create(filepath.Join(run.dir, name+".log"))
+}
+
+// record sets the status of a script in the report
+//   - The reason is redacted, it may hold a guard command or an error message built from a secret
+func (run *scriptRun) record(index int, status, reason string) {
+	run.report.Scripts[index].Status = status
+	run.report.Scripts[index].Reason = Log.Redacted(reason)
+}
+
+// recordOutcome sets the status, the exit code, the duration and the log path of a script that ran in the background
+func (run *scriptRun) recordOutcome(outcome scriptOutcome) {
+	record := &run.report.Scripts[outcome.index]
+
+	record.ExitCode = outcome.exitCode
+	record.Duration = outcome.duration.Round(time.Millisecond).Seconds()
+	record.LogPath = outcome.logPath
+
+	switch {
+	case errors.Is(outcome.err, utils.ErrCancelled):
+		run.record(outcome.index, statusCancelled, outcome.err.Error())
+	case outcome.err != nil:
+		run.record(outcome.index, statusFailed, outcome.err.Error())
+	case outcome.reason != "":
+		run.record(outcome.index, statusSkipped, outcome.reason)
+	default:
+		run.record(outcome.index, statusSucceeded, "")
+	}
+}
+
+// finish saves the report as report.json and report.txt in the log directory
+//   - Logs a warning if the report cannot be saved
+func (run *scriptRun) finish() {
+	run.report.FinishedAt = time.Now()
+
+	if run.dir == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(run.report, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(run.dir, "report.json"), data, 0o644)
+	}
+	if err == nil {
+		err = run.writeSummary(filepath.Join(run.dir, "report.txt"))
+	}
+	if err != nil {
+		Log.Warning("\n" + fmt.Sprintf(`Failed to save the run report: %s`, err.Error()))
+		return
+	}
+
+	Log.Info("\n" + fmt.Sprintf(`The run report is saved to "%s"`, filepath.Join(run.dir, "report.txt")))
+}
+
+// writeSummary writes the human readable report, one line per script
+func (run *scriptRun) writeSummary(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	report := run.report
+	fmt.Fprintf(file, "Started:  %s\n", report.StartedAt.Format(time.DateTime))
+	fmt.Fprintf(file, "Finished: %s (%s)\n", report.FinishedAt.Format(time.DateTime), report.FinishedAt.Sub(report.StartedAt).Round(time.Second))
+	fmt.Fprintf(file, "Logs:     %s\n\n", report.LogDir)
+
+	writer := tabwriter.NewWriter(file, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "SCRIPT\tSTATUS\tEXIT CODE\tDURATION\tLOG / REASON")
+
+	for _, record := range report.Scripts {
+		exitCode := "-"
+		if record.ExitCode != nil {
+			exitCode = fmt.Sprint(*record.ExitCode)
+		}
+
+		details := record.Reason
+		if record.LogPath != "" {
+			details = strings.TrimPrefix(details+", see "+filepath.Base(record.LogPath), ", see ")
+		}
+
+		label := utils.ScriptEntry{Name: record.Name, ID: record.ID}.Label(record.Index)
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%.1fs\t%s\n", label, record.Status, exitCode, record.Duration, details)
+	}
+
+	err = writer.Flush()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// syncWriter serializes the writes of the output and the errors of a script to its log file
+type syncWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.out.Write(p)
+}
@@ -0,0 +1,218 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/alabsi91/win-tools/commands/utils"
+	"github.com/charmbracelet/huh"
+)
+
+// SecretsArgs holds the subcommands of the secrets command
+type SecretsArgs struct {
+	Encrypt *SecretValueArgs `arg:"subcommand:encrypt" help:"Encrypt a value and print it, paste the result in the config file"`
+	Decrypt *SecretValueArgs `arg:"subcommand:decrypt" help:"Decrypt a value of the config file and print it"`
+	Edit    *SecretEditArgs  `arg:"subcommand:edit" help:"Replace an encrypted value of a config file with a new one"`
+}
+
+// SecretValueArgs holds the flags of the secrets encrypt and decrypt subcommands
+type SecretValueArgs struct {
+	Value *string `arg:"positional" placeholder:"VALUE" help:"The value, asked for when omitted"`
+}
+
+// SecretEditArgs holds the flags of the secrets edit subcommand
+type SecretEditArgs struct {
+	ConfigPath *string `arg:"--config" placeholder:"[PATH]" help:"YAML config file path"`
+	Key        *string `arg:"--key" placeholder:"[YAML PATH]" help:"The path of the value to replace, e.g. environmentVariables[0].value"`
+}
+
+// secretsCommand implements the "secrets" command
+type secretsCommand struct {
+	args SecretsArgs
+}
+
+func (*secretsCommand) Name() string  { return "secrets" }
+func (*secretsCommand) Title() string { return "Manage encrypted config values" }
+func (*secretsCommand) Help() string {
+	return "Encrypt, decrypt and edit the encrypted values (enc:... or !secret ...) of a YAML configuration file."
+}
+func (c *secretsCommand) Flags() any { return &c.args }
+func (c *secretsCommand) Run(context.Context) error {
+	switch {
+	case c.args.Encrypt != nil:
+		return EncryptSecret(c.args.Encrypt.Value)
+	case c.args.Decrypt != nil:
+		return DecryptSecret(c.args.Decrypt.Value)
+	case c.args.Edit != nil:
+		return EditSecret(c.args.Edit.ConfigPath, c.args.Edit.Key)
+	}
+
+	return utils.NewError(utils.ErrConfig, "missing subcommand, run `win-tools secrets --help` for more information")
+}
+
+// askForSecretValue prompts the user to enter a value without echoing it
+//   - Returns an error if the user cancels the prompt, or in non-interactive mode
+func askForSecretValue(title string) (string, error) {
+	if Options.NonInteractive {
+		return "", utils.NewError(utils.ErrConfig, "no value provided, pass it as an argument or run in interactive mode")
+	}
+
+	var value string
+
+	validate := func(str string) error {
+		if str == "" {
+			return errors.New("please enter a value")
+		}
+		return nil
+	}
+
+	err := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title(title).
+				EchoMode(huh.EchoModePassword).
+				Validate(validate).
+				Value(&value),
+		),
+	).Run()
+
+	return value, utils.PromptError(err)
+}
+
+// EncryptSecret encrypts a value and prints it
+func EncryptSecret(value *string) error {
+	if value == nil {
+		answer, err := askForSecretValue("Enter the value to encrypt:")
+		if err != nil {
+			return fmt.Errorf("failed to get user input: %w", err)
+		}
+		value = &answer
+	}
+
+	encrypted, err := utils.Secrets.Encrypt(*value)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(encrypted)
+	return nil
+}
+
+// DecryptSecret decrypts a value and prints it
+func DecryptSecret(value *string) error {
+	if value == nil {
+		answer, err := askForSecretValue("Enter the value to decrypt:")
+		if err != nil {
+			return fmt.Errorf("failed to get user input: %w", err)
+		}
+		value = &answer
+	}
+
+	decrypted, err := utils.Secrets.Decrypt(*value)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(decrypted)
+	return nil
+}
+
+// EditSecret replaces an encrypted value of a config file
+//   - The value to replace is selected with key, or asked for when key is nil
+//   - The new value is asked for without echoing it, and never written to disk unencrypted
+func EditSecret(configFilePath *string, key *string) error {
+	path, err := resolveConfigPath(configFilePath)
+	if err != nil {
+		return err
+	}
+
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return utils.NewError(utils.ErrConfig, `failed to read config file: "%s"`, path)
+	}
+
+	locations, err := utils.FindSecrets(dat)
+	if err != nil {
+		return utils.NewError(utils.ErrConfig, "failed to parse config file: \"%s\"\n%s", path, err.Error())
+	}
+
+	if len(locations) == 0 {
+		return utils.NewError(utils.ErrConfig, `the config file does not contain any encrypted values: "%s"`, path)
+	}
+
+	location, err := selectSecret(locations, key)
+	if err != nil {
+		return err
+	}
+
+	// make sure the passphrase is the one used for the current value
+	if _, err := utils.Secrets.Decrypt(location.Value); err != nil {
+		return err
+	}
+
+	value, err := askForSecretValue(fmt.Sprintf("Enter the new value of %s:", location.Path))
+	if err != nil {
+		return fmt.Errorf("failed to get user input: %w", err)
+	}
+
+	encrypted, err := utils.Secrets.Encrypt(value)
+	if err != nil {
+		return err
+	}
+
+	// the salt is random, so the current value is unique in the file
+	dat = bytes.Replace(dat, []byte(location.Value), []byte(encrypted[len(utils.SecretPrefix):]), 1)
+
+	if Options.DryRun {
+		Log.DryRun(fmt.Sprintf(`replace the value of %s in "%s"`, location.Path, path))
+		return nil
+	}
+
+	if err := os.WriteFile(path, dat, 0o644); err != nil {
+		return fmt.Errorf(`error while writing the config file at: "%s": %w`, path, err)
+	}
+
+	Log.Success("\n" + fmt.Sprintf(`the value of %s was replaced in "%s"`, location.Path, path) + "\n")
+
+	return nil
+}
+
+// selectSecret finds the encrypted value to edit
+//   - Uses the key when provided, otherwise prompts the user to select one
+//   - Returns an error if the key is unknown or the user cancels the prompt
+func selectSecret(locations []utils.SecretLocation, key *string) (utils.SecretLocation, error) {
+	if key != nil {
+		for _, location := range locations {
+			if location.Path == *key {
+				return location, nil
+			}
+		}
+
+		return utils.SecretLocation{}, utils.NewError(utils.ErrConfig, `no encrypted value found at "%s"`, *key)
+	}
+
+	if Options.NonInteractive {
+		return utils.SecretLocation{}, utils.NewError(utils.ErrConfig, "no value selected, use --key or run in interactive mode")
+	}
+
+	var selected int
+
+	options := make([]huh.Option[int], len(locations))
+	for i, location := range locations {
+		options[i] = huh.NewOption(fmt.Sprintf("%s (line %d)", location.Path, location.Line), i)
+	}
+
+	err := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[int]().
+				Title("Which value would you like to replace?").
+				Options(options...).
+				Value(&selected),
+		),
+	).Run()
+
+	return locations[selected], utils.PromptError(err)
+}
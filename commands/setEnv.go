@@ -1,58 +1,85 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/alabsi91/win-tools/commands/utils"
 )
 
-func SetEnvs(configFilePath *string) {
-	// no config file path provided, ask for it
-	if configFilePath == nil {
-		answer, err := utils.AskForConfigFilePath()
-		if err != nil {
-			Log.Error("failed to get user input\n")
-			return
-		}
-
-		configFilePath = &answer
-	}
-
-	// config file path provided does not exist, ask for a new one
-	if !utils.IsPathExists(*configFilePath) {
-		Log.Error("\nfile not found. Please enter a valid path\n")
+// setEnvsCommand implements the "set-envs" command
+type setEnvsCommand struct {
+	args ConfigPathArg
+}
 
-		answer, err := utils.AskForConfigFilePath()
-		if err != nil {
-			Log.Error("failed to get user input\n")
-			return
-		}
+func (*setEnvsCommand) Name() string  { return "set-envs" }
+func (*setEnvsCommand) Title() string { return "Set environment variables" }
+func (*setEnvsCommand) Help() string {
+	return "Set environment variables as defined in a YAML configuration file."
+}
+func (c *setEnvsCommand) Flags() any                    { return &c.args }
+func (c *setEnvsCommand) Run(ctx context.Context) error { return SetEnvs(ctx, c.args.ConfigPath) }
 
-		configFilePath = &answer
+func SetEnvs(ctx context.Context, configFilePath *string) error {
+	yamlData, err := loadConfig(configFilePath)
+	if err != nil {
+		return err
 	}
 
-	yamlData := utils.ReadConfigFile(*configFilePath)
+	return sectionError(ctx, setEnvs(ctx, yamlData))
+}
+
+// setEnvs sets the environment variables of the given config
+func setEnvs(ctx context.Context, yamlData utils.ConfigYamlType) sectionResult {
+	result := sectionResult{Name: "environmentVariables"}
 
 	// envs is empty, exit
 	if len(yamlData.EnvironmentVariables) == 0 {
-		Log.Error("\nthe YAML file does not contain any environment variables to set\n")
-		return
+		result.abort(utils.NewError(utils.ErrConfig, "the YAML file does not contain any environment variables to set"))
+		return result
 	}
 
 	// has admin privileges
-	isAdmin := Powershell.IsAdmin()
+	isAdmin := Powershell.IsAdmin(ctx)
 	if !isAdmin {
 		Log.Warning("\nEnvironment variables with \"Machine\" scope require admin privileges\n")
 	}
 
 	// loop through the envs
-	for _, env := range yamlData.EnvironmentVariables {
+	for i, env := range yamlData.EnvironmentVariables {
+		if result.cancelled(ctx, len(yamlData.EnvironmentVariables)-i) {
+			return result
+		}
+
+		if !result.checkWhen(ctx, fmt.Sprintf(`"%s" (%s)`, env.Key, env.Scope), env.When, yamlData) {
+			continue
+		}
+
+		value, err := utils.PathExpander.Expand(env.Value)
+		if err != nil {
+			Log.Error("\n"+err.Error(), "\n")
+			result.Failed++
+			continue
+		}
+		env.Value = value
+
 		Log.Info(fmt.Sprintf(`Setting environment variable: %s="%s"`, env.Key, env.Value))
-		err := Powershell.SetEnvVariable(env.Key, env.Value, env.Scope)
+		err = Powershell.SetEnvVariable(ctx, env.Key, env.Value, env.Scope)
 		if err != nil {
 			Log.Error("\n"+err.Error(), "\n")
+			result.Failed++
+			continue
 		}
+
+		result.Succeeded++
+	}
+
+	if result.Failed > 0 {
+		Log.Warning("\nFinished setting environment variables with errors\n")
+		return result
 	}
 
 	Log.Success("\nEnvironment variables set successfully\n")
+
+	return result
 }
@@ -1,17 +1,33 @@
 package commands
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
 	"path/filepath"
 
 	"github.com/alabsi91/win-tools/commands/utils"
 	"github.com/charmbracelet/huh"
 )
 
+// setRegistryCommand implements the "set-registry" command
+type setRegistryCommand struct{}
+
+func (*setRegistryCommand) Name() string  { return "set-registry" }
+func (*setRegistryCommand) Title() string { return "Set registry" }
+func (*setRegistryCommand) Help() string {
+	return "Select multiple predefined registry keys to set."
+}
+func (*setRegistryCommand) Flags() any                    { return &NoArgs{} }
+func (*setRegistryCommand) Run(ctx context.Context) error { return SetRegistry(ctx) }
+
 // askToSelectRegistry prompts the user to select the registry they want to modify
+//   - Uses the "registry" answer from the answers file when provided
 //   - Returns an error if the user cancels the prompt
 func askToSelectRegistry() ([]string, error) {
+	if answer, found, err := utils.AnswerForList("registry", utils.Answers.Registry); found || err != nil {
+		return answer, err
+	}
+
 	var selected []string
 
 	var other []string
@@ -141,39 +157,49 @@ func askToSelectRegistry() ([]string, error) {
 	selected = append(selected, taskbar...)
 	selected = append(selected, explorer...)
 
-	return selected, err
+	return selected, utils.PromptError(err)
 }
 
-func SetRegistry() {
+func SetRegistry(ctx context.Context) error {
 	selected, err := askToSelectRegistry()
 
 	if err != nil {
-		Log.Error("\nfailed to get user selection\n")
-		return
+		return fmt.Errorf("failed to get user selection: %w", err)
 	}
 
 	if len(selected) == 0 {
 		Log.Warning("\nNo registry selected\n")
-		return
+		return nil
 	}
 
+	failed := 0
+
 	println("")
 	for _, registry := range selected {
+		if ctx.Err() != nil {
+			return utils.NewError(utils.ErrCancelled, "cancelled by the user")
+		}
+
 		Log.Info(fmt.Sprintf(`Setting registry: "%s"`, registry))
 
 		regPath := filepath.Join(AssetsPath, "RegFiles", registry)
 
 		if !utils.IsPathExists(regPath) {
 			Log.Error("\ncould not find registry file: ", regPath, "\n")
+			failed++
+			continue
+		}
+
+		if Options.DryRun {
+			Log.DryRun(fmt.Sprintf(`import the registry file "%s"`, regPath))
 			continue
 		}
 
-		cmd := exec.Command("cmd", "/C", "regedit.exe", "/s", regPath)
+		cmd := utils.CommandContext(ctx, "cmd", "/C", "regedit.exe", "/s", regPath)
 
 		_, err := cmd.Output()
 		if err != nil {
-			Log.Error("failed to set registry")
-			return
+			return fmt.Errorf(`failed to set registry "%s": %w`, registry, err)
 		}
 	}
 
@@ -181,5 +207,11 @@ func SetRegistry() {
 	Log.Info("\nRestarting Windows Explorer...")
 	Powershell.RestartWinExplorer()
 
+	if failed > 0 {
+		return utils.NewError(utils.ErrPartialFailure, `%d of %d registry files could not be found`, failed, len(selected))
+	}
+
 	Log.Success("\nDone!\n")
+
+	return nil
 }
@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/alabsi91/win-tools/commands/utils"
+	"github.com/goccy/go-yaml"
+)
+
+// ShowConfigArgs holds the flags of the show-config command
+type ShowConfigArgs struct {
+	ConfigPath *string `arg:"--config" placeholder:"[PATH]" help:"YAML config file path"`
+	Explain    bool    `arg:"--explain" help:"Show the file each entry came from instead of the merged config"`
+}
+
+// showConfigCommand implements the "show-config" command
+type showConfigCommand struct {
+	args ShowConfigArgs
+}
+
+func (*showConfigCommand) Name() string  { return "show-config" }
+func (*showConfigCommand) Title() string { return "Show resolved config" }
+func (*showConfigCommand) Help() string {
+	return "Print a YAML configuration file after merging all the files it includes and the profiles selected for this machine, use --profile to print the config of another profile."
+}
+func (c *showConfigCommand) Flags() any { return &c.args }
+func (c *showConfigCommand) Run(context.Context) error {
+	return ShowConfig(c.args.ConfigPath, c.args.Explain)
+}
+
+// explainSections is the order in which the sections are printed by the --explain flag
+var explainSections = []string{"vars", "backup.target", "backup.paths", "environmentVariables", "packages", "scripts", "apply.order", "apply.onError"}
+
+// ShowConfig prints the resolved config
+//   - The active profiles are printed first as a YAML comment
+//   - When explain is true, prints every entry with the file and profile it came from
+func ShowConfig(configFilePath *string, explain bool) error {
+	path, err := resolveConfigPath(configFilePath)
+	if err != nil {
+		return err
+	}
+
+	yamlData, err := utils.ReadConfigFile(path, false)
+	if err != nil {
+		return err
+	}
+
+	activeProfiles := "none"
+	if len(yamlData.ActiveProfiles) > 0 {
+		activeProfiles = strings.Join(yamlData.ActiveProfiles, ", ")
+	}
+	fmt.Printf("# profiles: %s\n", activeProfiles)
+
+	if !explain {
+		out, err := yaml.Marshal(yamlData)
+		if err != nil {
+			return fmt.Errorf("failed to marshal the resolved config: %w", err)
+		}
+
+		fmt.Print(string(out))
+		return nil
+	}
+
+	baseDir := filepath.Dir(path)
+	if abs, err := filepath.Abs(path); err == nil {
+		baseDir = filepath.Dir(abs)
+	}
+
+	for _, section := range explainSections {
+		first := true
+		for _, origin := range yamlData.Origins {
+			if origin.Section != section {
+				continue
+			}
+
+			if first {
+				fmt.Printf("%s:\n", section)
+				first = false
+			}
+
+			file := origin.File
+			if rel, err := filepath.Rel(baseDir, file); err == nil && !strings.HasPrefix(rel, "..") {
+				file = rel
+			}
+			if origin.Profile != "" {
+				file += fmt.Sprintf(` (profile "%s")`, origin.Profile)
+			}
+
+			fmt.Printf("  %-50s # %s\n", strings.ReplaceAll(origin.Entry, "\n", " "), file)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alabsi91/win-tools/commands/utils"
+)
+
+// sectionResult holds the outcome of running a single config section
+type sectionResult struct {
+	Name      string
+	Succeeded int
+	Failed    int
+	Skipped   int
+
+	// Err is set when the section could not run to completion
+	Err error
+
+	// Reason explains why the section was skipped
+	Reason string
+
+	// SkippedEntries explains why each of the skipped entries was skipped
+	SkippedEntries []string
+
+	// RebootRequired is set when one of the entries needs a reboot to take effect
+	RebootRequired bool
+}
+
+// ok reports whether the section finished without any failures
+func (r sectionResult) ok() bool {
+	return r.Err == nil && r.Failed == 0
+}
+
+// abort marks the section as aborted with the given error
+func (r *sectionResult) abort(err error) {
+	r.Err = err
+}
+
+// skip counts an entry as skipped, the reason is shown in the summary
+func (r *sectionResult) skip(entry, reason string) {
+	r.Skipped++
+	r.SkippedEntries = append(r.SkippedEntries, fmt.Sprintf(`%s: %s`, entry, reason))
+}
+
+// checkWhen evaluates the "when" condition of an entry, see utils.Conditions
+//   - An entry whose condition is false is counted as skipped
+//   - An entry whose condition cannot be evaluated is counted as failed
+//
+// Returns: true if the entry should be applied
+func (r *sectionResult) checkWhen(ctx context.Context, entry, when string, yamlData utils.ConfigYamlType) bool {
+	ok, err := utils.Conditions.Check(ctx, when, yamlData.ActiveProfiles)
+	if err != nil {
+		Log.Error("\n"+err.Error(), "\n")
+		r.Failed++
+		return false
+	}
+
+	if !ok {
+		Log.Info(fmt.Sprintf(`Skipping %s, the condition "%s" is false`, entry, when))
+		r.skip(entry, fmt.Sprintf(`the condition "%s" is false`, when))
+		return false
+	}
+
+	return true
+}
+
+// cancelled checks whether the command was cancelled before the next entry of the section
+//   - The entries not applied yet are counted as skipped and the section is aborted
+//
+// Returns: true if the section should stop
+func (r *sectionResult) cancelled(ctx context.Context, remaining int) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+
+	r.Skipped += remaining
+	r.abort(utils.NewError(utils.ErrCancelled, `cancelled by the user, entries not applied: %d`, remaining))
+
+	return true
+}
+
+// err converts the result into the error returned by the command
+//
+// Returns: nil if the section finished without any failures and no reboot is required
+func (r sectionResult) err() error {
+	if r.Err != nil {
+		return r.Err
+	}
+
+	if r.Failed > 0 {
+		total := r.Succeeded + r.Failed + r.Skipped
+		return utils.NewError(utils.ErrPartialFailure, `%s: %d of %d entries failed`, r.Name, r.Failed, total)
+	}
+
+	if r.RebootRequired {
+		return utils.NewError(utils.ErrRebootRequired, `%s: a reboot is required to complete the changes`, r.Name)
+	}
+
+	return nil
+}
+
+// printSummary prints one line per section followed by the overall result
+func printSummary(results []sectionResult) {
+	Log.Info("\nSummary\n")
+
+	allOk := true
+	for _, r := range results {
+		counts := fmt.Sprintf(`succeeded: %d, failed: %d, skipped: %d`, r.Succeeded, r.Failed, r.Skipped)
+
+		switch {
+		case r.Err != nil:
+			allOk = false
+			Log.Error(fmt.Sprintf(`%-22s %s (%s)`, r.Name, counts, r.Err.Error()))
+		case r.Failed > 0:
+			allOk = false
+			Log.Error(fmt.Sprintf(`%-22s %s`, r.Name, counts))
+		case r.Reason != "":
+			Log.Warning(fmt.Sprintf(`%-22s %s (%s)`, r.Name, counts, r.Reason))
+		case r.RebootRequired:
+			Log.Warning(fmt.Sprintf(`%-22s %s (reboot required)`, r.Name, counts))
+		default:
+			Log.Success(fmt.Sprintf(`%-22s %s`, r.Name, counts))
+		}
+
+		for _, entry := range r.SkippedEntries {
+			Log.Info(fmt.Sprintf(`%-22s   skipped %s`, "", entry))
+		}
+	}
+
+	if allOk {
+		Log.Success("\nAll sections completed successfully\n")
+	}
+}
+
+// sectionError converts the result of a section run on its own into the error returned by the command
+//   - Prints the summary of the section when it was cancelled, to show what was applied before
+func sectionError(ctx context.Context, result sectionResult) error {
+	if ctx.Err() != nil {
+		printSummary([]sectionResult{result})
+	}
+
+	return result.err()
+}
@@ -1,15 +1,34 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 
+	"github.com/alabsi91/win-tools/commands/utils"
+	"github.com/alabsi91/win-tools/commands/utils/shellquote"
 	"github.com/charmbracelet/huh"
 )
 
+// uninstallBloatCommand implements the "uninstall-bloat" command
+type uninstallBloatCommand struct{}
+
+func (*uninstallBloatCommand) Name() string  { return "uninstall-bloat" }
+func (*uninstallBloatCommand) Title() string { return "Uninstall bloatware" }
+func (*uninstallBloatCommand) Help() string {
+	return "Select multiple predefined Windows apps to uninstall."
+}
+func (*uninstallBloatCommand) Flags() any                    { return &NoArgs{} }
+func (*uninstallBloatCommand) Run(ctx context.Context) error { return UninstallBloat(ctx) }
+
 // askToSelectBloatware prompts the user to select the bloatware they want to uninstall
+//   - Uses the "bloatware" answer from the answers file when provided
 //   - Returns an error if the user cancels the prompt
 func askToSelectBloatware() ([]string, error) {
+	if answer, found, err := utils.AnswerForList("bloatware", utils.Answers.Bloatware); found || err != nil {
+		return answer, err
+	}
+
 	var selected []string
 
 	println("")
@@ -76,11 +95,16 @@ func askToSelectBloatware() ([]string, error) {
 		),
 	).Run()
 
-	return selected, err
+	return selected, utils.PromptError(err)
 }
 
 // confirmToUninstallEdge prompts the user to confirm if they want to uninstall Edge
+//   - Uses the "uninstallEdge" answer from the answers file or the "--yes" flag when provided
 func confirmToUninstallEdge() (bool, error) {
+	if answer, found, err := utils.AnswerForConfirm("uninstallEdge", utils.Answers.UninstallEdge); found || err != nil {
+		return answer, err
+	}
+
 	var answer bool = false
 
 	err := huh.NewForm(
@@ -93,34 +117,30 @@ func confirmToUninstallEdge() (bool, error) {
 		),
 	).Run()
 
-	return answer, err
+	return answer, utils.PromptError(err)
 }
 
-func UninstallBloat() {
+func UninstallBloat(ctx context.Context) error {
 	// has admin privileges
-	isAdmin := Powershell.IsAdmin()
-
-	if !isAdmin {
-		Log.Error("\nyou need admin privileges to run this command\n")
-		Log.Info("Please run this command from an elevated powershell session\n")
-		return
+	if err := requireAdmin(ctx, "you need admin privileges to run this command"); err != nil {
+		return err
 	}
 
 	// ask user to select bloatware
 	selected, err := askToSelectBloatware()
 
 	if err != nil {
-		Log.Error("failed to get user selection\n")
-		return
+		return fmt.Errorf("failed to get user selection: %w", err)
 	}
 
 	if len(selected) == 0 {
 		Log.Warning("\nNo bloatware selected\n")
-		return
+		return nil
 	}
 
 	// loop through selected options
 	println("")
+	failed := 0
 	for _, option := range selected {
 		Log.Info(fmt.Sprintf(`Uninstalling "%s" ...`, option))
 
@@ -130,8 +150,7 @@ func UninstallBloat() {
 
 			confirm, err := confirmToUninstallEdge()
 			if err != nil {
-				Log.Error("\nfailed to get user selection\n")
-				continue
+				return fmt.Errorf("failed to get user selection: %w", err)
 			}
 
 			if !confirm {
@@ -141,9 +160,10 @@ func UninstallBloat() {
 
 			removeEdgeExePath := filepath.Join(AssetsPath, "RemoveEdgeOnly.exe")
 
-			err = Powershell.RunPathThroughCmd(fmt.Sprintf(`&"%s"`, removeEdgeExePath))
+			err = Powershell.RunPathThroughCmd(ctx, "& "+shellquote.PowerShell(removeEdgeExePath))
 			if err != nil {
-				Log.Fatal("\n"+err.Error(), "\n")
+				Log.Error("\n"+err.Error(), "\n")
+				failed++
 			}
 
 			continue
@@ -154,23 +174,32 @@ func UninstallBloat() {
 			removeOneDriveScriptPath := filepath.Join(AssetsPath, "uninstallOneDrive.ps1")
 
 			err := Powershell.RunPathThroughCmd(
+				ctx,
 				"Set-ExecutionPolicy -ExecutionPolicy Bypass -Scope Process -Force;",
-				fmt.Sprintf(`&"%s"`, removeOneDriveScriptPath),
+				"& "+shellquote.PowerShell(removeOneDriveScriptPath),
 			)
 
 			if err != nil {
-				Log.Fatal("\n"+err.Error(), "\n")
+				Log.Error("\n"+err.Error(), "\n")
+				failed++
 			}
 
 			continue
 		}
 
 		// remove app
-		err := Powershell.RemoveWinPackage(option)
+		err := Powershell.RemoveWinPackage(ctx, option)
 		if err != nil {
 			Log.Error("\n"+err.Error(), "\n")
+			failed++
 		}
 	}
 
+	if failed > 0 {
+		return utils.NewError(utils.ErrPartialFailure, `failed to uninstall %d of %d apps`, failed, len(selected))
+	}
+
 	Log.Success("\nUninstall complete\n")
+
+	return nil
 }
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"os"
+
+	"github.com/goccy/go-yaml"
+)
+
+// AnswersYamlType defines the structure of the answers YAML file
+//   - Every field answers one interactive prompt
+//   - A nil field means that no answer was provided for the prompt
+type AnswersYamlType struct {
+	Command           *string  `yaml:"command"`
+	ConfigPath        *string  `yaml:"configPath"`
+	TemplatePath      *string  `yaml:"templatePath"`
+	Username          *string  `yaml:"username"`
+	Registry          []string `yaml:"registry"`
+	Bloatware         []string `yaml:"bloatware"`
+	UninstallEdge     *bool    `yaml:"uninstallEdge"`
+	InstallChocolatey *bool    `yaml:"installChocolatey"`
+}
+
+// Answers holds the answers of the current session
+var Answers = &AnswersYamlType{}
+
+// ReadAnswersFile reads the answers file of type YAML into Answers
+//   - Unknown keys are reported as errors to catch typos early
+//
+// Returns: error if any
+func ReadAnswersFile(path string) error {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return NewError(ErrConfig, `failed to read answers file: "%s"`, path)
+	}
+
+	if err := yaml.UnmarshalWithOptions(dat, Answers, yaml.DisallowUnknownField()); err != nil {
+		return NewError(ErrConfig, "failed to unmarshal answers file: \"%s\"\n%s", path, yaml.FormatError(err, false, true))
+	}
+
+	return nil
+}
+
+// AnswerFor looks up the answer of a prompt
+//   - Returns the answer and true if it was provided in the answers file
+//   - Returns false if the user should be prompted instead
+//   - Returns an error in non-interactive mode when no answer was provided
+func AnswerFor[T any](key string, answer *T) (T, bool, error) {
+	var zero T
+
+	if answer != nil {
+		return *answer, true, nil
+	}
+
+	if Options.NonInteractive {
+		return zero, false, NewError(ErrConfig, `no answer provided for "%s", add it to the answers file or run in interactive mode`, key)
+	}
+
+	return zero, false, nil
+}
+
+// AnswerForList is the same as AnswerFor but for prompts with multiple selections
+func AnswerForList(key string, answer []string) ([]string, bool, error) {
+	if answer != nil {
+		return answer, true, nil
+	}
+
+	return AnswerFor[[]string](key, nil)
+}
+
+// AnswerForConfirm is the same as AnswerFor but for yes/no prompts
+//   - When the "--yes" flag is set, missing answers are treated as "yes"
+func AnswerForConfirm(key string, answer *bool) (bool, bool, error) {
+	if answer == nil && Options.AssumeYes {
+		return true, true, nil
+	}
+
+	return AnswerFor(key, answer)
+}
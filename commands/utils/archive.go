@@ -0,0 +1,628 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Formats of the backup, see BackupConfig.Format
+const (
+	BackupFormatFolder = "folder"
+	BackupFormatZip    = "zip"
+	BackupFormatTarGz  = "tar.gz"
+)
+
+// ArchiveExtension returns the file extension of a backup format, empty for the folder format
+func ArchiveExtension(format string) string {
+	switch format {
+	case BackupFormatZip:
+		return ".zip"
+	case BackupFormatTarGz:
+		return ".tar.gz"
+	}
+
+	return ""
+}
+
+// archiveFormatOf returns the backup format of an archive file from its extension
+//
+// Returns: an empty string if the file is not a backup archive
+func archiveFormatOf(name string) string {
+	for _, format := range []string{BackupFormatZip, BackupFormatTarGz} {
+		if strings.HasSuffix(strings.ToLower(name), ArchiveExtension(format)) {
+			return format
+		}
+	}
+
+	return ""
+}
+
+// IsBackupArchive reports whether the path is a backup archive file rather than a directory
+func IsBackupArchive(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && archiveFormatOf(path) != ""
+}
+
+// archiveEntryWriter writes the files of a backup archive, one implementation per format
+type archiveEntryWriter interface {
+	// create starts a new file entry, its content is written to the returned writer
+	create(name string, size int64, modTime time.Time) (io.Writer, error)
+	Close() error
+}
+
+// BackupArchive streams the backup paths into a single archive file
+//   - The archive is written to a temporary file, renamed once it is closed, an aborted backup keeps the previous archive
+//   - The manifest, with the original path of each backup path, is read without decompressing the files, see LoadArchiveManifest:
+//     the first entry of a tar.gz archive, the files are compressed to a second temporary file until it is known,
+//     and the last entry of a zip archive, found from its central directory
+type BackupArchive struct {
+	path     string
+	file     *os.File
+	entries  *os.File // the compressed files of a tar.gz archive, written after the manifest by Close
+	writer   archiveEntryWriter
+	manifest *BackupManifest
+}
+
+// CreateBackupArchive creates the archive file of a backup
+//   - In dry run mode, nothing is created, the files are only counted
+func CreateBackupArchive(path, format string) (*BackupArchive, error) {
+	archive := &BackupArchive{path: path, manifest: newBackupManifest()}
+
+	if Options.DryRun {
+		Log.DryRun(fmt.Sprintf(`create the archive "%s"`, path))
+		return archive, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, fmt.Errorf(`failed to create the folder of the archive "%s": %w`, path, err)
+	}
+
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, fmt.Errorf(`failed to create the archive "%s": %w`, path, err)
+	}
+
+	archive.file = file
+	switch format {
+	case BackupFormatZip:
+		archive.writer = &zipEntryWriter{zip.NewWriter(file)}
+	default:
+		entries, err := os.Create(path + ".entries.tmp")
+		if err != nil {
+			file.Close()
+			os.Remove(path + ".tmp")
+			return nil, fmt.Errorf(`failed to create the archive "%s": %w`, path, err)
+		}
+
+		archive.entries = entries
+		archive.writer = newTarEntryWriter(entries)
+	}
+
+	return archive, nil
+}
+
+// SetBackupPaths records every backup path of the archive, see BackupManifest.SetBackupPaths
+func (a *BackupArchive) SetBackupPaths(sources []string) {
+	a.manifest.SetBackupPaths(sources)
+}
+
+// SetEntry records the path of the config file a backup path was expanded from, see BackupManifest.SetEntry
+func (a *BackupArchive) SetEntry(source, entry string) {
+	a.manifest.SetEntry(source, entry)
+}
+
+// Add writes a file or a directory to the archive, under its root, see backupRoot
+//   - Only the files selected by the filter are written, see BackupFilter
+//   - The files under another backup path nested in this one are left to it, see SetBackupPaths
+//   - An error on a file does not stop the others, all errors are returned at the end
+//
+// Returns: the counts of the written files, and an error of kind ErrCancelled if ctx is cancelled
+func (a *BackupArchive) Add(ctx context.Context, source string, filter *BackupFilter) (BackupStats, error) {
+	var stats BackupStats
+
+	source = absoluteSource(source)
+	root := backupRoot(source)
+
+	files, err := listBackupFiles(source, root, filter)
+	if err != nil {
+		return stats, err
+	}
+	files = slices.DeleteFunc(files, func(file backupFile) bool { return !a.manifest.owns(root, file.key) })
+
+	a.manifest.setPath(root, source)
+
+	var errs []error
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return stats, NewError(ErrCancelled, "the backup of \"%s\" was cancelled", source)
+		}
+
+		if err := a.addFile(file); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		stats.Copied++
+		stats.CopiedBytes += file.info.Size()
+	}
+
+	return stats, errors.Join(errs...)
+}
+
+// addFile writes a file to the archive and records it in the manifest
+func (a *BackupArchive) addFile(file backupFile) error {
+	if a.writer == nil {
+		return nil
+	}
+
+	source, err := os.Open(file.source)
+	if err != nil {
+		return fmt.Errorf("failed to open \"%s\": %w", file.source, err)
+	}
+	defer source.Close()
+
+	entry, err := a.writer.create(file.key, file.info.Size(), file.info.ModTime())
+	if err != nil {
+		return fmt.Errorf("failed to add \"%s\" to the archive: %w", file.source, err)
+	}
+
+	// a file changing while it is read no longer matches the size written in a tar header
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(entry, hash), io.LimitReader(source, file.info.Size()))
+	if err == nil && written != file.info.Size() {
+		err = fmt.Errorf("the file changed while it was read")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add \"%s\" to the archive: %w", file.source, err)
+	}
+
+	a.manifest.Files[file.key] = ManifestFile{Size: file.info.Size(), ModTime: file.info.ModTime(), SHA256: hex.EncodeToString(hash.Sum(nil))}
+
+	return nil
+}
+
+// Close writes the manifest and finishes the archive, replacing the previous archive with the same path
+func (a *BackupArchive) Close() error {
+	if a.writer == nil {
+		return nil
+	}
+
+	a.manifest.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(a.manifest, "", "  ")
+	if err == nil && a.entries == nil {
+		err = writeArchiveEntry(a.writer, BackupManifestName, data, a.manifest.UpdatedAt)
+	}
+	if err == nil {
+		err = a.writer.Close()
+	}
+	if err == nil && a.entries != nil {
+		err = a.writeTarManifest(data)
+	}
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	a.removeEntries()
+	if err == nil {
+		err = os.Rename(a.path+".tmp", a.path)
+	}
+
+	if err != nil {
+		os.Remove(a.path + ".tmp")
+		return fmt.Errorf(`failed to write the archive "%s": %w`, a.path, err)
+	}
+
+	return nil
+}
+
+// writeTarManifest writes the manifest to a tar.gz archive, followed by its compressed files
+//   - The manifest is a gzip member of its own, the readers of gzip read the members one after the other as a single tar stream
+func (a *BackupArchive) writeTarManifest(manifest []byte) error {
+	writer := newTarEntryWriter(a.file)
+	if err := writeArchiveEntry(writer, BackupManifestName, manifest, a.manifest.UpdatedAt); err != nil {
+		return err
+	}
+
+	// the end of the tar stream is written after the files
+	if err := writer.tar.Flush(); err != nil {
+		return err
+	}
+	if err := writer.gzip.Close(); err != nil {
+		return err
+	}
+
+	if _, err := a.entries.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.Copy(a.file, a.entries)
+
+	return err
+}
+
+// removeEntries deletes the temporary file of the compressed files of a tar.gz archive
+func (a *BackupArchive) removeEntries() {
+	if a.entries == nil {
+		return
+	}
+
+	a.entries.Close()
+	os.Remove(a.path + ".entries.tmp")
+}
+
+// writeArchiveEntry writes a file entry with the given content
+func writeArchiveEntry(writer archiveEntryWriter, name string, content []byte, modTime time.Time) error {
+	entry, err := writer.create(name, int64(len(content)), modTime)
+	if err != nil {
+		return err
+	}
+
+	_, err = entry.Write(content)
+	return err
+}
+
+// Abort deletes the unfinished archive, the previous archive with the same path is kept
+func (a *BackupArchive) Abort() {
+	if a.writer == nil {
+		return
+	}
+
+	a.writer.Close()
+	a.file.Close()
+	a.removeEntries()
+	os.Remove(a.path + ".tmp")
+}
+
+// zipEntryWriter writes the entries of a zip archive
+type zipEntryWriter struct {
+	zip *zip.Writer
+}
+
+func (w *zipEntryWriter) create(name string, size int64, modTime time.Time) (io.Writer, error) {
+	return w.zip.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime, UncompressedSize64: uint64(size)})
+}
+
+func (w *zipEntryWriter) Close() error {
+	return w.zip.Close()
+}
+
+// tarEntryWriter writes the entries of a gzip compressed tar archive
+type tarEntryWriter struct {
+	gzip *gzip.Writer
+	tar  *tar.Writer
+}
+
+// newTarEntryWriter creates a writer of the gzip compressed tar entries written to out
+func newTarEntryWriter(out io.Writer) *tarEntryWriter {
+	gzipWriter := gzip.NewWriter(out)
+	return &tarEntryWriter{gzip: gzipWriter, tar: tar.NewWriter(gzipWriter)}
+}
+
+func (w *tarEntryWriter) create(name string, size int64, modTime time.Time) (io.Writer, error) {
+	header := &tar.Header{Typeflag: tar.TypeReg, Name: name, Size: size, Mode: 0o644, ModTime: modTime, Format: tar.FormatPAX}
+	if err := w.tar.WriteHeader(header); err != nil {
+		return nil, err
+	}
+
+	return w.tar, nil
+}
+
+func (w *tarEntryWriter) Close() error {
+	if err := w.tar.Close(); err != nil {
+		return err
+	}
+
+	return w.gzip.Close()
+}
+
+// walkArchive calls fn with every file entry of a backup archive, in the order they were written
+//   - fn stops the walk by returning errStopWalk
+func walkArchive(archivePath string, fn func(name string, modTime time.Time, content io.Reader) error) error {
+	switch archiveFormatOf(archivePath) {
+	case BackupFormatZip:
+		reader, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return fmt.Errorf(`failed to open the archive "%s": %w`, archivePath, err)
+		}
+		defer reader.Close()
+
+		for _, file := range reader.File {
+			if file.FileInfo().IsDir() {
+				continue
+			}
+
+			content, err := file.Open()
+			if err != nil {
+				return fmt.Errorf(`failed to read "%s" from the archive: %w`, file.Name, err)
+			}
+
+			err = fn(file.Name, file.Modified, content)
+			content.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+	case BackupFormatTarGz:
+		file, err := os.Open(archivePath)
+		if err != nil {
+			return fmt.Errorf(`failed to open the archive "%s": %w`, archivePath, err)
+		}
+		defer file.Close()
+
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf(`failed to open the archive "%s": %w`, archivePath, err)
+		}
+
+		reader := tar.NewReader(gzipReader)
+		for {
+			header, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf(`failed to read the archive "%s": %w`, archivePath, err)
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+
+			if err := fn(header.Name, header.ModTime, reader); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf(`"%s" is not a backup archive`, archivePath)
+	}
+
+	return nil
+}
+
+// errStopWalk stops walkArchive without an error
+var errStopWalk = errors.New("stop walking the archive")
+
+// LoadArchiveManifest reads the manifest stored in a backup archive, see BackupArchive
+//   - The manifest of a zip archive is found from its central directory, the one of a tar.gz archive is its first entry,
+//     the files of the archive are not decompressed
+func LoadArchiveManifest(archivePath string) (*BackupManifest, error) {
+	var manifest *BackupManifest
+
+	readManifest := func(content io.Reader) error {
+		manifest = newBackupManifest()
+		if err := json.NewDecoder(content).Decode(manifest); err != nil {
+			return fmt.Errorf("failed to read the backup manifest: %w", err)
+		}
+		return nil
+	}
+
+	var err error
+	if archiveFormatOf(archivePath) == BackupFormatZip {
+		err = readZipEntry(archivePath, BackupManifestName, readManifest)
+	} else {
+		err = walkArchive(archivePath, func(name string, _ time.Time, content io.Reader) error {
+			if name != BackupManifestName {
+				return nil
+			}
+			if err := readManifest(content); err != nil {
+				return err
+			}
+			return errStopWalk
+		})
+	}
+	if err != nil && !errors.Is(err, errStopWalk) {
+		return nil, err
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf(`the archive "%s" has no backup manifest`, archivePath)
+	}
+
+	return manifest, nil
+}
+
+// readZipEntry calls fn with the content of the last file entry of a zip archive with the given name, if any
+func readZipEntry(archivePath, name string, fn func(content io.Reader) error) error {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf(`failed to open the archive "%s": %w`, archivePath, err)
+	}
+	defer reader.Close()
+
+	for i := len(reader.File) - 1; i >= 0; i-- {
+		file := reader.File[i]
+		if file.Name != name || file.FileInfo().IsDir() {
+			continue
+		}
+
+		content, err := file.Open()
+		if err != nil {
+			return fmt.Errorf(`failed to read "%s" from the archive: %w`, file.Name, err)
+		}
+		defer content.Close()
+
+		return fn(content)
+	}
+
+	return nil
+}
+
+// ArchivePath is a backup path to extract from a backup archive, see ExtractBackupPaths
+type ArchivePath struct {
+	// Root is the folder of the path in the archive, see BackupManifest.Paths
+	Root string
+
+	// Destination is where the files under Root are extracted
+	Destination string
+
+	// Filter selects the files to extract, see BackupFilter
+	Filter *BackupFilter
+}
+
+// ExtractBackupPaths restores backup paths from a backup archive, reading the archive once for all of them
+//   - The extracted files overwrite the existing ones and keep their modification time
+//   - The entries escaping the destination of their path are reported as errors and skipped
+//   - An error on a file does not stop the others, the errors of each path are returned with its counts
+//   - In dry run mode, the files are printed instead of being extracted
+//
+// Returns:
+//   - The counts of the extracted files and the error of each path, in the order of paths
+//   - An error if the archive cannot be read, of kind ErrCancelled if ctx is cancelled
+func ExtractBackupPaths(ctx context.Context, archivePath string, paths []ArchivePath) ([]BackupStats, []error, error) {
+	stats := make([]BackupStats, len(paths))
+	errs := make([][]error, len(paths))
+
+	for _, p := range paths {
+		if Options.DryRun {
+			Log.DryRun(fmt.Sprintf(`extract "%s" from "%s" to "%s"`, p.Root, archivePath, p.Destination))
+		}
+	}
+
+	err := walkArchive(archivePath, func(name string, modTime time.Time, content io.Reader) error {
+		if ctx.Err() != nil {
+			return NewError(ErrCancelled, "the restore of \"%s\" was cancelled", archivePath)
+		}
+
+		// the entry is read once, the paths nested in another one get a copy of the first extracted file
+		read, extracted, extractedSize := false, "", int64(0)
+		for i, p := range paths {
+			target, err := extractTarget(name, p)
+			if err != nil {
+				errs[i] = append(errs[i], err)
+			}
+			if target == "" {
+				continue
+			}
+
+			size := extractedSize
+			switch {
+			case read && extracted == "":
+				err = fmt.Errorf(`failed to extract "%s", the archive entry could not be read`, target)
+			case Options.DryRun && !read:
+				size, err = io.Copy(io.Discard, content)
+			case Options.DryRun:
+			case !read:
+				size, err = extractFile(content, target, modTime)
+			default:
+				size, err = extractCopy(extracted, target, modTime)
+			}
+
+			first := !read
+			read = true
+			if err != nil {
+				errs[i] = append(errs[i], err)
+				continue
+			}
+
+			if first {
+				extracted, extractedSize = target, size
+			}
+			stats[i].Copied++
+			stats[i].CopiedBytes += size
+		}
+
+		return nil
+	})
+
+	pathErrs := make([]error, len(paths))
+	for i := range paths {
+		pathErrs[i] = errors.Join(errs[i]...)
+	}
+
+	return stats, pathErrs, err
+}
+
+// extractTarget returns where an archive entry is extracted for a backup path
+//
+// Returns:
+//   - The path of the extracted file, empty if the entry is not under the root of the path or not selected by its filter
+//   - An error if the entry is under the root but escapes the destination, e.g. "../x" or "..\x" on Windows
+func extractTarget(name string, p ArchivePath) (string, error) {
+	rel, found := strings.CutPrefix(name, p.Root)
+	if !found || (rel != "" && !strings.HasPrefix(rel, "/")) {
+		return "", nil
+	}
+
+	rel = strings.TrimPrefix(rel, "/")
+	if rel != "" && !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return "", fmt.Errorf(`the archive entry "%s" is outside of the backup path`, name)
+	}
+
+	// a backed up file is matched by its name, like listBackupFiles does
+	target, filterPath := p.Destination, filepath.Base(p.Destination)
+	if rel != "" {
+		rel = path.Clean(rel)
+		target, filterPath = filepath.Join(p.Destination, filepath.FromSlash(rel)), rel
+	}
+
+	if !p.Filter.Included(filterPath) {
+		return "", nil
+	}
+
+	return target, nil
+}
+
+// extractCopy copies a file extracted for a backup path to the destination of another one
+//   - Nothing is copied when both are the same file, e.g. the destination of a nested path is inside the other one
+//
+// Returns: the size of the file
+func extractCopy(extracted, target string, modTime time.Time) (int64, error) {
+	file, err := os.Open(extracted)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open \"%s\": %w", extracted, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open \"%s\": %w", extracted, err)
+	}
+	if targetInfo, err := os.Stat(target); err == nil && os.SameFile(info, targetInfo) {
+		return info.Size(), nil
+	}
+
+	return extractFile(file, target, modTime)
+}
+
+// extractFile writes the content of an archive entry to a file, creating its folder, and sets its modification time
+//
+// Returns: the size of the file
+func extractFile(content io.Reader, target string, modTime time.Time) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return 0, fmt.Errorf("failed to create the folder of \"%s\": %w", target, err)
+	}
+
+	file, err := os.Create(target)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create \"%s\": %w", target, err)
+	}
+	defer file.Close()
+
+	size, err := io.Copy(file, content)
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to extract \"%s\": %w", target, err)
+	}
+
+	if err := os.Chtimes(target, modTime, modTime); err != nil {
+		return 0, fmt.Errorf("failed to set the modification time of \"%s\": %w", target, err)
+	}
+
+	return size, nil
+}
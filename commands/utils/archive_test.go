@@ -0,0 +1,345 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestArchive writes a backup archive with the given entries as is, to craft the entries a backup never writes
+func writeTestArchive(t *testing.T, path string, entries []string) {
+	t.Helper()
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var writer archiveEntryWriter
+	if archiveFormatOf(path) == BackupFormatZip {
+		writer = &zipEntryWriter{zip.NewWriter(file)}
+	} else {
+		gzipWriter := gzip.NewWriter(file)
+		writer = &tarEntryWriter{gzip: gzipWriter, tar: tar.NewWriter(gzipWriter)}
+	}
+
+	for _, name := range entries {
+		content, err := writer.create(name, int64(len(name)), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := content.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// extractTestPath extracts a single backup path from an archive and fails the test if the archive cannot be read
+func extractTestPath(t *testing.T, archivePath, root, destination string, filter *BackupFilter) (BackupStats, error) {
+	t.Helper()
+
+	stats, errs, err := ExtractBackupPaths(context.Background(), archivePath, []ArchivePath{{Root: root, Destination: destination, Filter: filter}})
+	if err != nil {
+		t.Fatalf("ExtractBackupPaths() returned an error: %v", err)
+	}
+
+	return stats[0], errs[0]
+}
+
+func TestBackupArchiveRoundTrip(t *testing.T) {
+	for _, format := range []string{BackupFormatZip, BackupFormatTarGz} {
+		t.Run(format, func(t *testing.T) {
+			source := filepath.Join(t.TempDir(), "config")
+			writeTestFiles(t, source, map[string]string{"a.txt": "a", "sub/b.txt": "bb", "sub/c.log": "ccc"})
+
+			archivePath := filepath.Join(t.TempDir(), "backup"+ArchiveExtension(format))
+			archive, err := CreateBackupArchive(archivePath, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := archive.Add(context.Background(), source, nil); err != nil {
+				t.Fatalf("Add() returned an error: %v", err)
+			}
+			if err := archive.Close(); err != nil {
+				t.Fatalf("Close() returned an error: %v", err)
+			}
+
+			manifest, err := LoadArchiveManifest(archivePath)
+			if err != nil {
+				t.Fatalf("LoadArchiveManifest() returned an error: %v", err)
+			}
+			root := backupRoot(source)
+			if manifest.Paths[root] != source || len(manifest.Files) != 3 {
+				t.Errorf("LoadArchiveManifest() = %+v, want the path and its 3 files", manifest)
+			}
+
+			filter, err := NewBackupFilter(nil, []string{"*.log"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			destination := filepath.Join(t.TempDir(), "restored")
+			stats, err := extractTestPath(t, archivePath, root, destination, filter)
+			if err != nil {
+				t.Fatalf("ExtractBackupPaths() returned an error: %v", err)
+			}
+			if stats.Copied != 2 || stats.CopiedBytes != 3 {
+				t.Errorf("ExtractBackupPaths() = %+v, want 2 files extracted", stats)
+			}
+
+			content, err := os.ReadFile(filepath.Join(destination, "sub", "b.txt"))
+			if err != nil || string(content) != "bb" {
+				t.Errorf("the extracted file = %q, %v, want %q", content, err, "bb")
+			}
+			if IsPathExists(filepath.Join(destination, "sub", "c.log")) {
+				t.Error("the excluded file was extracted")
+			}
+		})
+	}
+}
+
+func TestExtractBackupPathTraversal(t *testing.T) {
+	escaping := []string{
+		"C/x/../evil.txt",
+		"C/x/../../evil.txt",
+		"C/x/sub/../../../evil.txt",
+		"C/x//../evil.txt",
+	}
+	if runtime.GOOS == "windows" {
+		escaping = append(escaping, `C/x/..\evil.txt`, `C/x/sub\..\..\evil.txt`, `C/x/C:\evil.txt`)
+	}
+
+	// the entries of another root sharing a prefix are not part of the backup path
+	ignored := []string{"C/xy/evil.txt", "C/evil.txt", "evil.txt"}
+
+	for _, format := range []string{BackupFormatZip, BackupFormatTarGz} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			archivePath := filepath.Join(dir, "backup"+ArchiveExtension(format))
+			writeTestArchive(t, archivePath, append(append([]string{"C/x/ok.txt", "C/x/sub/./ok.txt"}, escaping...), ignored...))
+
+			// the destination is nested, so the escaping entries would land in the temporary directory
+			destination := filepath.Join(dir, "a", "b", "x")
+			stats, err := extractTestPath(t, archivePath, "C/x", destination, nil)
+			if err == nil {
+				t.Fatal("ExtractBackupPaths() returned no error for the escaping entries")
+			}
+			for _, name := range escaping {
+				if !strings.Contains(err.Error(), `"`+name+`" is outside of the backup path`) {
+					t.Errorf("ExtractBackupPaths() error does not report %q: %v", name, err)
+				}
+			}
+			if stats.Copied != 2 {
+				t.Errorf("ExtractBackupPaths() = %+v, want 2 files extracted", stats)
+			}
+
+			err = filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+				if err == nil && strings.Contains(entry.Name(), "evil") {
+					t.Errorf("an entry was extracted to %q", path)
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, name := range []string{"ok.txt", filepath.Join("sub", "ok.txt")} {
+				if !IsPathExists(filepath.Join(destination, name)) {
+					t.Errorf("%q was not extracted", name)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractBackupPathSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "backup.zip")
+	writeTestArchive(t, archivePath, []string{"C/x/.gitconfig", "C/x/.gitconfig.bak"})
+
+	destination := filepath.Join(dir, "restored", ".gitconfig")
+	stats, err := extractTestPath(t, archivePath, "C/x/.gitconfig", destination, nil)
+	if err != nil {
+		t.Fatalf("ExtractBackupPaths() returned an error: %v", err)
+	}
+	if stats.Copied != 1 {
+		t.Errorf("ExtractBackupPaths() = %+v, want 1 file extracted", stats)
+	}
+
+	content, err := os.ReadFile(destination)
+	if err != nil || string(content) != "C/x/.gitconfig" {
+		t.Errorf("the extracted file = %q, %v", content, err)
+	}
+}
+
+func TestExtractBackupPaths(t *testing.T) {
+	for _, format := range []string{BackupFormatZip, BackupFormatTarGz} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			archivePath := filepath.Join(dir, "backup"+ArchiveExtension(format))
+			writeTestArchive(t, archivePath, []string{"C/a/1.txt", "C/a/sub/2.txt", "C/b/3.txt", "C/b/4.txt", "C/c/../evil.txt", "D/5.txt"})
+
+			// "C/a/sub" is nested in "C/a", both get their file
+			paths := []ArchivePath{
+				{Root: "C/a", Destination: filepath.Join(dir, "a")},
+				{Root: "C/a/sub", Destination: filepath.Join(dir, "sub")},
+				{Root: "C/b", Destination: filepath.Join(dir, "b")},
+				{Root: "C/c", Destination: filepath.Join(dir, "c")},
+				{Root: "E", Destination: filepath.Join(dir, "e")},
+			}
+			stats, errs, err := ExtractBackupPaths(context.Background(), archivePath, paths)
+			if err != nil {
+				t.Fatalf("ExtractBackupPaths() returned an error: %v", err)
+			}
+
+			wantCopied := []int{2, 1, 2, 0, 0}
+			for i, p := range paths {
+				if stats[i].Copied != wantCopied[i] {
+					t.Errorf("%q: %d files extracted, want %d", p.Root, stats[i].Copied, wantCopied[i])
+				}
+				if (errs[i] != nil) != (p.Root == "C/c") {
+					t.Errorf("%q: error = %v", p.Root, errs[i])
+				}
+			}
+
+			for _, name := range []string{"a/1.txt", "a/sub/2.txt", "sub/2.txt", "b/3.txt", "b/4.txt"} {
+				content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+				if err != nil || !strings.HasSuffix(string(content), path.Base(name)) {
+					t.Errorf("the extracted file %q = %q, %v", name, content, err)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractBackupPathsCancelled(t *testing.T) {
+	archivePath := filepath.Join(t.TempDir(), "backup.zip")
+	writeTestArchive(t, archivePath, []string{"C/a/1.txt"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := ExtractBackupPaths(ctx, archivePath, []ArchivePath{{Root: "C/a", Destination: t.TempDir()}})
+	if !errors.Is(err, ErrCancelled) {
+		t.Errorf("ExtractBackupPaths() error = %v, want ErrCancelled", err)
+	}
+}
+
+func TestArchiveManifestIsReadFirst(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "config")
+	writeTestFiles(t, source, map[string]string{"a.txt": "a", "b.txt": "b"})
+
+	archivePath := filepath.Join(t.TempDir(), "backup.tar.gz")
+	archive, err := CreateBackupArchive(archivePath, BackupFormatTarGz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := archive.Add(context.Background(), source, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	if err := walkArchive(archivePath, func(name string, _ time.Time, _ io.Reader) error {
+		names = append(names, name)
+		return nil
+	}); err != nil {
+		t.Fatalf("walkArchive() returned an error: %v", err)
+	}
+	root := backupRoot(source)
+	if want := []string{BackupManifestName, root + "/a.txt", root + "/b.txt"}; !slices.Equal(names, want) {
+		t.Errorf("the archive entries = %q, want %q", names, want)
+	}
+	if entries, _ := filepath.Glob(filepath.Join(filepath.Dir(archivePath), "*.tmp")); len(entries) != 0 {
+		t.Errorf("the temporary files %q were not deleted", entries)
+	}
+
+	// the archives written with the manifest at the end are still read, the content written by writeTestArchive is not a manifest
+	legacy := filepath.Join(t.TempDir(), "legacy.tar.gz")
+	writeTestArchive(t, legacy, []string{"C/a.txt", BackupManifestName})
+	if _, err := LoadArchiveManifest(legacy); err == nil || !strings.Contains(err.Error(), "failed to read the backup manifest") {
+		t.Errorf("LoadArchiveManifest() of a manifest at the end = %v, want it to be read", err)
+	}
+}
+
+func TestExtractBackupPathsNestedDestination(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "backup.tar.gz")
+	writeTestArchive(t, archivePath, []string{"C/a/1.txt", "C/a/sub/2.txt"})
+
+	// the nested path is restored inside the other one, its file is not copied onto itself
+	paths := []ArchivePath{
+		{Root: "C/a", Destination: filepath.Join(dir, "a")},
+		{Root: "C/a/sub", Destination: filepath.Join(dir, "a", "sub")},
+	}
+	stats, errs, err := ExtractBackupPaths(context.Background(), archivePath, paths)
+	if err != nil || errs[0] != nil || errs[1] != nil {
+		t.Fatalf("ExtractBackupPaths() returned an error: %v, %v", err, errs)
+	}
+	if stats[1].Copied != 1 || stats[1].CopiedBytes != int64(len("C/a/sub/2.txt")) {
+		t.Errorf("the nested path = %+v, want 1 file extracted", stats[1])
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "a", "sub", "2.txt"))
+	if err != nil || string(content) != "C/a/sub/2.txt" {
+		t.Errorf("the extracted file = %q, %v", content, err)
+	}
+}
+
+func TestBackupArchiveNestedPaths(t *testing.T) {
+	outer := filepath.Join(t.TempDir(), "home")
+	nested := filepath.Join(outer, "config")
+	writeTestFiles(t, outer, map[string]string{"a.txt": "a", "config/b.txt": "b"})
+
+	archivePath := filepath.Join(t.TempDir(), "backup.zip")
+	archive, err := CreateBackupArchive(archivePath, BackupFormatZip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive.SetBackupPaths([]string{outer, nested})
+
+	outerStats, err := archive.Add(context.Background(), outer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nestedStats, err := archive.Add(context.Background(), nested, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if outerStats.Copied != 1 || nestedStats.Copied != 1 {
+		t.Errorf("Add() = %+v and %+v, want 1 file added by each path", outerStats, nestedStats)
+	}
+
+	count := 0
+	if err := walkArchive(archivePath, func(name string, _ time.Time, _ io.Reader) error {
+		if strings.HasSuffix(name, "/b.txt") {
+			count++
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("the file of the nested path is written %d times, want once", count)
+	}
+}
@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFileName is the name of the file holding the exclude patterns of every backup path, read next to the config file
+const IgnoreFileName = ".wintoolsignore"
+
+// BackupFilter selects the files of a backup path with glob patterns
+//   - The patterns match the paths relative to the backup path, with forward slashes, ignoring the case
+//   - "*" matches any characters but "/", "?" one character but "/", "[abc]" one of the characters, "[!abc]" any other character but "/", "**" any number of folders
+//   - A pattern without a "/" matches a file or folder name at any depth, e.g. "node_modules" or "*.log",
+//     the others match from the backup path, e.g. ".git/objects" or "**/bin/obj", a leading "/" is ignored
+//   - A pattern ending with "/" only matches folders, e.g. "cache/"
+//   - A file is included when it or one of its folders matches an include pattern, every file when there are none,
+//     and when neither it nor one of its folders matches an exclude pattern
+type BackupFilter struct {
+	include []globPattern
+	exclude []globPattern
+}
+
+// globPattern is a compiled glob pattern of a BackupFilter
+type globPattern struct {
+	regexp  *regexp.Regexp
+	dirOnly bool
+}
+
+// NewBackupFilter compiles the include and exclude patterns of a backup path
+//
+// Returns: an error for the first invalid pattern
+func NewBackupFilter(include, exclude []string) (*BackupFilter, error) {
+	filter := &BackupFilter{}
+
+	for _, pattern := range include {
+		glob, err := compileGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		filter.include = append(filter.include, glob)
+	}
+
+	for _, pattern := range exclude {
+		glob, err := compileGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		filter.exclude = append(filter.exclude, glob)
+	}
+
+	return filter, nil
+}
+
+// compileGlob compiles a glob pattern to a regular expression matching the whole relative path
+func compileGlob(pattern string) (globPattern, error) {
+	glob := strings.TrimSpace(pattern)
+	if glob == "" {
+		return globPattern{}, fmt.Errorf("empty glob pattern")
+	}
+
+	var compiled globPattern
+	glob, compiled.dirOnly = strings.CutSuffix(glob, "/")
+
+	var builder strings.Builder
+	builder.WriteString("(?i)^")
+
+	// a name matches at any depth
+	if !strings.Contains(glob, "/") {
+		builder.WriteString("(?:.*/)?")
+	}
+	glob = strings.TrimPrefix(glob, "/")
+
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if !strings.HasPrefix(glob[i:], "**") {
+				builder.WriteString("[^/]*")
+				continue
+			}
+
+			// "**/" also matches no folder at all
+			i++
+			if strings.HasPrefix(glob[i+1:], "/") {
+				builder.WriteString("(?:.*/)?")
+				i++
+			} else {
+				builder.WriteString(".*")
+			}
+
+		case '?':
+			builder.WriteString("[^/]")
+
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return globPattern{}, fmt.Errorf(`invalid glob pattern "%s": missing "]"`, pattern)
+			}
+
+			// a negated class never matches the "/" between the folders
+			class := glob[i+1 : i+1+end]
+			if negated, found := strings.CutPrefix(class, "!"); found {
+				class = "^" + negated + "/"
+			} else if strings.HasPrefix(class, "^") {
+				class += "/"
+			}
+			builder.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	builder.WriteString("$")
+
+	re, err := regexp.Compile(builder.String())
+	if err != nil {
+		return globPattern{}, fmt.Errorf(`invalid glob pattern "%s": %s`, pattern, err.Error())
+	}
+	compiled.regexp = re
+
+	return compiled, nil
+}
+
+// Excluded reports whether a file or a folder is excluded, the excluded folders are not walked
+//   - rel is the path relative to the backup path, with forward slashes
+func (f *BackupFilter) Excluded(rel string, isDir bool) bool {
+	return f != nil && matchGlobs(f.exclude, rel, isDir)
+}
+
+// Included reports whether a file of the backup path is backed up
+//   - rel is the path relative to the backup path, with forward slashes
+func (f *BackupFilter) Included(rel string) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.include) > 0 && !matchGlobs(f.include, rel, false) {
+		return false
+	}
+
+	return !matchGlobs(f.exclude, rel, false)
+}
+
+// matchGlobs reports whether the path, or one of its folders, matches one of the patterns
+func matchGlobs(patterns []globPattern, rel string, isDir bool) bool {
+	for path, dir := rel, isDir; path != "" && path != "."; path, dir = parentPath(path), true {
+		for _, pattern := range patterns {
+			if (dir || !pattern.dirOnly) && pattern.regexp.MatchString(path) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// parentPath returns the folder of a relative path with forward slashes, empty for a path without one
+func parentPath(rel string) string {
+	index := strings.LastIndexByte(rel, '/')
+	if index < 0 {
+		return ""
+	}
+
+	return rel[:index]
+}
+
+// LoadIgnoreFile reads the exclude patterns of an ignore file, one per line, see BackupFilter
+//   - Empty lines and the lines starting with "#" are skipped
+//
+// Returns: no patterns if the file does not exist
+func LoadIgnoreFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf(`failed to read "%s": %w`, path, err)
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(pattern, "!") {
+			return nil, fmt.Errorf(`%s:%d: negated patterns are not supported, use "include" in the config file`, path, line)
+		}
+		if _, err := compileGlob(pattern); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, err.Error())
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf(`failed to read "%s": %w`, path, err)
+	}
+
+	return patterns, nil
+}
+
+// ListIncludedFiles lists the files of a backup path selected by the filter, the path itself when it is a file
+//
+// Returns: the paths of the files and their total size
+func ListIncludedFiles(source string, filter *BackupFilter) ([]string, int64, error) {
+	files, err := listBackupFiles(source, filepath.Base(source), filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	paths := make([]string, len(files))
+	var size int64
+	for i, file := range files {
+		paths[i] = file.source
+		size += file.info.Size()
+	}
+
+	return paths, size, nil
+}
@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		// a name matches at any depth
+		{"node_modules", "node_modules", true},
+		{"node_modules", "web/app/node_modules", true},
+		{"node_modules", "node_modules_old", false},
+		{"*.log", "error.log", true},
+		{"*.log", "logs/2024/error.log", true},
+		{"*.log", "error.log.txt", false},
+		{"*.LOG", "Error.log", true},
+
+		// a path matches from the backup path
+		{".git/objects", ".git/objects", true},
+		{".git/objects", "sub/.git/objects", false},
+		{"/build", "build", true},
+		{"/build", "src/build", false},
+		{"src/*.tmp", "src/a.tmp", true},
+		{"src/*.tmp", "src/sub/a.tmp", false},
+
+		// ** matches any number of folders
+		{"**/bin", "bin", true},
+		{"**/bin", "a/b/c/bin", true},
+		{"**/bin", "a/b/binary", false},
+		{"src/**/obj", "src/obj", true},
+		{"src/**/obj", "src/a/b/obj", true},
+		{"src/**/obj", "lib/a/obj", false},
+		{"cache/**", "cache/a/b.txt", true},
+		{"cache/**", "cache", false},
+		{"a**b", "a/x/b", true},
+
+		// ? and classes
+		{"file?.txt", "file1.txt", true},
+		{"file?.txt", "file10.txt", false},
+		{"a?b", "a/b", false},
+		{"[abc].txt", "b.txt", true},
+		{"[abc].txt", "d.txt", false},
+		{"[a-c]x", "cx", true},
+		{"[!a-c]x", "dx", true},
+		{"[!a-c]x", "ax", false},
+		{"[!x]", "/", false},
+		{"a[^x]b", "a/b", false},
+		{"a[^x]b", "ayb", true},
+		{`[\]x`, `\x`, true},
+
+		// the characters of regular expressions are literal
+		{"a.b", "axb", false},
+		{"a+b(1)", "a+b(1)", true},
+		{"^$|{}", "^$|{}", true},
+	}
+
+	for _, test := range tests {
+		glob, err := compileGlob(test.pattern)
+		if err != nil {
+			t.Errorf("compileGlob(%q) returned an error: %v", test.pattern, err)
+			continue
+		}
+		if got := glob.regexp.MatchString(test.path); got != test.want {
+			t.Errorf("compileGlob(%q) matches %q = %v, want %v", test.pattern, test.path, got, test.want)
+		}
+	}
+}
+
+func TestCompileGlobErrors(t *testing.T) {
+	tests := []struct {
+		pattern string
+		err     string
+	}{
+		{"", "empty glob pattern"},
+		{"  ", "empty glob pattern"},
+		{"[abc", `missing "]"`},
+		{"a/[b/c", `missing "]"`},
+		{"[]", `invalid glob pattern "[]"`},
+		{"[z-a]", `invalid glob pattern "[z-a]"`},
+	}
+
+	for _, test := range tests {
+		_, err := compileGlob(test.pattern)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("compileGlob(%q) error = %v, want it to contain %q", test.pattern, err, test.err)
+		}
+	}
+}
+
+func TestBackupFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		path    string
+		isDir   bool
+		want    bool // included for a file, not excluded for a folder
+	}{
+		{"no patterns", nil, nil, "a/b.txt", false, true},
+		{"excluded file", nil, []string{"*.log"}, "a/b.log", false, false},
+		{"excluded folder", nil, []string{"cache"}, "a/cache", true, false},
+		{"file of an excluded folder", nil, []string{"cache"}, "a/cache/b.txt", false, false},
+		{"folder only pattern on a folder", nil, []string{"build/"}, "src/build", true, false},
+		{"folder only pattern on a file", nil, []string{"build/"}, "src/build", false, true},
+		{"file of a folder only pattern", nil, []string{"build/"}, "src/build/out.exe", false, false},
+		{"anchored folder only pattern", nil, []string{"/out/"}, "out/a.txt", false, false},
+		{"anchored folder only pattern deeper", nil, []string{"/out/"}, "src/out/a.txt", false, true},
+		{"included file", []string{"*.json"}, nil, "a/settings.json", false, true},
+		{"not included file", []string{"*.json"}, nil, "a/settings.xml", false, false},
+		{"file of an included folder", []string{"profiles"}, nil, "profiles/a/b.txt", false, true},
+		{"folders are walked with includes", []string{"*.json"}, nil, "a/b", true, true},
+		{"exclude wins over include", []string{"*.json"}, []string{"secrets.json"}, "a/secrets.json", false, false},
+		{"double star exclude", nil, []string{"**/obj/**"}, "src/app/obj/x/y.dll", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := NewBackupFilter(test.include, test.exclude)
+			if err != nil {
+				t.Fatalf("NewBackupFilter() returned an error: %v", err)
+			}
+
+			got := !filter.Excluded(test.path, test.isDir)
+			if !test.isDir {
+				got = filter.Included(test.path)
+			}
+			if got != test.want {
+				t.Errorf("%q (folder: %v) selected = %v, want %v", test.path, test.isDir, got, test.want)
+			}
+		})
+	}
+
+	var filter *BackupFilter
+	if filter.Excluded("a", true) || !filter.Included("a") {
+		t.Error("a nil filter does not select every file")
+	}
+	if _, err := NewBackupFilter(nil, []string{"ok", "[bad"}); err == nil {
+		t.Error("NewBackupFilter() returned no error for an invalid pattern")
+	}
+}
+
+func TestLoadIgnoreFile(t *testing.T) {
+	dir := t.TempDir()
+
+	patterns, err := LoadIgnoreFile(filepath.Join(dir, IgnoreFileName))
+	if err != nil || patterns != nil {
+		t.Errorf("LoadIgnoreFile() of a missing file = %q, %v, want no patterns", patterns, err)
+	}
+
+	writeTestFiles(t, dir, map[string]string{IgnoreFileName: "# comment\n\n*.log\r\n  node_modules/  \n"})
+	patterns, err = LoadIgnoreFile(filepath.Join(dir, IgnoreFileName))
+	if err != nil {
+		t.Fatalf("LoadIgnoreFile() returned an error: %v", err)
+	}
+	if want := []string{"*.log", "node_modules/"}; !slices.Equal(patterns, want) {
+		t.Errorf("LoadIgnoreFile() = %q, want %q", patterns, want)
+	}
+
+	tests := []struct {
+		content string
+		err     string
+	}{
+		{"*.log\n!keep.log\n", ":2: negated patterns are not supported"},
+		{"# ok\n[bad\n", `:2: invalid glob pattern "[bad"`},
+	}
+	for _, test := range tests {
+		writeTestFiles(t, dir, map[string]string{IgnoreFileName: test.content})
+		if _, err := LoadIgnoreFile(filepath.Join(dir, IgnoreFileName)); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("LoadIgnoreFile(%q) error = %v, want it to contain %q", test.content, err, test.err)
+		}
+	}
+}
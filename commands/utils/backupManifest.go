@@ -0,0 +1,530 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// BackupManifestName is the name of the manifest file written in the backup target
+const BackupManifestName = ".win-tools-manifest.json"
+
+// backupManifestVersion is the version of the manifest format, a manifest with another version is ignored
+const backupManifestVersion = 1
+
+// BackupManifest records the files copied to the backup target, to copy only the new and changed files on the next backup
+type BackupManifest struct {
+	Version   int                     `json:"version"`
+	UpdatedAt time.Time               `json:"updatedAt"`
+	Files     map[string]ManifestFile `json:"files"`           // by path relative to the target, with forward slashes
+	Paths     map[string]string       `json:"paths,omitempty"` // the original location of each backup path, by its root in the target
+
+	// Entries are the backup paths as written in the config file, by their root in the target, see BackupPath.Entry
+	Entries map[string]string `json:"entries,omitempty"`
+
+	// roots are the roots of the backup paths of the current backup, see SetBackupPaths
+	roots []string
+}
+
+// newBackupManifest returns an empty manifest of the current version
+func newBackupManifest() *BackupManifest {
+	return &BackupManifest{Version: backupManifestVersion, Files: map[string]ManifestFile{}, Paths: map[string]string{}, Entries: map[string]string{}}
+}
+
+// setPath records the original location of a backup path
+func (m *BackupManifest) setPath(root, source string) {
+	if m.Paths == nil {
+		m.Paths = map[string]string{}
+	}
+
+	m.Paths[root] = source
+}
+
+// SetEntry records the path of the config file a backup path was expanded from, see Entries
+//   - source: the expanded path, as passed to Sync
+func (m *BackupManifest) SetEntry(source, entry string) {
+	if m.Entries == nil {
+		m.Entries = map[string]string{}
+	}
+
+	m.Entries[backupRoot(absoluteSource(source))] = entry
+}
+
+// SetBackupPaths records every backup path of the current backup, a path nested in another one keeps its files to itself
+//   - The files under a nested path are neither copied nor deleted by the sync of the path containing it, see Sync
+func (m *BackupManifest) SetBackupPaths(sources []string) {
+	m.roots = make([]string, len(sources))
+	for i, source := range sources {
+		m.roots[i] = backupRoot(absoluteSource(source))
+	}
+}
+
+// dropOtherPaths removes the files and the locations of the backup paths which are not part of the current backup, see SetBackupPaths
+func (m *BackupManifest) dropOtherPaths() {
+	current := func(key string) bool {
+		return slices.ContainsFunc(m.roots, func(root string) bool { return isUnderRoot(key, root) })
+	}
+
+	for key := range m.Files {
+		if !current(key) {
+			delete(m.Files, key)
+		}
+	}
+	for root := range m.Paths {
+		if !slices.Contains(m.roots, root) {
+			delete(m.Paths, root)
+			delete(m.Entries, root)
+		}
+	}
+}
+
+// owns reports whether a file of the target belongs to a backup path, and not to another backup path nested in it
+//   - key: the path of the file relative to the target, see backupFile
+//   - root: the root of the backup path, see backupRoot
+func (m *BackupManifest) owns(root, key string) bool {
+	if !isUnderRoot(key, root) {
+		return false
+	}
+
+	for _, nested := range m.roots {
+		if nested != root && isUnderRoot(nested, root) && isUnderRoot(key, nested) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isUnderRoot reports whether a key is the root itself or one of the files under it
+func isUnderRoot(key, root string) bool {
+	return key == root || strings.HasPrefix(key, root+"/")
+}
+
+// ManifestFile records a file of the backup as it was when it was last copied
+type ManifestFile struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	SHA256  string    `json:"sha256"`
+}
+
+// BackupStats counts the files copied, skipped because they did not change and deleted because they no longer exist
+type BackupStats struct {
+	Copied       int
+	CopiedBytes  int64
+	Skipped      int
+	SkippedBytes int64
+	Deleted      int
+	DeletedBytes int64
+}
+
+// Add adds the counts of other to the stats
+func (s *BackupStats) Add(other BackupStats) {
+	s.Copied += other.Copied
+	s.CopiedBytes += other.CopiedBytes
+	s.Skipped += other.Skipped
+	s.SkippedBytes += other.SkippedBytes
+	s.Deleted += other.Deleted
+	s.DeletedBytes += other.DeletedBytes
+}
+
+// String returns the counts, e.g. "copied: 2 files (1.5 MB), skipped: 10 files (3.2 GB), deleted: 0 files (0 B)"
+func (s BackupStats) String() string {
+	return fmt.Sprintf(
+		"copied: %s, skipped: %s, deleted: %s",
+		CountFiles(s.Copied, s.CopiedBytes), CountFiles(s.Skipped, s.SkippedBytes), CountFiles(s.Deleted, s.DeletedBytes),
+	)
+}
+
+// CountFiles formats a number of files and their size
+func CountFiles(count int, size int64) string {
+	if count == 1 {
+		return fmt.Sprintf("1 file (%s)", FormatBytes(size))
+	}
+
+	return fmt.Sprintf("%d files (%s)", count, FormatBytes(size))
+}
+
+// FormatBytes formats a size in bytes with a binary unit, e.g. "1.5 MB"
+func FormatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// LoadBackupManifest reads the manifest of the backup target
+//   - A target without a manifest gets an empty one, every file is copied
+//
+// Returns: the manifest, never nil, and an error if the manifest exists but cannot be read, the manifest is then empty
+func LoadBackupManifest(target string) (*BackupManifest, error) {
+	manifest := newBackupManifest()
+
+	data, err := os.ReadFile(filepath.Join(target, BackupManifestName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, fmt.Errorf("failed to read the backup manifest: %w", err)
+	}
+
+	var saved BackupManifest
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return manifest, fmt.Errorf("failed to read the backup manifest: %w", err)
+	}
+	if saved.Version != backupManifestVersion {
+		return manifest, fmt.Errorf("unsupported backup manifest version %d", saved.Version)
+	}
+
+	// the files were stored by their base name before the manifest recorded the backup paths
+	if len(saved.Files) > 0 && len(saved.Paths) == 0 {
+		return manifest, fmt.Errorf("the backup manifest was written by an older version, without the backup paths")
+	}
+
+	if saved.Files != nil {
+		manifest.Files = saved.Files
+	}
+	if saved.Paths != nil {
+		manifest.Paths = saved.Paths
+	}
+	if saved.Entries != nil {
+		manifest.Entries = saved.Entries
+	}
+
+	return manifest, nil
+}
+
+// Save writes the manifest to the backup target
+//   - The manifest is written to a temporary file first, an interrupted save keeps the previous manifest
+func (m *BackupManifest) Save(target string) error {
+	if Options.DryRun {
+		return nil
+	}
+
+	m.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(target, BackupManifestName)
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("failed to save the backup manifest: %w", err)
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to save the backup manifest: %w", err)
+	}
+
+	return nil
+}
+
+// backupFile is a file of a backup path to copy to the target
+type backupFile struct {
+	source string
+	key    string // path relative to the target, with forward slashes
+	info   fs.FileInfo
+}
+
+// Sync copies a file or a directory to the backup target under its root, see backupRoot, but only the files which changed since the last backup
+//   - A file is unchanged when its size and modification time match the manifest, or else its SHA-256 hash does
+//   - The files of the path which no longer exist in the source, or are no longer selected by the filter, are deleted from the target
+//   - The files under another backup path nested in this one are left to it, see SetBackupPaths
+//   - The copied files keep the modification time of the source
+//   - An error on a file does not stop the others, all errors are returned at the end
+//   - In dry run mode, the changes are counted without being made, the deleted files are printed
+//
+// Returns: the counts of the copied, skipped and deleted files, and an error of kind ErrCancelled if ctx is cancelled
+func (m *BackupManifest) Sync(ctx context.Context, source, target string, filter *BackupFilter) (BackupStats, error) {
+	var stats BackupStats
+
+	source = absoluteSource(source)
+	root := backupRoot(source)
+
+	files, err := listBackupFiles(source, root, filter)
+	if err != nil {
+		return stats, err
+	}
+	files = slices.DeleteFunc(files, func(file backupFile) bool { return !m.owns(root, file.key) })
+
+	if !Options.DryRun {
+		m.setPath(root, source)
+	}
+
+	// the deleted files are removed first, a file may have been replaced with a folder of the same name
+	seen := map[string]bool{}
+	for _, file := range files {
+		seen[file.key] = true
+	}
+
+	var errs []error
+	for _, key := range sortedKeys(m.Files) {
+		if seen[key] || !m.owns(root, key) {
+			continue
+		}
+
+		if err := m.deleteFile(target, key); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		stats.Deleted++
+		stats.DeletedBytes += m.Files[key].Size
+		if !Options.DryRun {
+			delete(m.Files, key)
+		}
+	}
+
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return stats, NewError(ErrCancelled, "the backup of \"%s\" was cancelled", source)
+		}
+
+		copied, err := m.syncFile(file, target)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if copied {
+			stats.Copied++
+			stats.CopiedBytes += file.info.Size()
+		} else {
+			stats.Skipped++
+			stats.SkippedBytes += file.info.Size()
+		}
+	}
+
+	return stats, errors.Join(errs...)
+}
+
+// backupRoot returns the root of a backup path in the target, a unique and reversible key made of its volume and its full path
+//   - e.g. "C:\Users\me\config" is stored under "C/Users/me/config", "\\server\share\config" under "UNC/server/share/config"
+//   - The original location is also recorded in the manifest, see BackupManifest.Paths
+func backupRoot(source string) string {
+	source = strings.TrimPrefix(source, `\\?\`)
+	if rest, found := strings.CutPrefix(source, `UNC\`); found {
+		source = `\\` + rest
+	}
+
+	volume := filepath.VolumeName(source)
+	rest := filepath.ToSlash(source[len(volume):])
+
+	switch {
+	case strings.HasPrefix(volume, `\\`), strings.HasPrefix(volume, "//"):
+		volume = "UNC/" + filepath.ToSlash(volume[2:])
+	default:
+		volume = strings.TrimSuffix(volume, ":")
+	}
+
+	root := strings.Trim(path.Join(volume, rest), "/")
+	if root == "" || root == "." {
+		return "root"
+	}
+
+	return root
+}
+
+// absoluteSource returns the absolute path of a backup path, recorded in the manifest to restore it to the same location
+func absoluteSource(source string) string {
+	if abs, err := filepath.Abs(source); err == nil {
+		return abs
+	}
+
+	return source
+}
+
+// listBackupFiles lists the files of a backup path, the path itself when it is a file, keyed under the root of the path
+//   - The files not selected by the filter are skipped, the excluded folders are not walked, see BackupFilter
+//   - Symbolic links are followed for files, linked folders are not walked
+func listBackupFiles(source, root string, filter *BackupFilter) ([]backupFile, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, errors.New("Copy source file does not exist")
+	}
+
+	if !info.IsDir() {
+		if !filter.Included(filepath.Base(source)) {
+			return nil, nil
+		}
+		return []backupFile{{source: source, key: root, info: info}}, nil
+	}
+
+	var files []backupFile
+	err = filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to list the files of \"%s\": %w", path, err)
+		}
+
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			if rel != "." && filter.Excluded(rel, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !filter.Included(rel) {
+			return nil
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+
+		files = append(files, backupFile{source: path, key: root + "/" + rel, info: info})
+		return nil
+	})
+
+	return files, err
+}
+
+// syncFile copies a file to the target unless it did not change since the last backup
+//
+// Returns: true if the file was copied
+func (m *BackupManifest) syncFile(file backupFile, target string) (bool, error) {
+	destination := filepath.Join(target, filepath.FromSlash(file.key))
+	previous, found := m.Files[file.key]
+
+	// the copy in the target must still be there
+	destinationInfo, err := os.Stat(destination)
+	found = found && err == nil && destinationInfo.Size() == file.info.Size() && previous.Size == file.info.Size()
+
+	if found && previous.ModTime.Equal(file.info.ModTime()) {
+		return false, nil
+	}
+
+	if found {
+		hash, err := hashFile(file.source)
+		if err != nil {
+			return false, err
+		}
+
+		// touched but not changed
+		if hash == previous.SHA256 {
+			if !Options.DryRun {
+				previous.ModTime = file.info.ModTime()
+				m.Files[file.key] = previous
+			}
+			return false, nil
+		}
+	}
+
+	if Options.DryRun {
+		return true, nil
+	}
+
+	hash, err := copyFileHashed(file.source, destination, file.info.ModTime())
+	if err != nil {
+		return false, err
+	}
+
+	m.Files[file.key] = ManifestFile{Size: file.info.Size(), ModTime: file.info.ModTime(), SHA256: hash}
+
+	return true, nil
+}
+
+// deleteFile deletes a file of the backup from the target, with the folders it leaves empty
+func (m *BackupManifest) deleteFile(target, key string) error {
+	path := filepath.Join(target, filepath.FromSlash(key))
+
+	if Options.DryRun {
+		Log.DryRun(fmt.Sprintf(`delete "%s", it no longer exists in the source`, path))
+		return nil
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete \"%s\": %w", path, err)
+	}
+
+	// os.Remove fails on the first folder which is not empty
+	for dir := filepath.Dir(path); dir != filepath.Clean(target); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// hashFile returns the SHA-256 hash of a file, hex encoded
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read \"%s\": %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to read \"%s\": %w", path, err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// copyFileHashed copies a file to the destination file path, creating its folder, and sets its modification time
+//
+// Returns: the SHA-256 hash of the copied content, hex encoded
+func copyFileHashed(source, destination string, modTime time.Time) (string, error) {
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return "", fmt.Errorf("failed to open \"%s\": %w", source, err)
+	}
+	defer sourceFile.Close()
+
+	if err := os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create the folder of \"%s\": %w", destination, err)
+	}
+
+	// the file may be hard linked from a previous snapshot, it is replaced instead of being overwritten
+	if err := os.Remove(destination); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("failed to replace \"%s\": %w", destination, err)
+	}
+
+	destinationFile, err := os.Create(destination)
+	if err != nil {
+		return "", fmt.Errorf("failed to create \"%s\": %w", destination, err)
+	}
+	defer destinationFile.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(destinationFile, hash), sourceFile); err != nil {
+		return "", fmt.Errorf("failed to copy \"%s\": %w", source, err)
+	}
+
+	if err := destinationFile.Close(); err != nil {
+		return "", fmt.Errorf("failed to copy \"%s\": %w", source, err)
+	}
+
+	if err := os.Chtimes(destination, modTime, modTime); err != nil {
+		return "", fmt.Errorf("failed to set the modification time of \"%s\": %w", destination, err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
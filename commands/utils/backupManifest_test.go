@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestFiles creates files with their content under a directory, the paths use forward slashes
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// syncTestPath syncs a backup path to the target and fails the test on an error
+func syncTestPath(t *testing.T, manifest *BackupManifest, source, target string, filter *BackupFilter) BackupStats {
+	t.Helper()
+
+	stats, err := manifest.Sync(context.Background(), source, target, filter)
+	if err != nil {
+		t.Fatalf("Sync(%q) returned an error: %v", source, err)
+	}
+
+	return stats
+}
+
+func TestBackupRoot(t *testing.T) {
+	tests := []struct {
+		source  string
+		want    string
+		windows bool
+	}{
+		{`/home/me/config`, "home/me/config", false},
+		{`/`, "root", false},
+		{`C:\Users\me\config`, "C/Users/me/config", true},
+		{`C:\`, "C", true},
+		{`\\server\share\config`, "UNC/server/share/config", true},
+		{`\\?\C:\long\path`, "C/long/path", true},
+		{`\\?\UNC\server\share\x`, "UNC/server/share/x", true},
+	}
+
+	for _, test := range tests {
+		if test.windows != (runtime.GOOS == "windows") {
+			continue
+		}
+		if got := backupRoot(test.source); got != test.want {
+			t.Errorf("backupRoot(%q) = %q, want %q", test.source, got, test.want)
+		}
+	}
+}
+
+func TestBackupManifestSync(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "config")
+	target := t.TempDir()
+	writeTestFiles(t, source, map[string]string{"a.txt": "a", "sub/b.txt": "bb", "sub/c.log": "ccc"})
+
+	manifest := newBackupManifest()
+	root := backupRoot(source)
+
+	stats := syncTestPath(t, manifest, source, target, nil)
+	if stats.Copied != 3 || stats.CopiedBytes != 6 || stats.Skipped != 0 || stats.Deleted != 0 {
+		t.Errorf("first Sync() = %+v, want 3 files copied", stats)
+	}
+	if manifest.Paths[root] != source {
+		t.Errorf("Paths[%q] = %q, want %q", root, manifest.Paths[root], source)
+	}
+
+	stats = syncTestPath(t, manifest, source, target, nil)
+	if stats.Copied != 0 || stats.Skipped != 3 || stats.Deleted != 0 {
+		t.Errorf("unchanged Sync() = %+v, want 3 files skipped", stats)
+	}
+
+	// a changed file is copied again, a deleted file is deleted from the target
+	later := time.Now().Add(time.Hour)
+	writeTestFiles(t, source, map[string]string{"a.txt": "changed"})
+	if err := os.Chtimes(filepath.Join(source, "a.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(source, "sub", "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	stats = syncTestPath(t, manifest, source, target, nil)
+	if stats.Copied != 1 || stats.Skipped != 1 || stats.Deleted != 1 || stats.DeletedBytes != 2 {
+		t.Errorf("Sync() after changes = %+v, want 1 copied, 1 skipped and 1 deleted", stats)
+	}
+
+	copied, err := os.ReadFile(filepath.Join(target, filepath.FromSlash(root), "a.txt"))
+	if err != nil || string(copied) != "changed" {
+		t.Errorf("the changed file was not copied: %q, %v", copied, err)
+	}
+	if IsPathExists(filepath.Join(target, filepath.FromSlash(root), "sub", "b.txt")) {
+		t.Error("the deleted file is still in the target")
+	}
+
+	// a file no longer selected by the filter is deleted from the target
+	filter, err := NewBackupFilter(nil, []string{"*.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats = syncTestPath(t, manifest, source, target, filter)
+	if stats.Deleted != 1 || stats.Skipped != 1 {
+		t.Errorf("Sync() with an exclude = %+v, want 1 skipped and 1 deleted", stats)
+	}
+	if _, found := manifest.Files[root+"/sub/c.log"]; found {
+		t.Error("the excluded file is still in the manifest")
+	}
+}
+
+func TestBackupManifestSyncNestedPaths(t *testing.T) {
+	outer := filepath.Join(t.TempDir(), "home")
+	nested := filepath.Join(outer, "config")
+	target := t.TempDir()
+	writeTestFiles(t, outer, map[string]string{"a.txt": "a", "config/b.txt": "b", "config/c.log": "c"})
+
+	// the nested path excludes its logs, the outer path would copy them
+	filter, err := NewBackupFilter(nil, []string{"*.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := newBackupManifest()
+	manifest.SetBackupPaths([]string{outer, nested})
+
+	outerStats := syncTestPath(t, manifest, outer, target, nil)
+	nestedStats := syncTestPath(t, manifest, nested, target, filter)
+	if outerStats.Copied != 1 || nestedStats.Copied != 1 {
+		t.Errorf("first Sync() = %+v and %+v, want 1 file copied by each path", outerStats, nestedStats)
+	}
+
+	// a second backup neither deletes nor copies again the files of the other path
+	for i := 0; i < 2; i++ {
+		outerStats = syncTestPath(t, manifest, outer, target, nil)
+		nestedStats = syncTestPath(t, manifest, nested, target, filter)
+
+		for _, stats := range []BackupStats{outerStats, nestedStats} {
+			if stats.Copied != 0 || stats.Deleted != 0 || stats.Skipped != 1 {
+				t.Errorf("Sync() %d = %+v, want 1 file skipped", i+2, stats)
+			}
+		}
+	}
+
+	if IsPathExists(filepath.Join(target, filepath.FromSlash(backupRoot(nested)), "c.log")) {
+		t.Error("the file excluded by the nested path was copied by the outer path")
+	}
+
+	// once the nested path is removed from the config, the outer path owns its files
+	manifest.SetBackupPaths([]string{outer})
+	outerStats = syncTestPath(t, manifest, outer, target, nil)
+	if outerStats.Copied != 1 || outerStats.Skipped != 2 || outerStats.Deleted != 0 {
+		t.Errorf("Sync() without the nested path = %+v, want 1 copied and 2 skipped", outerStats)
+	}
+}
+
+func TestBackupManifestSaveLoad(t *testing.T) {
+	target := t.TempDir()
+
+	manifest, err := LoadBackupManifest(target)
+	if err != nil || len(manifest.Files) != 0 {
+		t.Fatalf("LoadBackupManifest() of an empty target = %+v, %v, want an empty manifest", manifest, err)
+	}
+
+	manifest.Files["C/x/a.txt"] = ManifestFile{Size: 1, SHA256: "abc"}
+	manifest.setPath("C/x", `C:\x`)
+	manifest.Entries["C/x"] = `%X%`
+	if err := manifest.Save(target); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+
+	loaded, err := LoadBackupManifest(target)
+	if err != nil {
+		t.Fatalf("LoadBackupManifest() returned an error: %v", err)
+	}
+	if loaded.Files["C/x/a.txt"].SHA256 != "abc" || loaded.Paths["C/x"] != `C:\x` || loaded.Entries["C/x"] != `%X%` {
+		t.Errorf("LoadBackupManifest() = %+v, want the saved manifest", loaded)
+	}
+}
+
+func TestLoadBackupManifestErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		err      string
+	}{
+		{"invalid json", `{`, "failed to read the backup manifest"},
+		{"other version", `{"version": 99}`, "unsupported backup manifest version 99"},
+		{"without the paths", `{"version": 1, "files": {"a.txt": {"size": 1}}}`, "written by an older version"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := t.TempDir()
+			writeTestFiles(t, target, map[string]string{BackupManifestName: test.manifest})
+
+			manifest, err := LoadBackupManifest(target)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("LoadBackupManifest() error = %v, want it to contain %q", err, test.err)
+			}
+			if manifest == nil || len(manifest.Files) != 0 {
+				t.Errorf("LoadBackupManifest() = %+v, want an empty manifest", manifest)
+			}
+		})
+	}
+}
@@ -1,10 +1,14 @@
 package utils
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 
+	"github.com/alabsi91/win-tools/commands/utils/shellquote"
 	"github.com/charmbracelet/huh"
 )
 
@@ -37,13 +41,13 @@ func (chocolatey) IsInstalled() bool {
 // GetExecutablePath retrieves the path to the Chocolatey executable.
 //  1. First, it checks the default installation path for Chocolatey.
 //  2. If the executable is not found in the default path, it attempts to retrieve the path from the environment variables.
-//  3. If neither method succeeds, the program will exit with an error, indicating that the Chocolatey executable could not be located.
+//  3. If neither method succeeds, returns an error indicating that the Chocolatey executable could not be located.
 //
 // Returns: The absolute path to the Chocolatey executable as a string.
-func (chocolatey) GetExecutablePath() string {
+func (chocolatey) GetExecutablePath() (string, error) {
 	// first try to the default path
 	if IsPathExists(ChocolateyInstallPath) {
-		return ChocolateyInstallPath
+		return ChocolateyInstallPath, nil
 	}
 
 	// try to get the path from where chocolatey is installed
@@ -51,28 +55,42 @@ func (chocolatey) GetExecutablePath() string {
 
 	output, err := cmd.Output()
 	if err != nil {
-		Log.Fatal("\nFailed to get chocolatey executable path\n")
+		// chocolatey may only have been installed in dry run mode
+		if Options.DryRun {
+			return ChocolateyInstallPath, nil
+		}
+		return "", errors.New("failed to get chocolatey executable path")
 	}
 
 	// verify if the path exists
 	path := string(output)
 
 	if !IsPathExists(path) {
-		Log.Fatal("\nFailed to get chocolatey executable path\n")
+		return "", errors.New("failed to get chocolatey executable path")
 	}
 
-	return path
+	return path, nil
 }
 
 // InstallSelf installs Chocolatey on the system using a PowerShell command.
 //   - Uses a PowerShell command to perform the installation.
 //   - Must be run with elevated privileges (administrator rights).
 //   - Does not check for admin privileges before running the command.
-//   - Exits the program if the installation command fails.
-func (chocolatey) InstallSelf() {
-	powershell := Powershell.GetShellName()
+//   - Returns an error if the installation command fails.
+//   - The installation is stopped when the context is done.
+func (chocolatey) InstallSelf(ctx context.Context) error {
+	if Options.DryRun {
+		Log.DryRun("install Chocolatey from https://community.chocolatey.org/install.ps1")
+		return nil
+	}
 
-	cmd := exec.Command(
+	powershell, err := Powershell.GetShellName()
+	if err != nil {
+		return err
+	}
+
+	cmd := CommandContext(
+		ctx,
 		powershell,
 		"-Command",
 		"Set-ExecutionPolicy Bypass -Scope Process -Force;",
@@ -85,58 +103,123 @@ func (chocolatey) InstallSelf() {
 	cmd.Stderr = os.Stderr
 
 	if err := cmd.Start(); err != nil {
-		Log.Fatal("\n"+err.Error(), "\n")
+		return fmt.Errorf("failed to install chocolatey: %w", err)
 	}
 
 	if err := cmd.Wait(); err != nil {
-		Log.Fatal("\n"+err.Error(), "\n")
+		return fmt.Errorf("failed to install chocolatey: %w", err)
 	}
+
+	return nil
 }
 
 // InstallPackage installs a package using Chocolatey.
 //   - Uses a PowerShell command to perform the installation and streams the output.
-//   - On error, prints an error message without exiting the program or returning an error.
-//   - Takes the package name as the first parameter (packageName).
-//   - Takes a boolean as the second parameter (openInNewWindow):
-//   - If true, starts the process in a new terminal window without waiting for it to finish.
+//   - Returns an error if the installation fails.
+//   - Returns an error of kind ErrRebootRequired if the package was installed but needs a reboot.
+//   - Takes the package entry as the only parameter (pkg), see PackageEntry.ChocoArgs and PackageEntry.ExtraArgs for the arguments passed to choco.
+//   - If pkg.NewWindow is true, starts the process in a new terminal window without waiting for it to finish.
 //   - If false, runs the process in the current context.
-func (chocolatey *chocolatey) InstallPackage(packageName string, openInNewWindow bool) {
-	chocolateyPath := chocolatey.GetExecutablePath()
-	chocolateyPath = fmt.Sprintf(`. "%s"`, chocolateyPath)
+//   - The installation is stopped when the context is done or pkg.Timeout expires, see WithStepTimeout.
+func (chocolatey *chocolatey) InstallPackage(ctx context.Context, pkg PackageEntry) error {
+	chocolateyPath, err := chocolatey.GetExecutablePath()
+	if err != nil {
+		return err
+	}
+	chocolateyPath = ". " + shellquote.PowerShell(chocolateyPath)
+
+	powershell, err := Powershell.GetShellName()
+	if err != nil {
+		return err
+	}
 
-	powershell := Powershell.GetShellName()
+	args, err := chocoInstallArgs(pkg)
+	if err != nil {
+		return err
+	}
 
-	var err error
-	if openInNewWindow {
-		err = Powershell.RunPathThroughCmd(
-			"Start-Process", powershell,
-			"-ArgumentList", fmt.Sprintf(`'-C', '%s install %s -yf --ignore-checksum; pause'`, chocolateyPath, packageName),
-			"-Verb", "RunAs",
-		)
+	packageName := pkg.Name
+
+	ctx, cancel := WithStepTimeout(ctx, pkg.Timeout)
+	defer cancel()
+
+	if pkg.NewWindow {
+		script := fmt.Sprintf("%s %s; pause", chocolateyPath, strings.Join(args, " "))
+		err = Powershell.RunPathThroughCmd(ctx, newWindowCommand(powershell, script)...)
 	} else {
 		err = Powershell.RunPathThroughCmd(
-			chocolateyPath,
-			"install", packageName,
-			"-yf", "--ignore-checksum",
+			ctx,
+			append(append([]string{chocolateyPath}, args...), "; exit $LASTEXITCODE")...,
 		)
 	}
 
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf(`installing chocolatey package "%s" timed out after %s`, packageName, StepTimeout(pkg.Timeout))
+	}
+	if ctx.Err() != nil {
+		return NewError(ErrCancelled, `the installation of chocolatey package "%s" was cancelled`, packageName)
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && isRebootExitCode(exitErr.ExitCode()) {
+		return NewError(ErrRebootRequired, `chocolatey package "%s" requires a reboot to complete the installation`, packageName)
+	}
+
+	if err != nil {
+		return fmt.Errorf(`failed to install chocolatey package "%s": %w`, packageName, err)
+	}
+
+	return nil
+}
+
+// chocoInstallArgs returns the arguments of "choco install" for a package entry, each quoted as a PowerShell literal
+//   - The name is followed by the arguments of PackageEntry.ChocoArgs and PackageEntry.ExtraArgs
+//
+// Returns: an error of kind ErrConfig if the args of the package cannot be split
+func chocoInstallArgs(pkg PackageEntry) ([]string, error) {
+	extraArgs, err := pkg.ExtraArgs()
 	if err != nil {
-		Log.Error("\nfailed to install chocolatey package:", packageName, "\n")
-		return
+		return nil, NewError(ErrConfig, `invalid args for the package "%s": %s`, pkg.Name, err.Error())
 	}
 
+	args := []string{"install", shellquote.PowerShell(pkg.Name)}
+	for _, arg := range append(pkg.ChocoArgs(), extraArgs...) {
+		args = append(args, shellquote.PowerShell(arg))
+	}
+
+	return args, nil
+}
+
+// newWindowCommand returns the PowerShell command running a script elevated in a new window of the shell
+//   - The script is passed with -EncodedCommand, Start-Process joins -ArgumentList without quoting its elements
+//     for the command line of the new process, so a plain -Command script would be split and read again
+func newWindowCommand(shell, script string) []string {
+	return []string{
+		"Start-Process", shell,
+		"-ArgumentList", shellquote.PowerShellList("-EncodedCommand", shellquote.EncodedCommand(script)),
+		"-Verb", "RunAs",
+	}
+}
+
+// isRebootExitCode checks if a Chocolatey exit code means that the installation succeeded but a reboot is required
+func isRebootExitCode(code int) bool {
+	return code == 1641 || code == 3010
 }
 
 // AskForInstallConfirmation asks the user if Chocolatey should be installed.
 //   - Displays a prompt asking the user if Chocolatey should be installed.
 //   - If the user confirms/denies, returns a boolean.
 //   - If the user cancels the prompt using Ctrl+C for example, returns an error.
+//   - Uses the "installChocolatey" answer from the answers file or the "--yes" flag when provided.
 //
 // Returns:
 //   - A boolean indicating if Chocolatey should be installed.
 //   - An error if the user cancels the prompt or denies the installation.
 func (chocolatey) AskForInstallConfirmation() (bool, error) {
+	if answer, found, err := AnswerForConfirm("installChocolatey", Answers.InstallChocolatey); found || err != nil {
+		return answer, err
+	}
+
 	var answer bool = false
 
 	err := huh.NewForm(
@@ -149,5 +232,5 @@ func (chocolatey) AskForInstallConfirmation() (bool, error) {
 		),
 	).Run()
 
-	return answer, err
+	return answer, PromptError(err)
 }
@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"encoding/base64"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// encodedArgumentList matches the -ArgumentList of newWindowCommand, nothing in it is read by a command line
+var encodedArgumentList = regexp.MustCompile(`^'-EncodedCommand', '([A-Za-z0-9+/=]+)'$`)
+
+// parsePowerShellWords splits a command into its bare words and single-quoted literals, the way PowerShell reads them
+func parsePowerShellWords(t *testing.T, command string) []string {
+	t.Helper()
+
+	var words []string
+	runes := []rune(command)
+	for i := 0; i < len(runes); {
+		if runes[i] == ' ' {
+			i++
+			continue
+		}
+
+		var word strings.Builder
+		if !strings.ContainsRune(powershellQuoteChars, runes[i]) {
+			for ; i < len(runes) && runes[i] != ' '; i++ {
+				if strings.ContainsRune(powershellQuoteChars+"$`;\"", runes[i]) {
+					t.Fatalf("the bare word of %q holds the special character %q", command, runes[i])
+				}
+				word.WriteRune(runes[i])
+			}
+			words = append(words, word.String())
+			continue
+		}
+
+		for i++; ; i++ {
+			if i == len(runes) {
+				t.Fatalf("the literal of %q is not closed", command)
+			}
+			if strings.ContainsRune(powershellQuoteChars, runes[i]) {
+				if i+1 == len(runes) || !strings.ContainsRune(powershellQuoteChars, runes[i+1]) {
+					break
+				}
+				i++
+			}
+			word.WriteRune(runes[i])
+		}
+		i++
+
+		if i < len(runes) && runes[i] != ' ' {
+			t.Fatalf("the literal of %q is followed by %q", command, runes[i])
+		}
+		words = append(words, word.String())
+	}
+
+	return words
+}
+
+// powershellQuoteChars are the characters PowerShell reads as a single quote
+const powershellQuoteChars = "'‘’‚‛"
+
+func TestNewWindowCommandHostileValues(t *testing.T) {
+	hostile := []string{
+		`"; calc; "`,
+		`'; calc; '`,
+		`’; calc; ‘`,
+		`$(calc)`,
+		"`calc`",
+		`$env:PATH`,
+		`a; calc`,
+		`& calc`,
+		`/DIR="C:\Program Files\" -y`,
+		`%PATH% ^&|<>`,
+		`C:\dir\`,
+	}
+
+	for _, value := range hostile {
+		pkg := PackageEntry{Name: "git", Params: value, Source: value, Args: "--x " + shellquoteArgs(value)}
+
+		args, err := chocoInstallArgs(pkg)
+		if err != nil {
+			t.Fatalf("chocoInstallArgs(%q) returned an error: %v", value, err)
+		}
+		script := ". 'C:\\choco.exe' " + strings.Join(args, " ") + "; pause"
+
+		command := newWindowCommand("powershell", script)
+		if len(command) != 6 || command[0] != "Start-Process" || command[4] != "-Verb" {
+			t.Fatalf("newWindowCommand() = %q, want a Start-Process command", command)
+		}
+
+		match := encodedArgumentList.FindStringSubmatch(command[3])
+		if match == nil {
+			t.Fatalf("the -ArgumentList %q is not an encoded command", command[3])
+		}
+		encoded, err := base64.StdEncoding.DecodeString(match[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		units := make([]uint16, len(encoded)/2)
+		for i := range units {
+			units[i] = uint16(encoded[2*i]) | uint16(encoded[2*i+1])<<8
+		}
+		if decoded := string(utf16.Decode(units)); decoded != script {
+			t.Fatalf("the encoded script = %q, want %q", decoded, script)
+		}
+
+		words := parsePowerShellWords(t, strings.TrimSuffix(script, "; pause"))
+		want := []string{".", `C:\choco.exe`, "install", "git", "-yf", "--params=" + value, "--source=" + value, "--x", value}
+		if !slices.Equal(words, want) {
+			t.Errorf("the script with %q reads %q, want %q", value, words, want)
+		}
+	}
+}
+
+// shellquoteArgs quotes a value for PackageEntry.Args, with the quote it does not hold
+func shellquoteArgs(value string) string {
+	if strings.Contains(value, `"`) {
+		return "'" + value + "'"
+	}
+	return `"` + value + `"`
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package utils
+
+import "os/exec"
+
+// SetCommandLine starts a command with a command line built by the caller, instead of quoting every argument
+//   - Outside of Windows, the arguments are passed to the program as is, so the command is left unchanged
+func SetCommandLine(*exec.Cmd, string) {}
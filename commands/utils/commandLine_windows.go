@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// SetCommandLine starts a command with a command line built by the caller, instead of quoting every argument
+//   - Needed for cmd.exe, which reads the command after /C as is and not the way the arguments are quoted
+//   - cmdLine includes the executable, e.g. cmd /S /C "echo hi"
+func SetCommandLine(cmd *exec.Cmd, cmdLine string) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	cmd.SysProcAttr.CmdLine = cmdLine
+}
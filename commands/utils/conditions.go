@@ -0,0 +1,571 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// conditions evaluates the "when" expressions of the config entries
+//   - An expression combines values with !, &&, ||, parentheses and the comparisons ==, !=, <, <=, >, >=
+//   - Values are numbers, 'single' or "double" quoted strings and the functions of conditionFunctions,
+//     a function without arguments may be written without parentheses, e.g. admin && build >= 22000
+//   - With !, && and ||, an empty string, 0 and false are false, every other value is true
+type conditions struct {
+	lookupEnv func(string) (string, bool)
+
+	// isAdmin and build are cached, so they are only looked up once per session
+	isAdmin *bool
+	build   *int
+}
+
+var Conditions = &conditions{lookupEnv: os.LookupEnv}
+
+// conditionFunction describes a function usable in a "when" expression
+type conditionFunction struct {
+	params int
+	call   func(scope conditionScope, args []any) (any, error)
+}
+
+// conditionScope holds what a "when" expression is evaluated against
+type conditionScope struct {
+	ctx        context.Context
+	conditions *conditions
+	profiles   []string
+}
+
+// conditionFunctions lists the functions usable in a "when" expression
+//   - admin: true when running with admin privileges
+//   - build: the Windows build number, e.g. 22631, 0 outside of Windows
+//   - hostname: the name of this machine
+//   - env("NAME"): the value of an environment variable, empty when it is unset
+//   - exists("path"): true when the path exists, the path is expanded like the backup paths
+//   - profile("name"): true when the profile is selected, see selectProfiles
+//   - tag("name"): true when the tag was passed with --tag
+var conditionFunctions = map[string]conditionFunction{
+	"admin": {0, func(scope conditionScope, _ []any) (any, error) {
+		return scope.conditions.admin(scope.ctx), nil
+	}},
+	"build": {0, func(scope conditionScope, _ []any) (any, error) {
+		return float64(scope.conditions.windowsBuild()), nil
+	}},
+	"hostname": {0, func(_ conditionScope, _ []any) (any, error) {
+		hostname, _ := os.Hostname()
+		return hostname, nil
+	}},
+	"env": {1, func(scope conditionScope, args []any) (any, error) {
+		name, err := stringArg("env", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		value, _ := scope.conditions.lookupEnv(name)
+		return value, nil
+	}},
+	"exists": {1, func(_ conditionScope, args []any) (any, error) {
+		path, err := stringArg("exists", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		path, err = PathExpander.Expand(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return IsPathExists(path), nil
+	}},
+	"profile": {1, func(scope conditionScope, args []any) (any, error) {
+		name, err := stringArg("profile", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return slices.ContainsFunc(scope.profiles, func(p string) bool { return strings.EqualFold(p, name) }), nil
+	}},
+	"tag": {1, func(_ conditionScope, args []any) (any, error) {
+		name, err := stringArg("tag", args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return slices.ContainsFunc(Options.Tags, func(t string) bool { return strings.EqualFold(t, name) }), nil
+	}},
+}
+
+// Check evaluates a "when" expression
+//   - profiles: the names of the selected profiles, see ConfigYamlType.ActiveProfiles
+//   - The commands run by the functions, e.g. admin, are stopped when the context is done
+//
+// Returns:
+//   - true if the expression is empty or true
+//   - An error of kind ErrConfig if the expression is invalid, or the error of a function
+func (conditions *conditions) Check(ctx context.Context, expr string, profiles []string) (bool, error) {
+	if strings.TrimSpace(expr) == "" {
+		return true, nil
+	}
+
+	node, err := parseCondition(expr)
+	if err != nil {
+		return false, NewError(ErrConfig, `invalid condition "%s": %s`, expr, err.Error())
+	}
+
+	value, err := node.eval(conditionScope{ctx: ctx, conditions: conditions, profiles: profiles})
+	if err != nil {
+		return false, fmt.Errorf(`failed to evaluate the condition "%s": %w`, expr, err)
+	}
+
+	return truthy(value), nil
+}
+
+// admin reports whether the current user has admin privileges, see powershell.IsAdmin
+//   - The answer of a check stopped by the context is not cached
+func (conditions *conditions) admin(ctx context.Context) bool {
+	if conditions.isAdmin != nil {
+		return *conditions.isAdmin
+	}
+
+	isAdmin := Powershell.IsAdmin(ctx)
+	if ctx.Err() == nil {
+		conditions.isAdmin = &isAdmin
+	}
+
+	return isAdmin
+}
+
+// windowsBuild returns the Windows build number, see windowsBuildNumber
+func (conditions *conditions) windowsBuild() int {
+	if conditions.build == nil {
+		build := windowsBuildNumber()
+		conditions.build = &build
+	}
+
+	return *conditions.build
+}
+
+// validateCondition checks the syntax of a "when" expression without evaluating it
+func validateCondition(expr string) error {
+	if strings.TrimSpace(expr) == "" {
+		return nil
+	}
+
+	if _, err := parseCondition(expr); err != nil {
+		return fmt.Errorf(`invalid condition "%s": %s`, expr, err.Error())
+	}
+
+	return nil
+}
+
+// conditionNode is a node of a parsed "when" expression
+type conditionNode interface {
+	eval(scope conditionScope) (any, error)
+}
+
+type literalNode struct {
+	value any
+}
+
+type notNode struct {
+	operand conditionNode
+}
+
+type binaryNode struct {
+	op          string
+	left, right conditionNode
+}
+
+type callNode struct {
+	name string
+	args []conditionNode
+}
+
+func (n literalNode) eval(conditionScope) (any, error) {
+	return n.value, nil
+}
+
+func (n notNode) eval(scope conditionScope) (any, error) {
+	value, err := n.operand.eval(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return !truthy(value), nil
+}
+
+func (n binaryNode) eval(scope conditionScope) (any, error) {
+	left, err := n.left.eval(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	// && and || stop as soon as the result is known
+	switch n.op {
+	case "&&":
+		if !truthy(left) {
+			return false, nil
+		}
+	case "||":
+		if truthy(left) {
+			return true, nil
+		}
+	}
+
+	right, err := n.right.eval(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op == "&&" || n.op == "||" {
+		return truthy(right), nil
+	}
+
+	return compareValues(n.op, left, right)
+}
+
+func (n callNode) eval(scope conditionScope) (any, error) {
+	args := make([]any, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(scope)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+
+	return conditionFunctions[n.name].call(scope, args)
+}
+
+// truthy converts a value to a boolean, an empty string, 0 and false are false
+func truthy(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+
+	return false
+}
+
+// compareValues compares two values of the same type, strings and booleans only support == and !=
+func compareValues(op string, left, right any) (bool, error) {
+	if typeName(left) != typeName(right) {
+		return false, fmt.Errorf(`cannot compare a %s with a %s`, typeName(left), typeName(right))
+	}
+
+	switch op {
+	case "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	}
+
+	l, isNumber := left.(float64)
+	if !isNumber {
+		return false, fmt.Errorf(`cannot use "%s" with a %s`, op, typeName(left))
+	}
+	r := right.(float64)
+
+	switch op {
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	default:
+		return l >= r, nil
+	}
+}
+
+// typeName returns the name of the type of a value for the error messages
+func typeName(value any) string {
+	switch value.(type) {
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	default:
+		return "string"
+	}
+}
+
+// stringArg returns a function argument that must be a string
+func stringArg(function string, arg any) (string, error) {
+	str, isString := arg.(string)
+	if !isString {
+		return "", fmt.Errorf(`%s() expects a string, got a %s`, function, typeName(arg))
+	}
+
+	return str, nil
+}
+
+// conditionToken is a token of a "when" expression
+type conditionToken struct {
+	kind  string // "ident", "number", "string", "op" or "end"
+	text  string
+	value any
+	pos   int
+}
+
+// conditionOperators lists the operators, the longer ones first
+var conditionOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", ","}
+
+// tokenizeCondition splits a "when" expression into tokens
+//   - Double quoted strings support the \" and \\ escapes, single quoted strings are read as is
+func tokenizeCondition(expr string) ([]conditionToken, error) {
+	var tokens []conditionToken
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, conditionToken{kind: "ident", text: string(runes[start:i]), pos: start})
+
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			number, err := strconv.ParseFloat(string(runes[start:i]), 64)
+			if err != nil {
+				return nil, fmt.Errorf(`invalid number "%s" at position %d`, string(runes[start:i]), start+1)
+			}
+			tokens = append(tokens, conditionToken{kind: "number", text: string(runes[start:i]), value: number, pos: start})
+
+		case r == '"' || r == '\'':
+			start := i
+			var str strings.Builder
+			for i++; i < len(runes) && runes[i] != r; i++ {
+				if r == '"' && runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+					i++
+				}
+				str.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf(`unterminated string at position %d`, start+1)
+			}
+			i++
+			tokens = append(tokens, conditionToken{kind: "string", text: string(runes[start:i]), value: str.String(), pos: start})
+
+		default:
+			op := ""
+			for _, candidate := range conditionOperators {
+				if strings.HasPrefix(string(runes[i:]), candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf(`unexpected "%c" at position %d`, r, i+1)
+			}
+			tokens = append(tokens, conditionToken{kind: "op", text: op, pos: i})
+			i += len([]rune(op))
+		}
+	}
+
+	return append(tokens, conditionToken{kind: "end", pos: len(runes)}), nil
+}
+
+// conditionParser reads a "when" expression, from the lowest to the highest precedence:
+//   - or: and ("||" and)*
+//   - and: comparison ("&&" comparison)*
+//   - comparison: unary (("==" | "!=" | "<" | "<=" | ">" | ">=") unary)?
+//   - unary: "!" unary | primary
+//   - primary: number | string | "(" or ")" | function ("(" arguments ")")?
+type conditionParser struct {
+	tokens []conditionToken
+	pos    int
+}
+
+// parseCondition parses a "when" expression, the functions and their number of arguments are checked
+func parseCondition(expr string) (conditionNode, error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &conditionParser{tokens: tokens}
+
+	node, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if token := parser.peek(); token.kind != "end" {
+		return nil, parser.unexpected(token)
+	}
+
+	return node, nil
+}
+
+func (p *conditionParser) peek() conditionToken {
+	return p.tokens[p.pos]
+}
+
+func (p *conditionParser) next() conditionToken {
+	token := p.tokens[p.pos]
+	if token.kind != "end" {
+		p.pos++
+	}
+	return token
+}
+
+// accept consumes the next token if it is the given operator
+func (p *conditionParser) accept(op string) bool {
+	if token := p.peek(); token.kind == "op" && token.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *conditionParser) unexpected(token conditionToken) error {
+	if token.kind == "end" {
+		return fmt.Errorf("unexpected end of the expression")
+	}
+	return fmt.Errorf(`unexpected "%s" at position %d`, token.text, token.pos+1)
+}
+
+func (p *conditionParser) parseOr() (conditionNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: "||", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *conditionParser) parseAnd() (conditionNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("&&") {
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: "&&", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *conditionParser) parseComparison() (conditionNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.accept(op) {
+			right, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return binaryNode{op: op, left: left, right: right}, nil
+		}
+	}
+
+	return left, nil
+}
+
+func (p *conditionParser) parseUnary() (conditionNode, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *conditionParser) parsePrimary() (conditionNode, error) {
+	token := p.next()
+
+	switch token.kind {
+	case "number", "string":
+		return literalNode{value: token.value}, nil
+
+	case "ident":
+		return p.parseCall(token)
+
+	case "op":
+		if token.text == "(" {
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.accept(")") {
+				return nil, p.unexpected(p.peek())
+			}
+			return node, nil
+		}
+	}
+
+	return nil, p.unexpected(token)
+}
+
+// parseCall reads a function call, the parentheses are optional for the functions without arguments
+func (p *conditionParser) parseCall(name conditionToken) (conditionNode, error) {
+	switch name.text {
+	case "true":
+		return literalNode{value: true}, nil
+	case "false":
+		return literalNode{value: false}, nil
+	}
+
+	function, found := conditionFunctions[name.text]
+	if !found {
+		return nil, fmt.Errorf(`unknown function "%s" at position %d`, name.text, name.pos+1)
+	}
+
+	call := callNode{name: name.text}
+
+	if p.accept("(") {
+		for !p.accept(")") {
+			if len(call.args) > 0 && !p.accept(",") {
+				return nil, p.unexpected(p.peek())
+			}
+
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+		}
+	}
+
+	if len(call.args) != function.params {
+		return nil, fmt.Errorf(`%s() expects %d argument(s), got %d`, name.text, function.params, len(call.args))
+	}
+
+	return call, nil
+}
@@ -0,0 +1,209 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testConditions returns a conditions evaluator with fixed environment variables, admin privileges and Windows build
+func testConditions() *conditions {
+	env := map[string]string{
+		"EDITOR": "code",
+		"EMPTY":  "",
+		"QUOTES": `it's "quoted"`,
+	}
+	isAdmin := true
+	build := 22631
+
+	return &conditions{
+		lookupEnv: func(key string) (string, bool) {
+			value, ok := env[key]
+			return value, ok
+		},
+		isAdmin: &isAdmin,
+		build:   &build,
+	}
+}
+
+func TestConditionsCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want bool
+	}{
+		{"empty", ``, true},
+		{"blank", `   `, true},
+		{"true", `true`, true},
+		{"false", `false`, false},
+		{"function without parentheses", `admin`, true},
+		{"function with parentheses", `admin()`, true},
+		{"number comparison", `build >= 22000`, true},
+		{"number comparison false", `build < 22000`, false},
+		{"decimal number", `build > 22630.5`, true},
+		{"number truthy", `1`, true},
+		{"zero falsy", `0`, false},
+		{"string truthy", `"x"`, true},
+		{"empty string falsy", `""`, false},
+
+		// precedence
+		{"not binds tighter than and", `!false && true`, true},
+		{"not binds tighter than comparison", `!admin == false`, true},
+		{"and binds tighter than or", `true || false && false`, true},
+		{"and binds tighter than or on the left", `false && false || true`, true},
+		{"parentheses", `(true || false) && false`, false},
+		{"nested parentheses", `!((false || admin) && build == 22631)`, false},
+		{"double not", `!!admin`, true},
+		{"comparison before and", `build > 1 && env("EDITOR") == "code"`, true},
+
+		// quoting
+		{"double quotes", `env("EDITOR") == "code"`, true},
+		{"single quotes", `env('EDITOR') == 'code'`, true},
+		{"single quote inside double quotes", `env("QUOTES") == "it's \"quoted\""`, true},
+		{"double quote inside single quotes", `env('QUOTES') == 'it' || false`, false},
+		{"operators inside a string", `"a && b || !c" != ""`, true},
+		{"escaped backslash", `"a\\b" == 'a\b'`, true},
+		{"single quotes read as is", `'a\\b' == "a\\\\b"`, true},
+
+		// functions
+		{"unset variable is empty", `env("NOPE") == ""`, true},
+		{"empty variable falsy", `env("EMPTY")`, false},
+		{"profile", `profile("Work")`, true},
+		{"profile not selected", `profile("home")`, false},
+		{"string inequality", `env("EDITOR") != "vim"`, true},
+		{"boolean equality", `admin == true`, true},
+		{"short-circuit and", `false && env(1)`, false},
+		{"short-circuit or", `true || env(1)`, true},
+	}
+
+	conditions := testConditions()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := conditions.Check(context.Background(), test.expr, []string{"work"})
+			if err != nil {
+				t.Fatalf("Check(%q) returned an error: %v", test.expr, err)
+			}
+			if got != test.want {
+				t.Errorf("Check(%q) = %v, want %v", test.expr, got, test.want)
+			}
+		})
+	}
+}
+
+func TestConditionsCheckInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		err  string
+	}{
+		{"unknown identifier", `nope`, `unknown function "nope" at position 1`},
+		{"unknown function", `admin && nope("x")`, `unknown function "nope" at position 10`},
+		{"identifier case", `Admin`, `unknown function "Admin"`},
+		{"missing argument", `env()`, `env() expects 1 argument(s), got 0`},
+		{"too many arguments", `env("A", "B")`, `env() expects 1 argument(s), got 2`},
+		{"argument of a function without", `admin(1)`, `admin() expects 0 argument(s), got 1`},
+		{"missing comma", `env("A" "B")`, `unexpected ""B"" at position 9`},
+		{"unterminated double quote", `env("A) == 'x'`, `unterminated string at position 5`},
+		{"unterminated single quote", `'abc`, `unterminated string at position 1`},
+		{"escaped closing quote", `"abc\"`, `unterminated string at position 1`},
+		{"invalid number", `build > 1.2.3`, `invalid number "1.2.3" at position 9`},
+		{"unexpected character", `admin & true`, `unexpected "&" at position 7`},
+		{"assignment", `build = 1`, `unexpected "=" at position 7`},
+		{"dollar sign", `$env:PATH`, `unexpected "$" at position 1`},
+		{"open parenthesis", `(`, `unexpected end of the expression`},
+		{"unclosed parenthesis", `(admin`, `unexpected end of the expression`},
+		{"unclosed call", `env("A"`, `unexpected end of the expression`},
+		{"extra closing parenthesis", `admin)`, `unexpected ")" at position 6`},
+		{"empty parentheses", `()`, `unexpected ")" at position 2`},
+		{"trailing and", `admin &&`, `unexpected end of the expression`},
+		{"leading or", `|| admin`, `unexpected "||" at position 1`},
+		{"lone comparison", `==`, `unexpected "==" at position 1`},
+		{"missing right operand", `build >`, `unexpected end of the expression`},
+		{"chained comparison", `1 < 2 < 3`, `unexpected "<" at position 7`},
+		{"lone not", `!`, `unexpected end of the expression`},
+		{"lone comma", `,`, `unexpected "," at position 1`},
+		{"two values", `admin admin`, `unexpected "admin" at position 7`},
+	}
+
+	conditions := testConditions()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := conditions.Check(context.Background(), test.expr, nil)
+			if err == nil {
+				t.Fatalf("Check(%q) = %v, want an error", test.expr, got)
+			}
+			if !errors.Is(err, ErrConfig) {
+				t.Errorf("Check(%q) error is not ErrConfig: %v", test.expr, err)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Check(%q) error = %q, want it to contain %q", test.expr, err.Error(), test.err)
+			}
+			if err := validateCondition(test.expr); err == nil {
+				t.Errorf("validateCondition(%q) returned no error", test.expr)
+			}
+		})
+	}
+}
+
+func TestConditionsCheckEvalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		err  string
+	}{
+		{"string and number", `env("EDITOR") == 1`, `cannot compare a string with a number`},
+		{"boolean and string", `admin != "true"`, `cannot compare a boolean with a string`},
+		{"ordering strings", `"a" < "b"`, `cannot use "<" with a string`},
+		{"ordering booleans", `true >= false`, `cannot use ">=" with a boolean`},
+		{"number argument", `env(1)`, `env() expects a string, got a number`},
+		{"boolean argument", `profile(admin)`, `profile() expects a string, got a boolean`},
+	}
+
+	conditions := testConditions()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := validateCondition(test.expr); err != nil {
+				t.Fatalf("validateCondition(%q) returned an error: %v", test.expr, err)
+			}
+
+			got, err := conditions.Check(context.Background(), test.expr, nil)
+			if err == nil {
+				t.Fatalf("Check(%q) = %v, want an error", test.expr, got)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Check(%q) error = %q, want it to contain %q", test.expr, err.Error(), test.err)
+			}
+		})
+	}
+}
+
+func TestConditionsTag(t *testing.T) {
+	tags := Options.Tags
+	Options.Tags = []string{"Laptop"}
+	t.Cleanup(func() { Options.Tags = tags })
+
+	conditions := testConditions()
+	for expr, want := range map[string]bool{`tag("laptop")`: true, `tag("desktop")`: false, `!tag("desktop")`: true} {
+		got, err := conditions.Check(context.Background(), expr, nil)
+		if err != nil {
+			t.Fatalf("Check(%q) returned an error: %v", expr, err)
+		}
+		if got != want {
+			t.Errorf("Check(%q) = %v, want %v", expr, got, want)
+		}
+	}
+}
+
+func TestConditionsAdminCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	conditions := &conditions{lookupEnv: func(string) (string, bool) { return "", false }}
+	if got, err := conditions.Check(ctx, "admin", nil); err != nil || got {
+		t.Errorf("Check(admin) with a cancelled context = %v, %v, want false", got, err)
+	}
+	if conditions.isAdmin != nil {
+		t.Error("the admin check stopped by the context was cached")
+	}
+}
@@ -0,0 +1,432 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// ConfigYamlType defines the structure of the config YAML file
+//   - The "description", "enum" and "required" tags are used to generate the JSON schema of the config file
+type ConfigYamlType struct {
+	Include              []string                `yaml:"include,omitempty" description:"Other config files to merge into this one, relative paths are resolved against this file"`
+	Vars                 map[string]string       `yaml:"vars,omitempty" description:"Variables used as ${name} in the other string values, overridable with --var name=value or the WIN_TOOLS_VAR_name environment variable, write $${name} for a literal ${name}, an undefined ${name} is left as is in the scripts"`
+	Backup               BackupConfig            `yaml:"backup,omitempty" description:"Files and folders to backup and restore"`
+	EnvironmentVariables []EnvironmentVariable   `yaml:"environmentVariables,omitempty" description:"A list of environment variables to be set"`
+	Packages             []PackageEntry          `yaml:"packages,omitempty" description:"A list of packages to be installed using Chocolatey"`
+	Scripts              []ScriptEntry           `yaml:"scripts,omitempty" description:"A list of scripts to be executed, plain strings starting with \"powershell\" run in PowerShell, the others in cmd"`
+	Snippets             map[string]SnippetEntry `yaml:"snippets,omitempty" description:"Reusable scripts with parameters, run by the scripts with \"use\" and \"with\", may be declared in an included file"`
+	Apply                ApplyConfig             `yaml:"apply,omitempty" description:"Options of the apply command"`
+	Profiles             []ProfileConfig         `yaml:"profiles,omitempty" description:"Overlays merged into the config when they are selected by hostname, tag or the --profile flag"`
+
+	// Origins records the file each entry of a merged config came from
+	Origins []ConfigOrigin `yaml:"-"`
+
+	// ActiveProfiles holds the names of the profiles merged into the config
+	ActiveProfiles []string `yaml:"-"`
+}
+
+// BackupConfig defines the "backup" section of the config file
+type BackupConfig struct {
+	Paths     []BackupPath    `yaml:"paths,omitempty" description:"Files and folders paths to backup, may contain environment variables like %USERNAME%, %VAR:-default% or $env:VAR, known folders like {Documents} and ~ for the home directory"`
+	Target    string          `yaml:"target,omitempty" description:"Backup/restore paths to/from this folder, expanded like the paths, each backup creates a snapshot folder in it named by the time and the hostname, the paths are stored under their drive and full path, e.g. C/Users/me/config"`
+	Flat      bool            `yaml:"flat,omitempty" description:"Back up into the target folder itself, replacing the previous backup, instead of a new snapshot folder"`
+	Format    string          `yaml:"format,omitempty" enum:"folder,zip,tar.gz" description:"Copy the files into a folder, or stream them into a single zip or tar.gz archive, folder when omitted"`
+	Retention BackupRetention `yaml:"retention,omitempty" description:"Which snapshots to keep, the others are deleted after each backup and by \"win-tools backup prune\", all snapshots are kept when omitted"`
+
+	// ignore holds the patterns of the .wintoolsignore file next to the config file, excluded from every path
+	ignore []string
+}
+
+// Filter returns the filter selecting the files of a backup path, with its patterns and the ones of the .wintoolsignore file
+func (b BackupConfig) Filter(entry BackupPath) (*BackupFilter, error) {
+	return NewBackupFilter(entry.Include, append(slices.Clone(b.ignore), entry.Exclude...))
+}
+
+// IgnoreFilter returns the filter of the .wintoolsignore file, for the backed up paths missing from the config file
+func (b BackupConfig) IgnoreFilter() *BackupFilter {
+	filter, _ := NewBackupFilter(nil, b.ignore) // checked by LoadIgnoreFile
+
+	return filter
+}
+
+// BackupRetention defines the "backup.retention" section of the config file
+//   - A snapshot is kept when at least one of the rules keeps it, the rules apply to the snapshots of each host separately
+type BackupRetention struct {
+	Last    int `yaml:"last,omitempty" description:"Keep the last N snapshots"`
+	Daily   int `yaml:"daily,omitempty" description:"Keep the newest snapshot of each of the last N days having snapshots"`
+	Weekly  int `yaml:"weekly,omitempty" description:"Keep the newest snapshot of each of the last N weeks having snapshots"`
+	Monthly int `yaml:"monthly,omitempty" description:"Keep the newest snapshot of each of the last N months having snapshots"`
+}
+
+// IsSet reports whether at least one retention rule is set
+func (r BackupRetention) IsSet() bool {
+	return r != BackupRetention{}
+}
+
+// validate checks the values of the retention rules
+func (r BackupRetention) validate() error {
+	if r.Last < 0 || r.Daily < 0 || r.Weekly < 0 || r.Monthly < 0 {
+		return fmt.Errorf("the retention counts must not be negative")
+	}
+
+	return nil
+}
+
+// BackupPath defines an entry of "backup.paths" in the config file
+//   - A plain string is the path itself
+type BackupPath struct {
+	Path    string   `yaml:"path" required:"true" description:"File or folder path to backup"`
+	When    string   `yaml:"when,omitempty" description:"Condition deciding whether the entry is applied, e.g. admin && build >= 22000 && !env(\"CI\"), functions: admin, build, hostname, env(\"NAME\"), exists(\"path\"), profile(\"name\"), tag(\"name\")"`
+	Include []string `yaml:"include,omitempty" description:"Glob patterns of the files to back up, relative to the path, all files when omitted, e.g. src/** or *.json, ** matches any number of folders"`
+	Exclude []string `yaml:"exclude,omitempty" description:"Glob patterns of the files and folders to skip, added to the ones of the .wintoolsignore file next to the config file, e.g. node_modules, .git/objects or **/bin/obj"`
+
+	// plain is set when the entry was written as a string, to print it back the same way
+	plain bool
+
+	// written is the path as written in the config file, before its variables are interpolated, see Entry
+	written string
+}
+
+// Entry returns the path as written in the config file, it finds the path in a backup made where its variables had other values
+//   - e.g. "%USERPROFILE%\.gitconfig" backed up by one user is restored to the profile of another one, see BackupManifest.Entries
+func (b BackupPath) Entry() string {
+	if b.written != "" {
+		return b.written
+	}
+
+	return b.Path
+}
+
+// JSONSchema describes a backup path, either a string or an object
+func (BackupPath) JSONSchema() *Schema {
+	type object BackupPath
+
+	return &Schema{
+		OneOf: []*Schema{
+			{Type: "string", Description: "File or folder path to backup"},
+			GenerateSchema(reflect.TypeOf(object{})),
+		},
+	}
+}
+
+// UnmarshalYAML reads a backup path from a string or an object
+func (b *BackupPath) UnmarshalYAML(unmarshal func(any) error) error {
+	var str string
+	if err := unmarshal(&str); err == nil {
+		*b = BackupPath{Path: str, plain: true, written: str}
+		return nil
+	}
+
+	type object BackupPath
+	if err := unmarshal((*object)(b)); err != nil {
+		return err
+	}
+
+	b.written = b.Path
+	return nil
+}
+
+// MarshalYAML writes a backup path back the way it was read
+func (b BackupPath) MarshalYAML() (any, error) {
+	if b.plain {
+		return b.Path, nil
+	}
+
+	type object BackupPath
+	return object(b), nil
+}
+
+// EnvironmentVariable defines an entry of the "environmentVariables" section of the config file
+type EnvironmentVariable struct {
+	Key   string `yaml:"key" required:"true" description:"Name of the environment variable, the value of PATH is appended to the current one"`
+	Value string `yaml:"value" description:"Value of the environment variable, expanded like the backup paths, may be encrypted with \"win-tools secrets encrypt\""`
+	Scope string `yaml:"scope" required:"true" enum:"User,Machine" description:"User or Machine (needs admin privileges)"`
+	When  string `yaml:"when,omitempty" description:"Condition deciding whether the entry is applied, e.g. admin && build >= 22000 && !env(\"CI\"), functions: admin, build, hostname, env(\"NAME\"), exists(\"path\"), profile(\"name\"), tag(\"name\")"`
+}
+
+// ApplyConfig defines the "apply" section of the config file
+type ApplyConfig struct {
+	Order   []string `yaml:"order,omitempty" enum:"backup,restore,environmentVariables,packages,scripts" description:"The sections to apply in order"`
+	OnError string   `yaml:"onError,omitempty" enum:"stop,continue" description:"Whether to stop or continue applying the next sections when one fails"`
+}
+
+// ProfileConfig defines an entry of the "profiles" section of the config file
+//   - The sections of a profile are merged into the config the same way as an included file
+type ProfileConfig struct {
+	Name                 string                `yaml:"name" required:"true" description:"Name of the profile, used by the --profile flag"`
+	Hostnames            []string              `yaml:"hostnames,omitempty" description:"Select this profile on the machines whose hostname matches one of these patterns, * and ? are wildcards"`
+	Tags                 []string              `yaml:"tags,omitempty" description:"Select this profile on the machines tagged with one of these tags using the --tag flag"`
+	Vars                 map[string]string     `yaml:"vars,omitempty" description:"Variables used as ${name} in the other string values"`
+	Backup               BackupConfig          `yaml:"backup,omitempty" description:"Files and folders to backup and restore"`
+	EnvironmentVariables []EnvironmentVariable `yaml:"environmentVariables,omitempty" description:"A list of environment variables to be set"`
+	Packages             []PackageEntry        `yaml:"packages,omitempty" description:"A list of packages to be installed using Chocolatey"`
+	Scripts              []ScriptEntry         `yaml:"scripts,omitempty" description:"A list of scripts to be executed"`
+	Apply                ApplyConfig           `yaml:"apply,omitempty" description:"Options of the apply command"`
+
+	// file is the config file the profile was declared in
+	file string
+}
+
+// ReadConfigFile reads and unmarshal the config file of type YAML
+//   - Every file is validated against the config schema first, unknown keys are errors
+//   - The files listed in "include" are merged into the config, see mergeConfig for the merge rules
+//   - The selected profiles are merged last, see selectProfiles
+//   - The ${name} variables are replaced, see interpolateConfig
+//   - When decrypt is true, the encrypted values are decrypted in memory once the variables are replaced, see decryptSecrets
+//   - The scripts using a snippet are expanded once the variables are replaced, see expandSnippets
+//   - The entries are validated once the variables are replaced, see validateEntries
+//
+// Returns:
+//   - ConfigYamlType
+//   - An error of kind ErrConfig listing every problem if a file cannot be read, is invalid or includes itself
+func ReadConfigFile(path string, decrypt bool) (ConfigYamlType, error) {
+	var config ConfigYamlType
+
+	if err := includeConfigFile(&config, path, nil, map[string]bool{}); err != nil {
+		return config, err
+	}
+
+	config.Include = nil
+
+	ignore, err := LoadIgnoreFile(filepath.Join(filepath.Dir(path), IgnoreFileName))
+	if err != nil {
+		return config, NewError(ErrConfig, "%s", err.Error())
+	}
+	config.Backup.ignore = ignore
+
+	if err := applyProfiles(&config); err != nil {
+		return config, err
+	}
+
+	// the secrets are decrypted around the interpolation so their content is never read as ${name},
+	// the encrypted variables are decrypted first and used literally
+	literal := secretVarNames(config.Vars)
+	if decrypt {
+		if err := decryptSecrets(reflect.ValueOf(&config.Vars).Elem(), "vars", nil); err != nil {
+			return config, err
+		}
+	}
+
+	if err := interpolateConfig(&config, literal); err != nil {
+		return config, err
+	}
+
+	if decrypt {
+		if err := decryptSecrets(reflect.ValueOf(&config).Elem(), "", []string{"vars"}); err != nil {
+			return config, err
+		}
+	}
+
+	if err := expandSnippets(&config); err != nil {
+		return config, err
+	}
+
+	if err := validateEntries(config); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+// includeConfigFile merges a config file and its includes into the given config
+//   - Included files are merged first, in order, so the including file has the last word
+//   - A file included more than once is only merged the first time
+//   - stack holds the absolute paths of the files currently being included, to detect cycles
+//   - merged holds the lower cased absolute paths of the files already merged
+func includeConfigFile(config *ConfigYamlType, path string, stack []string, merged map[string]bool) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return NewError(ErrConfig, `failed to resolve config file path: "%s"`, path)
+	}
+
+	for _, visited := range stack {
+		if strings.EqualFold(visited, absPath) {
+			return NewError(ErrConfig, "include cycle detected: %s", strings.Join(append(stack, absPath), " -> "))
+		}
+	}
+	stack = append(stack, absPath)
+
+	if merged[strings.ToLower(absPath)] {
+		return nil
+	}
+
+	file, err := readSingleConfigFile(absPath)
+	if err != nil {
+		return err
+	}
+
+	for _, include := range file.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(absPath), include)
+		}
+
+		if err := includeConfigFile(config, include, stack, merged); err != nil {
+			return err
+		}
+	}
+
+	mergeConfig(config, file, source{File: absPath})
+	merged[strings.ToLower(absPath)] = true
+
+	return nil
+}
+
+// readSingleConfigFile reads, validates and unmarshal a single config file without resolving its includes
+func readSingleConfigFile(path string) (ConfigYamlType, error) {
+	var config ConfigYamlType
+
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return config, NewError(ErrConfig, `failed to read config file: "%s"`, path)
+	}
+
+	problems, err := ValidateYaml(dat, ConfigSchema())
+	if err != nil {
+		return config, NewError(ErrConfig, "failed to parse config file: \"%s\"\n%s", path, err.Error())
+	}
+	if len(problems) > 0 {
+		return config, NewError(ErrConfig, "invalid config file: \"%s\"\n%s", path, FormatValidationErrors(path, problems))
+	}
+
+	file, err := parser.ParseBytes(dat, 0)
+	if err != nil {
+		return config, NewError(ErrConfig, "failed to parse config file: \"%s\"\n%s", path, yaml.FormatError(err, false, true))
+	}
+	if len(file.Docs) == 0 || file.Docs[0].Body == nil {
+		return config, nil
+	}
+
+	resolveSecretTags(file.Docs[0].Body)
+
+	if err := yaml.NodeToValue(file.Docs[0].Body, &config, yaml.DisallowUnknownField()); err != nil {
+		return config, NewError(ErrConfig, "failed to unmarshal config file: \"%s\"\n%s", path, yaml.FormatError(err, false, true))
+	}
+
+	// the relative paths of the scripts are resolved against the file declaring them
+	for i := range config.Scripts {
+		config.Scripts[i].dir = filepath.Dir(path)
+	}
+	for _, profile := range config.Profiles {
+		for i := range profile.Scripts {
+			profile.Scripts[i].dir = filepath.Dir(path)
+		}
+	}
+	for name, snippet := range config.Snippets {
+		snippet.dir = filepath.Dir(path)
+		config.Snippets[name] = snippet
+	}
+
+	// the scripts with the same id are merged into one, so a file cannot declare an id twice
+	if err := checkScriptIDs(config.Scripts); err != nil {
+		return config, NewError(ErrConfig, "invalid config file: \"%s\"\nscripts: %s", path, err.Error())
+	}
+	for _, profile := range config.Profiles {
+		if err := checkScriptIDs(profile.Scripts); err != nil {
+			return config, NewError(ErrConfig, "invalid config file: \"%s\"\nprofile \"%s\" scripts: %s", path, profile.Name, err.Error())
+		}
+	}
+
+	return config, nil
+}
+
+// validateEntries checks the values of the entries which cannot be checked by the config schema
+//
+// Returns: an error of kind ErrConfig listing every invalid entry
+func validateEntries(config ConfigYamlType) error {
+	var problems []string
+
+	for i, path := range config.Backup.Paths {
+		if err := validateCondition(path.When); err != nil {
+			problems = append(problems, fmt.Sprintf("backup.paths[%d]: %s", i, err.Error()))
+		}
+		if _, err := config.Backup.Filter(path); err != nil {
+			problems = append(problems, fmt.Sprintf("backup.paths[%d]: %s", i, err.Error()))
+		}
+	}
+
+	if err := config.Backup.Retention.validate(); err != nil {
+		problems = append(problems, "backup.retention: "+err.Error())
+	}
+
+	for i, env := range config.EnvironmentVariables {
+		if err := validateCondition(env.When); err != nil {
+			problems = append(problems, fmt.Sprintf("environmentVariables[%d]: %s", i, err.Error()))
+		}
+	}
+
+	for i, pkg := range config.Packages {
+		if err := pkg.validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("packages[%d]: %s", i, err.Error()))
+		}
+	}
+
+	for i, script := range config.Scripts {
+		if err := script.validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("scripts[%d]: %s", i, err.Error()))
+		}
+	}
+
+	if _, err := ScriptDependencies(config.Scripts); err != nil {
+		problems = append(problems, "scripts: "+err.Error())
+	}
+
+	if len(problems) > 0 {
+		return NewError(ErrConfig, "invalid config entries:\n%s", strings.Join(problems, "\n"))
+	}
+
+	return nil
+}
+
+// walkStrings calls fn with the YAML path and the value of every string read from YAML, recursively
+//   - The string is replaced with the value returned by fn
+//   - The fields with a YAML name in skip are not walked
+func walkStrings(value reflect.Value, path string, skip []string, fn func(path, value string) string) {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(fn(path, value.String()))
+
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			walkStrings(value.Index(i), fmt.Sprintf("%s[%d]", path, i), skip, fn)
+		}
+
+	case reflect.Map:
+		iter := value.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+
+			// the values of a map are not addressable, they are walked on a copy stored back in the map
+			item := reflect.New(iter.Value().Type()).Elem()
+			item.Set(iter.Value())
+			walkStrings(item, joinYamlPath(path, key), skip, fn)
+			value.SetMapIndex(iter.Key(), item)
+		}
+
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			name := yamlFieldName(value.Type().Field(i))
+			if name == "" || slices.Contains(skip, name) {
+				continue
+			}
+
+			walkStrings(value.Field(i), joinYamlPath(path, name), skip, fn)
+		}
+	}
+}
+
+// FormatValidationErrors formats validation errors as "file:line:column: message", one per line
+func FormatValidationErrors(path string, problems []ValidationError) string {
+	lines := make([]string, len(problems))
+	for i, problem := range problems {
+		lines[i] = fmt.Sprintf("%s:%d:%d: %s", path, problem.Line, problem.Column, problem.Message)
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 )
 
@@ -21,9 +22,19 @@ const (
 //   - If the source is a directory, it will be copied recursively.
 //   - When copying a file, the destination path should not include the file name.
 //   - When copying a directory, the source path will be copied inside the destination path.
+//   - In dry run mode, the copy is printed instead of being performed.
 //
 // Returns: An error if the copy operation fails.
 func Copy(source, destination string) error {
+	return CopyFiltered(source, destination, nil)
+}
+
+// CopyFiltered copies a file or directory like Copy, but only the files selected by the filter.
+//   - The excluded directories are not walked, see BackupFilter.
+//   - The paths matched by the filter are relative to the source, a copied file is matched by its name.
+//
+// Returns: An error if the copy operation fails.
+func CopyFiltered(source, destination string, filter *BackupFilter) error {
 
 	// Check the source path
 	sourcePathType := isDir(source)
@@ -31,20 +42,61 @@ func Copy(source, destination string) error {
 		return errors.New("Copy source file does not exist")
 	}
 
+	if Options.DryRun {
+		Log.DryRun(fmt.Sprintf(`copy "%s" to "%s"`, source, filepath.Join(destination, filepath.Base(source))))
+		return nil
+	}
+
 	// copy a file
 	if sourcePathType == File {
+		if !filter.Included(filepath.Base(source)) {
+			return nil
+		}
 		return copyFile(source, destination)
 	}
 
 	// copy a directory
 	if sourcePathType == Directory {
 		destination = filepath.Join(destination, filepath.Base(source))
-		return copyDirectory(source, destination)
+		return copyDirectory(source, destination, "", filter)
 	}
 
 	return nil
 }
 
+// CopyFilteredAs copies a file or directory like CopyFiltered, but to the destination path itself instead of inside it.
+//   - e.g. the directory "D:\backup\C" copied to "C:\" writes its contents to "C:\", not to "C:\C".
+//   - The paths matched by the filter are relative to the source, a copied file is matched by its name.
+//
+// Returns: An error if the copy operation fails.
+func CopyFilteredAs(source, destination string, filter *BackupFilter) error {
+
+	// Check the source path
+	sourcePathType := isDir(source)
+	if sourcePathType == Unknown {
+		return errors.New("Copy source file does not exist")
+	}
+
+	if Options.DryRun {
+		Log.DryRun(fmt.Sprintf(`copy "%s" to "%s"`, source, destination))
+		return nil
+	}
+
+	// copy a file
+	if sourcePathType == File {
+		if !filter.Included(filepath.Base(source)) {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(destination), os.ModePerm); err != nil {
+			return fmt.Errorf("CopyFile failed to create destination directory: %w", err)
+		}
+		return copyFileTo(source, destination)
+	}
+
+	// copy a directory
+	return copyDirectory(source, destination, "", filter)
+}
+
 // isDir checks if the provided path is a directory, file, or unknown (non-existent).
 func isDir(path string) PathType {
 	info, err := os.Stat(path)
@@ -67,13 +119,6 @@ func isDir(path string) PathType {
 // Returns: An error if the copy operation fails.
 func copyFile(source, destination string) error {
 
-	// Open the source file
-	sourceFile, err := os.Open(source)
-	if err != nil {
-		return fmt.Errorf("CopyFile failed to open source file: %s", source)
-	}
-	defer sourceFile.Close()
-
 	// Check the destination path
 	destinationType := isDir(destination)
 	if destinationType == File {
@@ -87,7 +132,22 @@ func copyFile(source, destination string) error {
 		}
 	}
 
-	destinationFilePath := filepath.Join(destination, filepath.Base(source))
+	return copyFileTo(source, filepath.Join(destination, filepath.Base(source)))
+}
+
+// copyFileTo copies a file from the source to the destination file path.
+//   - The folder of the destination file should exist.
+//   - This function overwrites the destination file if it already exists.
+//
+// Returns: An error if the copy operation fails.
+func copyFileTo(source, destinationFilePath string) error {
+
+	// Open the source file
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("CopyFile failed to open source file: %s", source)
+	}
+	defer sourceFile.Close()
 
 	// Create or overwrite the destination file
 	destinationFile, err := os.Create(destinationFilePath)
@@ -132,9 +192,10 @@ func listEntries(root string) ([]os.DirEntry, error) {
 //   - Both source and destination should be directory paths.
 //   - Overwrites any existing files/directories in the destination directory.
 //   - When looping through the entries, if an error occurs, it will continue to the next entry and return all errors at the end
+//   - Only the files selected by the filter are copied, rel is the path of the directory relative to the copied one.
 //
 // Returns: An error if the copy operation fails.
-func copyDirectory(source, destination string) error {
+func copyDirectory(source, destination, rel string, filter *BackupFilter) error {
 
 	// Check the destination path
 	destinationPathType := isDir(destination)
@@ -158,16 +219,23 @@ func copyDirectory(source, destination string) error {
 	for _, entry := range entries {
 		srcPath := filepath.Join(source, entry.Name())
 		destPath := filepath.Join(destination, entry.Name())
+		entryRel := path.Join(rel, entry.Name())
 
 		// Recursively copy directories
 		if entry.IsDir() {
-			if err := copyDirectory(srcPath, destPath); err != nil {
+			if filter.Excluded(entryRel, true) {
+				continue
+			}
+			if err := copyDirectory(srcPath, destPath, entryRel, filter); err != nil {
 				catchErrors = append(catchErrors, fmt.Errorf("CopyDirectory failed to copy directory '%s': %w", srcPath, err))
 			}
 			continue
 		}
 
 		// Copy files
+		if !filter.Included(entryRel) {
+			continue
+		}
 		if err := copyFile(srcPath, destination); err != nil {
 			catchErrors = append(catchErrors, fmt.Errorf("CopyDirectory failed to copy file '%s': %s", srcPath, err))
 		}
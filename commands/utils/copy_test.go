@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyFilteredAs(t *testing.T) {
+	dir := t.TempDir()
+
+	// the root of the drive "C:\" is backed up under the folder "C"
+	source := filepath.Join(dir, "backup", "C")
+	writeTestFiles(t, source, map[string]string{"a.txt": "a", "Users/me/b.txt": "b", "Users/me/c.log": "c"})
+
+	filter, err := NewBackupFilter(nil, []string{"*.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drive := filepath.Join(dir, "drive")
+	if err := CopyFilteredAs(source, drive, filter); err != nil {
+		t.Fatalf("CopyFilteredAs() returned an error: %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		exists bool
+	}{
+		{"a.txt", true},
+		{"Users/me/b.txt", true},
+		{"Users/me/c.log", false},
+		{"C", false},
+	}
+	for _, test := range tests {
+		if exists := IsPathExists(filepath.Join(drive, filepath.FromSlash(test.path))); exists != test.exists {
+			t.Errorf("%q exists = %v, want %v", test.path, exists, test.exists)
+		}
+	}
+}
+
+func TestCopyFilteredAsFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"backup/config.json": "new", "app/settings.json": "old"})
+
+	destination := filepath.Join(dir, "app", "settings.json")
+	if err := CopyFilteredAs(filepath.Join(dir, "backup", "config.json"), destination, nil); err != nil {
+		t.Fatalf("CopyFilteredAs() returned an error: %v", err)
+	}
+
+	content, err := os.ReadFile(destination)
+	if err != nil || string(content) != "new" {
+		t.Errorf("the copied file = %q, %v, want %q", content, err, "new")
+	}
+	if IsPathExists(filepath.Join(dir, "app", "config.json")) {
+		t.Error("the file was copied under its own name")
+	}
+
+	// a file in a missing folder creates it
+	destination = filepath.Join(dir, "new", "folder", "settings.json")
+	if err := CopyFilteredAs(filepath.Join(dir, "backup", "config.json"), destination, nil); err != nil {
+		t.Fatalf("CopyFilteredAs() returned an error: %v", err)
+	}
+	if !IsPathExists(destination) {
+		t.Error("the file was not copied to a missing folder")
+	}
+}
+
+func TestCopyFilteredAsMissingSource(t *testing.T) {
+	if err := CopyFilteredAs(filepath.Join(t.TempDir(), "nope"), t.TempDir(), nil); err == nil {
+		t.Error("CopyFilteredAs() returned no error for a missing source")
+	}
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/charmbracelet/huh"
+)
+
+// Exit codes of the program, each error kind maps to one of them
+const (
+	ExitOK             = 0
+	ExitFailure        = 1 // unexpected error
+	ExitConfigError    = 2
+	ExitPrivilegeError = 3
+	ExitPartialFailure = 4
+	ExitCancelled      = 5
+	ExitRebootRequired = 6
+)
+
+// Error kinds returned by the commands, use errors.Is to check for them
+var (
+	ErrConfig         = errors.New("config error")
+	ErrPrivilege      = errors.New("privilege error")
+	ErrPartialFailure = errors.New("partial failure")
+	ErrCancelled      = errors.New("cancelled by the user")
+	ErrRebootRequired = errors.New("reboot required")
+)
+
+// CommandError is an error of a known kind returned by a command
+type CommandError struct {
+	Kind error
+	Err  error
+}
+
+func (e *CommandError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *CommandError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// NewError creates a new error of the given kind
+//   - The message is formatted with fmt.Errorf, so "%w" can be used to wrap the cause
+func NewError(kind error, format string, a ...any) error {
+	return &CommandError{Kind: kind, Err: fmt.Errorf(format, a...)}
+}
+
+// PromptError converts the error returned by a prompt into a command error
+//   - The user aborting the prompt is reported as ErrCancelled
+//
+// Returns: nil if err is nil
+func PromptError(err error) error {
+	if errors.Is(err, huh.ErrUserAborted) {
+		return NewError(ErrCancelled, "the prompt was cancelled by the user")
+	}
+
+	return err
+}
+
+// ExitCode maps an error returned by a command to the exit code of the program
+//   - When the error has multiple kinds, the first one in this order wins:
+//     cancelled, config error, privilege error, partial failure, reboot required
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrCancelled):
+		return ExitCancelled
+	case errors.Is(err, ErrConfig):
+		return ExitConfigError
+	case errors.Is(err, ErrPrivilege):
+		return ExitPrivilegeError
+	case errors.Is(err, ErrPartialFailure):
+		return ExitPartialFailure
+	case errors.Is(err, ErrRebootRequired):
+		return ExitRebootRequired
+	default:
+		return ExitFailure
+	}
+}
+
+// ExitCodesHelp describes the exit codes of the program for the help message
+const ExitCodesHelp = `Exit codes:
+  0  success
+  1  unexpected error
+  2  config error (invalid config file, arguments or missing answers)
+  3  privilege error (admin privileges are required)
+  4  partial failure (some of the steps failed)
+  5  cancelled by the user
+  6  success, but a reboot is required`
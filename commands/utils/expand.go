@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+type pathExpander struct {
+	lookupEnv   func(key string) (string, bool)
+	homeDir     func() (string, error)
+	knownFolder func(name string) (string, bool, error)
+}
+
+var PathExpander = &pathExpander{
+	lookupEnv:   os.LookupEnv,
+	homeDir:     os.UserHomeDir,
+	knownFolder: knownFolderPath,
+}
+
+// pathTokenPattern matches, in order of the capture groups:
+//   - %VAR% or %VAR:-default%
+//   - ${env:VAR} or $env:VAR
+//   - {KnownFolder}
+var pathTokenPattern = regexp.MustCompile(`%([A-Za-z_][A-Za-z0-9_().-]*?)(:-[^%]*)?%|\$\{env:([A-Za-z_][A-Za-z0-9_]*)\}|\$env:([A-Za-z_][A-Za-z0-9_]*)|\{([A-Za-z]+)\}`)
+
+// Expand replaces the variables of a path with their values
+//   - "%VAR%" and "$env:VAR" (or "${env:VAR}") are replaced with the value of the environment variable
+//   - "%VAR:-default%" uses the default value when the environment variable is not set or empty
+//   - "~" at the start of the path is replaced with the home directory of the user
+//   - Known folders like "{Desktop}", "{Documents}" or "{LocalAppData}" are replaced with their location, see knownFolders
+//   - Lone "%" characters and unknown "{...}" tokens are kept as is
+//   - The values are not expanded again, so a value containing "%" is kept as is
+//   - The decrypted secrets are kept as is, see Log.Redact
+//
+// Returns: an error of kind ErrConfig listing every undefined variable
+func (expander *pathExpander) Expand(path string) (string, error) {
+	var errs []error
+
+	secrets := redactedSpans(path)
+	inSecret := func(start, end int) bool {
+		return slices.ContainsFunc(secrets, func(span [2]int) bool { return start < span[1] && span[0] < end })
+	}
+
+	if (path == "~" || strings.HasPrefix(path, `~\`) || strings.HasPrefix(path, "~/")) && !inSecret(0, 1) {
+		home, err := expander.homeDir()
+		if err != nil {
+			return path, NewError(ErrConfig, `failed to expand "~" in "%s": %w`, path, err)
+		}
+
+		path = home + path[1:]
+		secrets = redactedSpans(path)
+	}
+
+	var builder strings.Builder
+	last := 0
+	for _, match := range pathTokenPattern.FindAllStringIndex(path, -1) {
+		if inSecret(match[0], match[1]) {
+			continue
+		}
+
+		builder.WriteString(path[last:match[0]])
+		builder.WriteString(expander.expandToken(path[match[0]:match[1]], path, &errs))
+		last = match[1]
+	}
+	builder.WriteString(path[last:])
+
+	return builder.String(), errors.Join(errs...)
+}
+
+// expandToken returns the value of a token of pathTokenPattern found in path, or the token itself with an error in errs
+func (expander *pathExpander) expandToken(token, path string, errs *[]error) string {
+	groups := pathTokenPattern.FindStringSubmatch(token)
+
+	switch {
+	// %VAR% or %VAR:-default%
+	case groups[1] != "":
+		value, ok := expander.lookupEnv(groups[1])
+		if groups[2] != "" && (!ok || value == "") {
+			return strings.TrimPrefix(groups[2], ":-")
+		}
+		if !ok {
+			*errs = append(*errs, NewError(ErrConfig, `undefined environment variable "%s" in "%s"`, groups[1], path))
+			return token
+		}
+		return value
+
+	// ${env:VAR} or $env:VAR
+	case groups[3] != "" || groups[4] != "":
+		name := groups[3] + groups[4]
+		value, ok := expander.lookupEnv(name)
+		if !ok {
+			*errs = append(*errs, NewError(ErrConfig, `undefined environment variable "%s" in "%s"`, name, path))
+			return token
+		}
+		return value
+
+	// {KnownFolder}
+	default:
+		value, known, err := expander.knownFolder(groups[5])
+		if !known {
+			return token
+		}
+		if err != nil {
+			*errs = append(*errs, NewError(ErrConfig, `failed to find the known folder "%s" in "%s": %w`, groups[5], path, err))
+			return token
+		}
+		return value
+	}
+}
+
+// ExpandAll expands every path with Expand
+//
+// Returns:
+//   - The expanded paths, a path that failed to expand is kept as is
+//   - The errors of the paths that failed to expand, joined
+func (expander *pathExpander) ExpandAll(paths []string) ([]string, error) {
+	var errs []error
+
+	expanded := make([]string, len(paths))
+	for i, path := range paths {
+		result, err := expander.Expand(path)
+		if err != nil {
+			errs = append(errs, err)
+			result = path
+		}
+
+		expanded[i] = result
+	}
+
+	return expanded, errors.Join(errs...)
+}
+
+// knownFolders lists the names of the known folders supported in paths, in lower case
+var knownFolders = []string{
+	"home",
+	"desktop",
+	"documents",
+	"downloads",
+	"music",
+	"pictures",
+	"videos",
+	"savedgames",
+	"appdata",
+	"localappdata",
+	"localappdatalow",
+	"programdata",
+	"programfiles",
+	"programfilesx86",
+	"startmenu",
+	"startup",
+	"windows",
+	"system",
+	"public",
+}
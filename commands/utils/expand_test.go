@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testExpander returns a path expander reading fixed environment variables, home directory and known folders
+func testExpander() *pathExpander {
+	env := map[string]string{
+		"A":        `C:\a`,
+		"B":        "b",
+		"EMPTY":    "",
+		"PERCENT":  "100%",
+		"USERNAME": "me",
+	}
+	folders := map[string]string{
+		"desktop":      `C:\Users\me\Desktop`,
+		"documents":    `D:\Docs`,
+		"localappdata": `C:\Users\me\AppData\Local`,
+	}
+
+	return &pathExpander{
+		lookupEnv: func(key string) (string, bool) {
+			value, ok := env[key]
+			return value, ok
+		},
+		homeDir: func() (string, error) { return `C:\Users\me`, nil },
+		knownFolder: func(name string) (string, bool, error) {
+			path, known := folders[strings.ToLower(name)]
+			return path, known, nil
+		},
+	}
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"no tokens", `D:\data`, `D:\data`},
+		{"several percent tokens", `%A%\x\%B%`, `C:\a\x\b`},
+		{"adjacent tokens", `%A%%B%`, `C:\ab`},
+		{"env token", `$env:A\x`, `C:\a\x`},
+		{"braced env token", `${env:B}.txt`, `b.txt`},
+		{"home alone", `~`, `C:\Users\me`},
+		{"home backslash", `~\.gitconfig`, `C:\Users\me\.gitconfig`},
+		{"home slash", `~/.gitconfig`, `C:\Users\me/.gitconfig`},
+		{"tilde not at the start", `D:\~\x`, `D:\~\x`},
+		{"tilde in a name", `~backup`, `~backup`},
+		{"desktop", `{Desktop}\notes.txt`, `C:\Users\me\Desktop\notes.txt`},
+		{"known folder case", `{documents}\x`, `D:\Docs\x`},
+		{"known folder and variable", `{LocalAppData}\%USERNAME%`, `C:\Users\me\AppData\Local\me`},
+		{"unknown folder kept", `{NotAFolder}\x`, `{NotAFolder}\x`},
+		{"default used when unset", `%GAMES:-D:\Games%\saves`, `D:\Games\saves`},
+		{"default used when empty", `%EMPTY:-x%`, `x`},
+		{"default ignored when set", `%B:-x%`, `b`},
+		{"empty default", `%GAMES:-%\saves`, `\saves`},
+		{"lone percent kept", `100% done`, `100% done`},
+		{"value not expanded again", `%PERCENT%B%`, `100%B%`},
+		{"empty path", ``, ``},
+	}
+
+	expander := testExpander()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := expander.Expand(test.path)
+			if err != nil {
+				t.Fatalf("Expand(%q) returned an error: %v", test.path, err)
+			}
+			if got != test.want {
+				t.Errorf("Expand(%q) = %q, want %q", test.path, got, test.want)
+			}
+		})
+	}
+}
+
+func TestExpandUndefined(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		undefined []string
+	}{
+		{"percent token", `%NOPE%\x`, []string{"NOPE"}},
+		{"env token", `$env:NOPE\x`, []string{"NOPE"}},
+		{"braced env token", `${env:NOPE}`, []string{"NOPE"}},
+		{"every undefined variable", `%NOPE1%\%A%\%NOPE2%`, []string{"NOPE1", "NOPE2"}},
+	}
+
+	expander := testExpander()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := expander.Expand(test.path)
+			if err == nil {
+				t.Fatalf("Expand(%q) = %q, want an error", test.path, got)
+			}
+			if !errors.Is(err, ErrConfig) {
+				t.Errorf("Expand(%q) error is not ErrConfig: %v", test.path, err)
+			}
+			for _, name := range test.undefined {
+				if !strings.Contains(err.Error(), `"`+name+`"`) {
+					t.Errorf("Expand(%q) error does not name %q: %v", test.path, name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestExpandAll(t *testing.T) {
+	expanded, err := testExpander().ExpandAll([]string{`%A%`, `%NOPE%`, `~\x`})
+	if err == nil {
+		t.Fatal("ExpandAll returned no error for an undefined variable")
+	}
+
+	want := []string{`C:\a`, `%NOPE%`, `C:\Users\me\x`}
+	for i := range want {
+		if expanded[i] != want[i] {
+			t.Errorf("ExpandAll()[%d] = %q, want %q", i, expanded[i], want[i])
+		}
+	}
+}
+
+func TestExpandKeepsSecrets(t *testing.T) {
+	secret := `~%A%{Desktop}$env:B-expand-test-secret`
+	Log.Redact(secret)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{secret, secret},
+		{`%A%\` + secret + `\%B%`, `C:\a\` + secret + `\b`},
+	}
+
+	expander := testExpander()
+	for _, test := range tests {
+		got, err := expander.Expand(test.path)
+		if err != nil {
+			t.Fatalf("Expand(%q) returned an error: %v", test.path, err)
+		}
+		if got != test.want {
+			t.Errorf("Expand(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+//go:build !windows
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// knownFolderPath returns the location of a known folder, the name is case insensitive
+//   - Outside of Windows, the folders are guessed relative to the home directory
+//
+// Returns:
+//   - The location of the folder
+//   - false if the name is not one of knownFolders
+//   - An error if the home directory is unknown
+func knownFolderPath(name string) (string, bool, error) {
+	name = strings.ToLower(name)
+	if !slices.Contains(knownFolders, name) {
+		return "", false, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", true, err
+	}
+
+	if name == "home" {
+		return home, true, nil
+	}
+
+	return filepath.Join(home, name), true, nil
+}
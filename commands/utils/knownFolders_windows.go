@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// knownFolderIDs maps the names of knownFolders to their Windows known folder IDs
+var knownFolderIDs = map[string]*windows.KNOWNFOLDERID{
+	"home":            windows.FOLDERID_Profile,
+	"desktop":         windows.FOLDERID_Desktop,
+	"documents":       windows.FOLDERID_Documents,
+	"downloads":       windows.FOLDERID_Downloads,
+	"music":           windows.FOLDERID_Music,
+	"pictures":        windows.FOLDERID_Pictures,
+	"videos":          windows.FOLDERID_Videos,
+	"savedgames":      windows.FOLDERID_SavedGames,
+	"appdata":         windows.FOLDERID_RoamingAppData,
+	"localappdata":    windows.FOLDERID_LocalAppData,
+	"localappdatalow": windows.FOLDERID_LocalAppDataLow,
+	"programdata":     windows.FOLDERID_ProgramData,
+	"programfiles":    windows.FOLDERID_ProgramFiles,
+	"programfilesx86": windows.FOLDERID_ProgramFilesX86,
+	"startmenu":       windows.FOLDERID_StartMenu,
+	"startup":         windows.FOLDERID_Startup,
+	"windows":         windows.FOLDERID_Windows,
+	"system":          windows.FOLDERID_System,
+	"public":          windows.FOLDERID_Public,
+}
+
+// knownFolderPath returns the location of a known folder, the name is case insensitive
+//   - Follows folder redirections, e.g. a Desktop moved to OneDrive
+//
+// Returns:
+//   - The location of the folder
+//   - false if the name is not one of knownFolders
+//   - An error if Windows failed to find the folder
+func knownFolderPath(name string) (string, bool, error) {
+	id, ok := knownFolderIDs[strings.ToLower(name)]
+	if !ok {
+		return "", false, nil
+	}
+
+	path, err := windows.KnownFolderPath(id, windows.KF_FLAG_DEFAULT)
+	return path, true, err
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/charmbracelet/lipgloss"
 )
@@ -14,6 +15,7 @@ type logStyles struct {
 	Error        lipgloss.Style
 	Info         lipgloss.Style
 	Log          lipgloss.Style
+	DryRun       lipgloss.Style
 	PaddingStyle lipgloss.Style
 }
 
@@ -28,10 +30,20 @@ var Log = log{
 		Error:        lipgloss.NewStyle().Foreground(lipgloss.Color("#E74C3C")),
 		Info:         lipgloss.NewStyle().Foreground(lipgloss.Color("#5eb9ff")),
 		Log:          lipgloss.NewStyle(),
+		DryRun:       lipgloss.NewStyle().Foreground(lipgloss.Color("#A569BD")),
 		PaddingStyle: lipgloss.NewStyle().Faint(true),
 	},
 }
 
+// redacted holds the values hidden from the log output, see Log.Redact
+var redacted struct {
+	sync.Mutex
+	values []string
+}
+
+// redactedText replaces the redacted values of a string
+const redactedText = "******"
+
 const titleWidth = 13
 const newlineSeparator = "- "
 const newlinePaddingWidth = titleWidth + 3 // titleWidth + "|" + "|" + " "
@@ -64,7 +76,7 @@ func formatTitle(title string, style lipgloss.Style) string {
 func (l log) printLog(title string, style lipgloss.Style, strs ...string) {
 	title = formatTitle(title, style)
 
-	fullString := strings.Join(strs, " ")
+	fullString := redact(strings.Join(strs, " "))
 	leadingNewlines, msg, trailingNewlines := splitOnNewline(fullString)
 
 	split := strings.Split(msg, "\n")
@@ -83,6 +95,68 @@ func (l log) printLog(title string, style lipgloss.Style, strs ...string) {
 	fmt.Println(leadingNewlines+title, content+trailingNewlines)
 }
 
+// redact replaces the values passed to Log.Redact in a string
+func redact(str string) string {
+	redacted.Lock()
+	defer redacted.Unlock()
+
+	for _, value := range redacted.values {
+		str = strings.ReplaceAll(str, value, redactedText)
+	}
+
+	return str
+}
+
+// redactedSpans returns the byte ranges of the redacted values found in a string, see Log.Redact
+func redactedSpans(str string) [][2]int {
+	redacted.Lock()
+	defer redacted.Unlock()
+
+	var spans [][2]int
+	for _, value := range redacted.values {
+		for start := 0; ; {
+			index := strings.Index(str[start:], value)
+			if index < 0 {
+				break
+			}
+			spans = append(spans, [2]int{start + index, start + index + len(value)})
+			start += index + len(value)
+		}
+	}
+
+	return spans
+}
+
+// longestRedacted returns the length of the longest value passed to Log.Redact
+func longestRedacted() int {
+	redacted.Lock()
+	defer redacted.Unlock()
+
+	longest := 0
+	for _, value := range redacted.values {
+		longest = max(longest, len(value))
+	}
+
+	return longest
+}
+
+// Redact hides a value, e.g. a decrypted secret, from the log output that follows
+func (l log) Redact(value string) {
+	if value == "" {
+		return
+	}
+
+	redacted.Lock()
+	defer redacted.Unlock()
+
+	redacted.values = append(redacted.values, value)
+}
+
+// Redacted replaces the values passed to Log.Redact in a string written outside of the log, e.g. to a log file
+func (l log) Redacted(str string) string {
+	return redact(str)
+}
+
 func (l log) Success(strs ...string) {
 	l.printLog("SUCCESS", l.Style.Success, strs...)
 }
@@ -108,3 +182,8 @@ func (l log) Warning(strs ...string) {
 func (l log) Log(strs ...string) {
 	l.printLog("LOG", l.Style.Log, strs...)
 }
+
+// DryRun logs an action that would have been performed if dry run mode was not enabled
+func (l log) DryRun(strs ...string) {
+	l.printLog("DRY RUN", l.Style.DryRun, strs...)
+}
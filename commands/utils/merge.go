@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ConfigOrigin records the file an entry of a merged config came from
+type ConfigOrigin struct {
+	Section string // e.g. "packages"
+	Key     string // identifies the entry within its section
+	Entry   string // human readable entry
+	File    string
+	Profile string // set when the entry came from a profile
+}
+
+// source describes where the entries being merged come from
+type source struct {
+	File    string
+	Profile string
+}
+
+// setOrigin records where an entry came from, replacing the origin of an entry with the same key
+func (config *ConfigYamlType) setOrigin(section, key, entry string, from source) {
+	for i, origin := range config.Origins {
+		if origin.Section == section && origin.Key == key {
+			config.Origins[i].Entry = entry
+			config.Origins[i].File = from.File
+			config.Origins[i].Profile = from.Profile
+			return
+		}
+	}
+
+	config.Origins = append(config.Origins, ConfigOrigin{Section: section, Key: key, Entry: entry, File: from.File, Profile: from.Profile})
+}
+
+// mergeConfig merges the entries of src into dst, from is recorded as the origin of the merged entries
+//   - vars: a variable with the same name replaces the previous one
+//   - backup.paths: appended, the same path replaces the previous one in place
+//   - backup.target, backup.flat, backup.retention, apply.onError: replaced when set in src
+//   - apply.order: replaced when set in src
+//   - environmentVariables: an entry with the same key and scope replaces the previous one,
+//     PATH entries are appended instead unless the same value already exists
+//   - packages: an entry with the same package name replaces the previous one in place, the others are appended
+//   - scripts: a script with the same name, or the same id when it has no name, replaces the previous one in place,
+//     identical scripts without a name or an id are ignored, the others are appended
+//   - snippets: a snippet with the same name replaces the previous one
+//   - profiles: a profile with the same name replaces the previous one in place, the others are appended
+func mergeConfig(dst *ConfigYamlType, src ConfigYamlType, from source) {
+
+	// vars
+	for _, name := range sortedKeys(src.Vars) {
+		if dst.Vars == nil {
+			dst.Vars = map[string]string{}
+		}
+
+		dst.Vars[name] = src.Vars[name]
+		dst.setOrigin("vars", name, fmt.Sprintf(`%s: "%s"`, name, src.Vars[name]), from)
+	}
+
+	// backup
+	for _, path := range src.Backup.Paths {
+		index := slices.IndexFunc(dst.Backup.Paths, func(p BackupPath) bool { return p.Path == path.Path })
+		if index >= 0 {
+			dst.Backup.Paths[index] = path
+		} else {
+			dst.Backup.Paths = append(dst.Backup.Paths, path)
+		}
+		dst.setOrigin("backup.paths", path.Path, path.Path, from)
+	}
+
+	if src.Backup.Target != "" {
+		dst.Backup.Target = src.Backup.Target
+		dst.setOrigin("backup.target", "", src.Backup.Target, from)
+	}
+
+	if src.Backup.Flat {
+		dst.Backup.Flat = true
+		dst.setOrigin("backup.flat", "", "true", from)
+	}
+
+	if src.Backup.Format != "" {
+		dst.Backup.Format = src.Backup.Format
+		dst.setOrigin("backup.format", "", src.Backup.Format, from)
+	}
+
+	if src.Backup.Retention.IsSet() {
+		retention := src.Backup.Retention
+		dst.Backup.Retention = retention
+		dst.setOrigin("backup.retention", "", fmt.Sprintf("last: %d, daily: %d, weekly: %d, monthly: %d", retention.Last, retention.Daily, retention.Weekly, retention.Monthly), from)
+	}
+
+	// environment variables
+	for _, env := range src.EnvironmentVariables {
+		key := env.Scope + "/" + strings.ToUpper(env.Key)
+		if strings.EqualFold(env.Key, "PATH") {
+			key += "/" + env.Value
+		}
+		entry := fmt.Sprintf(`%s="%s" (%s)`, env.Key, env.Value, env.Scope)
+
+		index := slices.IndexFunc(dst.EnvironmentVariables, func(e EnvironmentVariable) bool {
+			return e.Scope == env.Scope && strings.EqualFold(e.Key, env.Key) && (!strings.EqualFold(env.Key, "PATH") || e.Value == env.Value)
+		})
+		if index >= 0 {
+			dst.EnvironmentVariables[index] = env
+		} else {
+			dst.EnvironmentVariables = append(dst.EnvironmentVariables, env)
+		}
+		dst.setOrigin("environmentVariables", key, entry, from)
+	}
+
+	// packages
+	for _, pkg := range src.Packages {
+		name := strings.ToLower(pkg.Name)
+
+		index := slices.IndexFunc(dst.Packages, func(p PackageEntry) bool { return strings.EqualFold(p.Name, name) })
+		if index >= 0 {
+			dst.Packages[index] = pkg
+		} else {
+			dst.Packages = append(dst.Packages, pkg)
+		}
+		dst.setOrigin("packages", name, pkg.String(), from)
+	}
+
+	// scripts
+	for _, script := range src.Scripts {
+		key := script.String()
+		switch {
+		case script.Name != "":
+			key = "name:" + script.Name
+		case script.ID != "":
+			key = "id:" + script.ID
+		}
+
+		index := slices.IndexFunc(dst.Scripts, func(s ScriptEntry) bool {
+			switch {
+			case script.Name != "":
+				return s.Name == script.Name
+			case script.ID != "":
+				return s.Name == "" && s.ID == script.ID
+			}
+			return s.Name == "" && s.ID == "" && s.String() == key
+		})
+		if index >= 0 {
+			dst.Scripts[index] = script
+		} else {
+			dst.Scripts = append(dst.Scripts, script)
+		}
+		dst.setOrigin("scripts", key, script.String(), from)
+	}
+
+	// snippets
+	for _, name := range sortedKeys(src.Snippets) {
+		if dst.Snippets == nil {
+			dst.Snippets = map[string]SnippetEntry{}
+		}
+
+		dst.Snippets[name] = src.Snippets[name]
+		dst.setOrigin("snippets", name, name, from)
+	}
+
+	// apply
+	if len(src.Apply.Order) > 0 {
+		dst.Apply.Order = src.Apply.Order
+		dst.setOrigin("apply.order", "", strings.Join(src.Apply.Order, ", "), from)
+	}
+
+	if src.Apply.OnError != "" {
+		dst.Apply.OnError = src.Apply.OnError
+		dst.setOrigin("apply.onError", "", src.Apply.OnError, from)
+	}
+
+	// profiles
+	for _, profile := range src.Profiles {
+		profile.file = from.File
+
+		index := slices.IndexFunc(dst.Profiles, func(p ProfileConfig) bool { return strings.EqualFold(p.Name, profile.Name) })
+		if index >= 0 {
+			dst.Profiles[index] = profile
+		} else {
+			dst.Profiles = append(dst.Profiles, profile)
+		}
+	}
+}
+
+// sortedKeys returns the keys of the map in alphabetical order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	return keys
+}
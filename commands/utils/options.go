@@ -0,0 +1,19 @@
+package utils
+
+// GlobalOptions defines the command line options shared by every command
+type GlobalOptions struct {
+	DryRun         bool              `arg:"--dry-run" help:"Print every change that would be made to the system without making it"`
+	NonInteractive bool              `arg:"--non-interactive" help:"Never prompt, fail when a prompt has no answer in the answers file"`
+	AssumeYes      bool              `arg:"-y,--yes" help:"Answer yes to every confirmation prompt, implies --non-interactive"`
+	AnswersFile    *string           `arg:"--answers" placeholder:"[PATH]" help:"YAML file with the answers for the interactive prompts"`
+	Profiles       []string          `arg:"--profile,separate,env:WIN_TOOLS_PROFILE" placeholder:"[NAME]" help:"Config profile to apply instead of the ones matching this machine, can be repeated"`
+	Tags           []string          `arg:"--tag,separate,env:WIN_TOOLS_TAGS" placeholder:"[TAG]" help:"Tag of this machine, selects the config profiles with the same tag, can be repeated"`
+	Vars           map[string]string `arg:"--var,separate" placeholder:"[NAME=VALUE]" help:"Set a config variable, overrides the vars section and the WIN_TOOLS_VAR_NAME environment variables, can be repeated"`
+	Jobs           int               `arg:"--jobs,env:WIN_TOOLS_JOBS" default:"1" placeholder:"[N]" help:"Number of scripts to run at the same time, the scripts wait for the ones they need"`
+	StepTimeout    int               `arg:"--step-timeout,env:WIN_TOOLS_STEP_TIMEOUT" placeholder:"[SECONDS]" help:"Stop the scripts and the package installations running longer than this, unless they have their own timeout, 0 for no timeout"`
+	LogsDir        *string           `arg:"--logs-dir,env:WIN_TOOLS_LOGS_DIR" placeholder:"[PATH]" help:"Folder where the output of the scripts and the run reports are saved, win-tools\\logs in the local app data folder by default"`
+	SecretsKeyFile *string           `arg:"--secrets-key-file,env:WIN_TOOLS_SECRETS_KEY_FILE" placeholder:"[PATH]" help:"File holding the passphrase of the encrypted config values, the WIN_TOOLS_SECRETS_PASSPHRASE environment variable can be used instead"`
+}
+
+// Options holds the global options of the current session
+var Options = &GlobalOptions{}
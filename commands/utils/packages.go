@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// PackageEntry defines an entry of the "packages" section of the config file
+//   - A plain string is the package name followed by extra choco arguments, see parsePackageString
+type PackageEntry struct {
+	Name           string `yaml:"name" required:"true" description:"Name of the Chocolatey package"`
+	Version        string `yaml:"version,omitempty" description:"Version to install, the latest one when omitted"`
+	Params         string `yaml:"params,omitempty" description:"Package parameters, e.g. \"/NoDesktopShortcut /InstallDir:D:\\\\Apps\""`
+	Source         string `yaml:"source,omitempty" description:"Source to install the package from, a feed URL or a folder"`
+	NewWindow      bool   `yaml:"newWindow,omitempty" description:"Install in a new terminal window without waiting for it to finish"`
+	IgnoreChecksum bool   `yaml:"ignoreChecksum,omitempty" description:"Install even if the checksum of the downloaded files does not match"`
+	Timeout        int    `yaml:"timeout,omitempty" description:"Seconds to wait for the installation before failing, the Chocolatey default when omitted"`
+	Optional       bool   `yaml:"optional,omitempty" description:"A failed installation is reported as skipped instead of failing the packages section"`
+	Args           string `yaml:"args,omitempty" description:"Extra arguments passed to choco, separated by spaces, quote an argument holding spaces, e.g. --install-arguments=\"/DIR=C:\\Program Files\\App\""`
+	When           string `yaml:"when,omitempty" description:"Condition deciding whether the entry is applied, e.g. admin && build >= 22000 && !env(\"CI\"), functions: admin, build, hostname, env(\"NAME\"), exists(\"path\"), profile(\"name\"), tag(\"name\")"`
+
+	// plain is set when the entry was written as a string, to print it back the same way
+	plain bool
+}
+
+// packageNamePattern matches a valid Chocolatey package name
+var packageNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// packageVersionPattern matches a valid Chocolatey package version
+var packageVersionPattern = regexp.MustCompile(`^[0-9A-Za-z][0-9A-Za-z.+-]*$`)
+
+// JSONSchema describes a package entry, either a string or an object
+func (PackageEntry) JSONSchema() *Schema {
+	type object PackageEntry
+
+	return &Schema{
+		OneOf: []*Schema{
+			{Type: "string", Description: `Package name followed by extra choco arguments, "--new-window" installs it in a new terminal window`},
+			GenerateSchema(reflect.TypeOf(object{})),
+		},
+	}
+}
+
+// UnmarshalYAML reads a package entry from a string or an object
+func (p *PackageEntry) UnmarshalYAML(unmarshal func(any) error) error {
+	var str string
+	if err := unmarshal(&str); err == nil {
+		*p = parsePackageString(str)
+		return nil
+	}
+
+	type object PackageEntry
+	return unmarshal((*object)(p))
+}
+
+// MarshalYAML writes a package entry back the way it was read
+func (p PackageEntry) MarshalYAML() (any, error) {
+	if p.plain {
+		return p.String(), nil
+	}
+
+	type object PackageEntry
+	return object(p), nil
+}
+
+// parsePackageString reads a package entry from the legacy string form
+//   - The first word is the name, the rest is passed to choco as is
+//   - "--new-window" anywhere in the string sets NewWindow
+//   - The checksums are ignored, like they always were for this form
+func parsePackageString(str string) PackageEntry {
+	newWindow := strings.Contains(str, "--new-window")
+	str = strings.TrimSpace(strings.ReplaceAll(str, "--new-window", ""))
+
+	name, args, _ := strings.Cut(str, " ")
+
+	return PackageEntry{
+		Name:           name,
+		Args:           strings.TrimSpace(args),
+		NewWindow:      newWindow,
+		IgnoreChecksum: true,
+		plain:          true,
+	}
+}
+
+// String returns the entry as written in the legacy string form
+func (p PackageEntry) String() string {
+	str := p.Name
+	if p.Version != "" {
+		str += " --version=" + p.Version
+	}
+	if p.Params != "" {
+		str += fmt.Sprintf(` --params="%s"`, p.Params)
+	}
+	if p.Source != "" {
+		str += fmt.Sprintf(` --source="%s"`, p.Source)
+	}
+	if p.Timeout > 0 {
+		str += fmt.Sprintf(" --execution-timeout=%d", p.Timeout)
+	}
+	if p.IgnoreChecksum && !p.plain {
+		str += " --ignore-checksum"
+	}
+	if p.Args != "" {
+		str += " " + p.Args
+	}
+	if p.NewWindow {
+		str += " --new-window"
+	}
+	if p.Optional {
+		str += " (optional)"
+	}
+	if p.When != "" {
+		str += fmt.Sprintf(" (when %s)", p.When)
+	}
+
+	return str
+}
+
+// ExtraArgs splits Args into the arguments passed to choco
+//   - The arguments are separated by spaces or tabs
+//   - Double or single quotes group the characters between them into one argument, the quotes are removed,
+//     e.g. --install-arguments="/DIR=C:\Program Files" is read as --install-arguments=/DIR=C:\Program Files
+//
+// Returns: an error if a quote is not closed
+func (p PackageEntry) ExtraArgs() ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+
+	for _, r := range p.Args {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf(`missing the closing %c`, quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args, nil
+}
+
+// validate checks the values of the entry
+//
+// Returns: an error describing the first invalid value
+func (p PackageEntry) validate() error {
+	if !packageNamePattern.MatchString(p.Name) {
+		return fmt.Errorf(`invalid package name "%s"`, p.Name)
+	}
+
+	if p.Version != "" && !packageVersionPattern.MatchString(p.Version) {
+		return fmt.Errorf(`invalid version "%s" for the package "%s"`, p.Version, p.Name)
+	}
+
+	if p.Timeout < 0 {
+		return fmt.Errorf(`the timeout of the package "%s" must not be negative`, p.Name)
+	}
+
+	if _, err := p.ExtraArgs(); err != nil {
+		return fmt.Errorf(`invalid args for the package "%s": %s`, p.Name, err.Error())
+	}
+
+	if err := validateCondition(p.When); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ChocoArgs returns the arguments of "choco install" for the entry, without the package name
+func (p PackageEntry) ChocoArgs() []string {
+	args := []string{"-yf"}
+
+	if p.Version != "" {
+		args = append(args, "--version="+p.Version)
+	}
+	if p.Params != "" {
+		args = append(args, "--params="+p.Params)
+	}
+	if p.Source != "" {
+		args = append(args, "--source="+p.Source)
+	}
+	if p.Timeout > 0 {
+		args = append(args, fmt.Sprintf("--execution-timeout=%d", p.Timeout))
+	}
+	if p.IgnoreChecksum {
+		args = append(args, "--ignore-checksum")
+	}
+
+	return args
+}
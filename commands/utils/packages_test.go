@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPackageExtraArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args string
+		want []string
+	}{
+		{"empty", ``, nil},
+		{"blank", "  \t ", nil},
+		{"words", `--pre  --force`, []string{"--pre", "--force"}},
+		{"double quotes", `--ia="/DIR=C:\Program Files\App" -y`, []string{`--ia=/DIR=C:\Program Files\App`, "-y"}},
+		{"single quotes", `--params '/A /B'`, []string{"--params", "/A /B"}},
+		{"other quote inside", `--ia="it's" --x='"y"'`, []string{`--ia=it's`, `--x="y"`}},
+		{"empty quotes", `--password "" -y`, []string{"--password", "", "-y"}},
+		{"powershell metacharacters", `--x=$(calc) ; rm -r C:\ | y & z`, []string{`--x=$(calc)`, ";", "rm", "-r", `C:\`, "|", "y", "&", "z"}},
+		{"backtick and variable", "--x=`$env:PATH", []string{"--x=`$env:PATH"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := PackageEntry{Args: test.args}.ExtraArgs()
+			if err != nil {
+				t.Fatalf("ExtraArgs(%q) returned an error: %v", test.args, err)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("ExtraArgs(%q) = %q, want %q", test.args, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPackageExtraArgsUnclosedQuote(t *testing.T) {
+	for _, args := range []string{`--ia="/DIR=C:\x`, `'a`, `a "b" 'c`} {
+		if got, err := (PackageEntry{Args: args}).ExtraArgs(); err == nil {
+			t.Errorf("ExtraArgs(%q) = %q, want an error", args, got)
+		}
+	}
+
+	if err := (PackageEntry{Name: "git", Args: `"a`}).validate(); err == nil {
+		t.Error(`validate() returned no error for an unclosed quote in args`)
+	}
+}
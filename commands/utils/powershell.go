@@ -1,10 +1,14 @@
 package utils
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"strings"
+
+	"github.com/alabsi91/win-tools/commands/utils/shellquote"
 )
 
 type powershell struct {
@@ -23,15 +27,15 @@ var EnvironmentScope = environmentScope{"User", "Machine"}
 // GetShellName returns the powershell executable name
 //   - First will try if "pwsh" exists (Powershell version 7.1+)
 //   - If not, will try "powershell"
-//   - If neither exists, will exit with a fatal error
+//   - If neither exists, returns an error
 //   - The result will be cached, so it will only be executed once per session
 //
 // Returns: "pwsh" or "powershell"
-func (powershell *powershell) GetShellName() string {
+func (powershell *powershell) GetShellName() (string, error) {
 
 	// try get from cache
 	if powershell.shellPath != nil {
-		return *powershell.shellPath
+		return *powershell.shellPath, nil
 	}
 
 	// first try "pwsh"
@@ -40,7 +44,7 @@ func (powershell *powershell) GetShellName() string {
 	if err == nil {
 		shellPath := "pwsh"
 		powershell.shellPath = &shellPath
-		return shellPath
+		return shellPath, nil
 	}
 
 	// try "powershell"
@@ -49,39 +53,51 @@ func (powershell *powershell) GetShellName() string {
 	if err == nil {
 		shellPath := "powershell"
 		powershell.shellPath = &shellPath
-		return shellPath
+		return shellPath, nil
 	}
 
 	// Failure
-	Log.Fatal("\nFailed to get Powershell executable path\n")
-
-	return "powershell"
+	return "", errors.New("failed to get Powershell executable path")
 }
 
 // SetEnvVariable sets an environment variable in the given scope
 //   - key: name of the environment variable
 //   - value: value of the environment variable
 //   - scope: "User" or "Machine"
+//   - The command is stopped when the context is done, see CommandContext
 //
 // Returns: error if any
-func (powershell *powershell) SetEnvVariable(key string, value string, scope string) error {
-	shellPath := powershell.GetShellName()
+func (powershell *powershell) SetEnvVariable(ctx context.Context, key string, value string, scope string) error {
+	shellPath, err := powershell.GetShellName()
+	if err != nil {
+		return err
+	}
+
+	if Options.DryRun {
+		if key == "PATH" {
+			Log.DryRun(fmt.Sprintf(`append "%s" to the "%s" PATH environment variable`, value, scope))
+			return nil
+		}
+		Log.DryRun(fmt.Sprintf(`set the "%s" environment variable %s="%s"`, scope, key, value))
+		return nil
+	}
 
 	// Make sure the user has admin privileges when using the scope "Machine"
-	if scope == EnvironmentScope.Machine && !powershell.IsAdmin() {
-		return fmt.Errorf(`you dont have enough privileges to set the system environment variable "%s" with the value "%s"`, key, value)
+	if scope == EnvironmentScope.Machine && !powershell.IsAdmin(ctx) {
+		return NewError(ErrPrivilege, `you dont have enough privileges to set the system environment variable "%s" with the value "%s"`, key, value)
 	}
 
 	// Add to a new path
 	if key == "PATH" {
-		cmd := exec.Command(
+		cmd := CommandContext(
+			ctx,
 			shellPath,
 			"-Command",
-			fmt.Sprintf(`$tempPathVar = [System.Environment]::GetEnvironmentVariable("PATH", "%s");`, scope),
-			fmt.Sprintf(`[System.Environment]::SetEnvironmentVariable("PATH",  $tempPathVar + ";%s", "%s")`, value, scope),
+			fmt.Sprintf(`$tempPathVar = [System.Environment]::GetEnvironmentVariable('PATH', %s);`, shellquote.PowerShell(scope)),
+			fmt.Sprintf(`[System.Environment]::SetEnvironmentVariable('PATH', $tempPathVar + %s, %s)`, shellquote.PowerShell(";"+value), shellquote.PowerShell(scope)),
 		)
 
-		_, err := cmd.Output()
+		_, err = cmd.Output()
 		if err != nil {
 			return fmt.Errorf(`failed to set the environment variable "%s" with the value "%s"`, key, value)
 		}
@@ -90,13 +106,14 @@ func (powershell *powershell) SetEnvVariable(key string, value string, scope str
 	}
 
 	// Add key value
-	cmd := exec.Command(
+	cmd := CommandContext(
+		ctx,
 		shellPath,
 		"-Command",
-		fmt.Sprintf(`[System.Environment]::SetEnvironmentVariable("%s", "%s", "%s")`, key, value, scope),
+		fmt.Sprintf(`[System.Environment]::SetEnvironmentVariable(%s)`, shellquote.PowerShellList(key, value, scope)),
 	)
 
-	_, err := cmd.Output()
+	_, err = cmd.Output()
 	if err != nil {
 		return fmt.Errorf(`failed to set the environment variable "%s" with the value "%s"`, key, value)
 	}
@@ -107,12 +124,17 @@ func (powershell *powershell) SetEnvVariable(key string, value string, scope str
 // IsAdmin checks if the current user has admin privileges.
 //
 // returns false when encountering an error.
+//   - The check is stopped when the context is done, see CommandContext
 //
 // Returns: true if the user has admin privileges
-func (powershell *powershell) IsAdmin() bool {
-	shellPath := powershell.GetShellName()
+func (powershell *powershell) IsAdmin(ctx context.Context) bool {
+	shellPath, err := powershell.GetShellName()
+	if err != nil {
+		return false
+	}
 
-	cmd := exec.Command(
+	cmd := CommandContext(
+		ctx,
 		shellPath,
 		"-Command",
 		`(New-Object Security.Principal.WindowsPrincipal([Security.Principal.WindowsIdentity]::GetCurrent())).IsInRole([Security.Principal.WindowsBuiltInRole]::Administrator)`,
@@ -129,14 +151,24 @@ func (powershell *powershell) IsAdmin() bool {
 }
 
 // RemoveWinPackage removes a Windows package (bloatware)
-func (powershell *powershell) RemoveWinPackage(packageName string) error {
-	shellPath := powershell.GetShellName()
+//   - The removal is stopped when the context is done
+func (powershell *powershell) RemoveWinPackage(ctx context.Context, packageName string) error {
+	if Options.DryRun {
+		Log.DryRun(fmt.Sprintf(`remove the Windows package "%s" for all users`, packageName))
+		return nil
+	}
 
-	cmd := exec.Command(
+	shellPath, err := powershell.GetShellName()
+	if err != nil {
+		return err
+	}
+
+	cmd := CommandContext(
+		ctx,
 		shellPath,
 		"-Command",
 		"Set-ExecutionPolicy -ExecutionPolicy Bypass -Scope Process -Force;",
-		fmt.Sprintf(`Get-AppxPackage -Name "%s" -AllUsers | Remove-AppxPackage`, packageName),
+		fmt.Sprintf(`Get-AppxPackage -Name %s -AllUsers | Remove-AppxPackage`, shellquote.PowerShell(packageName)),
 	)
 
 	cmd.Stdin = os.Stdin
@@ -151,11 +183,12 @@ func (powershell *powershell) RemoveWinPackage(packageName string) error {
 		return fmt.Errorf(`failed to remove the package with the name "%s"`, packageName)
 	}
 
-	cmd = exec.Command(
+	cmd = CommandContext(
+		ctx,
 		shellPath,
 		"-Command",
 		"Set-ExecutionPolicy -ExecutionPolicy Bypass -Scope Process -Force;",
-		fmt.Sprintf(`Get-AppxProvisionedPackage -Online | Where-Object { $_.PackageName -like "%s" } | ForEach-Object { Remove-ProvisionedAppxPackage -Online -AllUsers -PackageName $_.PackageName }`, packageName),
+		fmt.Sprintf(`Get-AppxProvisionedPackage -Online | Where-Object { $_.PackageName -like %s } | ForEach-Object { Remove-ProvisionedAppxPackage -Online -AllUsers -PackageName $_.PackageName }`, shellquote.PowerShell(packageName)),
 	)
 
 	cmd.Stdin = os.Stdin
@@ -176,11 +209,20 @@ func (powershell *powershell) RemoveWinPackage(packageName string) error {
 // RestartWinExplorer restarts Windows Explorer
 //   - Logs a warning if it fails
 func (powershell *powershell) RestartWinExplorer() {
-	shellPath := powershell.GetShellName()
+	if Options.DryRun {
+		Log.DryRun("restart Windows Explorer")
+		return
+	}
+
+	shellPath, err := powershell.GetShellName()
+	if err != nil {
+		Log.Warning("Failed to restart Windows Explorer.")
+		return
+	}
 
 	cmd := exec.Command(shellPath, "-Command", "stop-process", "-name", "explorer", "–force")
 
-	_, err := cmd.Output()
+	_, err = cmd.Output()
 
 	if err != nil {
 		Log.Warning("Failed to restart Windows Explorer.")
@@ -188,10 +230,20 @@ func (powershell *powershell) RestartWinExplorer() {
 }
 
 // RunPathThroughCmd runs a powershell command and streams the output to the console
-func (powershell *powershell) RunPathThroughCmd(args ...string) error {
-	shell := powershell.GetShellName()
+//   - In dry run mode, the command is printed instead of being executed
+//   - The command and its child processes are stopped when the context is done, see CommandContext
+func (powershell *powershell) RunPathThroughCmd(ctx context.Context, args ...string) error {
+	shell, err := powershell.GetShellName()
+	if err != nil {
+		return err
+	}
+
+	if Options.DryRun {
+		Log.DryRun(fmt.Sprintf(`run: %s -Command %s`, shell, strings.Join(args, " ")))
+		return nil
+	}
 
-	cmd := exec.Command(shell, append([]string{"-Command"}, args...)...)
+	cmd := CommandContext(ctx, shell, append([]string{"-Command"}, args...)...)
 
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
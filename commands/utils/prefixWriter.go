@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// PrefixWriter writes every line written to it to another writer, starting with a prefix
+//   - Incomplete lines are kept until the next newline or Flush
+//   - All the prefix writers share a lock, so lines written at the same time are never mixed
+type PrefixWriter struct {
+	out    io.Writer
+	prefix []byte
+	buffer []byte
+}
+
+// prefixWriterLock is shared by all the prefix writers
+var prefixWriterLock sync.Mutex
+
+// NewPrefixWriter creates a writer prefixing each line written to out
+func NewPrefixWriter(out io.Writer, prefix string) *PrefixWriter {
+	return &PrefixWriter{out: out, prefix: []byte(prefix)}
+}
+
+// Write writes the complete lines of p, the rest is kept for the next call
+func (w *PrefixWriter) Write(p []byte) (int, error) {
+	w.buffer = append(w.buffer, p...)
+
+	for {
+		end := bytes.IndexByte(w.buffer, '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+
+		if err := w.writeLine(w.buffer[:end+1]); err != nil {
+			return len(p), err
+		}
+		w.buffer = w.buffer[end+1:]
+	}
+}
+
+// Flush writes the incomplete line kept by Write, followed by a newline
+func (w *PrefixWriter) Flush() error {
+	if len(w.buffer) == 0 {
+		return nil
+	}
+
+	line := append(w.buffer, '\n')
+	w.buffer = nil
+
+	return w.writeLine(line)
+}
+
+// writeLine writes a single line with the prefix
+func (w *PrefixWriter) writeLine(line []byte) error {
+	prefixWriterLock.Lock()
+	defer prefixWriterLock.Unlock()
+
+	_, err := w.out.Write(append(append([]byte{}, w.prefix...), line...))
+	return err
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// processWaitDelay is how long a stopped command may keep its output open before it is closed
+const processWaitDelay = 5 * time.Second
+
+// CommandContext creates a command stopped together with all of its child processes when the context is done
+//   - See exec.CommandContext, only the command itself would be stopped
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+
+	startProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcessTree(cmd) }
+	cmd.WaitDelay = processWaitDelay
+
+	return cmd
+}
+
+// StepTimeout returns the timeout of a step, a script or a package installation
+//   - seconds: the timeout of the step, the --step-timeout default is used when it is 0
+//
+// Returns: 0 when the step has no timeout
+func StepTimeout(seconds int) time.Duration {
+	if seconds <= 0 {
+		seconds = Options.StepTimeout
+	}
+
+	return time.Duration(max(seconds, 0)) * time.Second
+}
+
+// WithStepTimeout returns a context done when the timeout of the step expires, see StepTimeout
+func WithStepTimeout(ctx context.Context, seconds int) (context.Context, context.CancelFunc) {
+	timeout := StepTimeout(seconds)
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// startProcessGroup prepares a command to be stopped with its child processes, nothing is needed on Windows
+func startProcessGroup(*exec.Cmd) {}
+
+// killProcessTree stops a command and all of its child processes using taskkill
+//   - Falls back to stopping the command only if taskkill fails
+func killProcessTree(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+
+	taskkill := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid))
+	if err := taskkill.Run(); err != nil {
+		return cmd.Process.Kill()
+	}
+
+	return nil
+}
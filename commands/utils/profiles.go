@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// applyProfiles merges the selected profiles into the config, in the order they are declared
+//   - The profiles are removed from the config and their names are stored in ActiveProfiles
+//
+// Returns: an error of kind ErrConfig if a profile passed with --profile does not exist or a hostname pattern is invalid
+func applyProfiles(config *ConfigYamlType) error {
+	profiles, err := selectProfiles(config.Profiles)
+	if err != nil {
+		return err
+	}
+
+	config.Profiles = nil
+
+	for _, profile := range profiles {
+		overlay := ConfigYamlType{
+			Vars:                 profile.Vars,
+			Backup:               profile.Backup,
+			EnvironmentVariables: profile.EnvironmentVariables,
+			Packages:             profile.Packages,
+			Scripts:              profile.Scripts,
+			Apply:                profile.Apply,
+		}
+
+		mergeConfig(config, overlay, source{File: profile.file, Profile: profile.Name})
+		config.ActiveProfiles = append(config.ActiveProfiles, profile.Name)
+	}
+
+	return nil
+}
+
+// selectProfiles returns the profiles to apply on this machine
+//   - When --profile is used, only the named profiles are selected
+//   - Otherwise a profile is selected when the hostname matches one of its patterns, or one of its tags was passed with --tag
+//   - Names, patterns and tags are case insensitive
+func selectProfiles(profiles []ProfileConfig) ([]ProfileConfig, error) {
+	if len(Options.Profiles) > 0 {
+		for _, name := range Options.Profiles {
+			if !slices.ContainsFunc(profiles, func(p ProfileConfig) bool { return strings.EqualFold(p.Name, name) }) {
+				return nil, NewError(ErrConfig, `unknown profile "%s", available profiles: %s`, name, profileNames(profiles))
+			}
+		}
+
+		return slices.DeleteFunc(slices.Clone(profiles), func(p ProfileConfig) bool {
+			return !slices.ContainsFunc(Options.Profiles, func(name string) bool { return strings.EqualFold(p.Name, name) })
+		}), nil
+	}
+
+	hostname, _ := os.Hostname()
+
+	var selected []ProfileConfig
+	for _, profile := range profiles {
+		match, err := profileMatches(profile, hostname, Options.Tags)
+		if err != nil {
+			return nil, err
+		}
+
+		if match {
+			selected = append(selected, profile)
+		}
+	}
+
+	return selected, nil
+}
+
+// profileMatches reports whether the profile matches the hostname or one of the tags
+func profileMatches(profile ProfileConfig, hostname string, tags []string) (bool, error) {
+	for _, pattern := range profile.Hostnames {
+		match, err := path.Match(strings.ToLower(pattern), strings.ToLower(hostname))
+		if err != nil {
+			return false, NewError(ErrConfig, `profile "%s": invalid hostname pattern "%s"`, profile.Name, pattern)
+		}
+
+		if match {
+			return true, nil
+		}
+	}
+
+	for _, tag := range profile.Tags {
+		if slices.ContainsFunc(tags, func(t string) bool { return strings.EqualFold(strings.TrimSpace(t), tag) }) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// profileNames returns the comma separated names of the profiles
+func profileNames(profiles []ProfileConfig) string {
+	if len(profiles) == 0 {
+		return "none"
+	}
+
+	names := make([]string, len(profiles))
+	for i, profile := range profiles {
+		names[i] = profile.Name
+	}
+
+	return strings.Join(names, ", ")
+}
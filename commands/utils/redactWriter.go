@@ -0,0 +1,60 @@
+package utils
+
+import "io"
+
+// RedactWriter writes the output written to it to another writer, with the values passed to Log.Redact replaced
+//   - The end of the output that may be the start of a redacted value is kept until the next write or Flush,
+//     so a value split across writes is still replaced
+//   - Not safe for concurrent use
+type RedactWriter struct {
+	out    io.Writer
+	buffer []byte
+}
+
+// NewRedactWriter creates a writer redacting the output written to out, e.g. a log file
+func NewRedactWriter(out io.Writer) *RedactWriter {
+	return &RedactWriter{out: out}
+}
+
+// Write writes the redacted output of p, except the end that may start a redacted value
+func (w *RedactWriter) Write(p []byte) (int, error) {
+	w.buffer = append(w.buffer, p...)
+
+	// a value starting before the cut must end before it to be replaced
+	cut := len(w.buffer) - max(longestRedacted()-1, 0)
+	for moved := true; moved && cut > 0; {
+		moved = false
+		for _, span := range redactedSpans(string(w.buffer)) {
+			if span[0] < cut && span[1] > cut {
+				cut = span[1]
+				moved = true
+			}
+		}
+	}
+
+	if cut <= 0 {
+		return len(p), nil
+	}
+
+	output := redact(string(w.buffer[:cut]))
+	w.buffer = w.buffer[cut:]
+
+	if _, err := io.WriteString(w.out, output); err != nil {
+		return len(p), err
+	}
+
+	return len(p), nil
+}
+
+// Flush writes the redacted output kept by Write
+func (w *RedactWriter) Flush() error {
+	if len(w.buffer) == 0 {
+		return nil
+	}
+
+	output := redact(string(w.buffer))
+	w.buffer = nil
+
+	_, err := io.WriteString(w.out, output)
+	return err
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactWriter(t *testing.T) {
+	Log.Redact("hunter2-redact-writer")
+	Log.Redact("multi\nline-redact-writer")
+
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"no secret", []string{"plain output\n"}, "plain output\n"},
+		{"whole secret", []string{"password: hunter2-redact-writer\n"}, "password: ******\n"},
+		{"split secret", []string{"password: hunter2-", "redact", "-writer done"}, "password: ****** done"},
+		{"one byte at a time", strings.Split("a hunter2-redact-writer b", ""), "a ****** b"},
+		{"secret on two lines", []string{"key: multi\n", "line-redact-writer\n"}, "key: ******\n"},
+		{"repeated secret", []string{"hunter2-redact-writerhunter2-redact-writer"}, "************"},
+		{"start of a secret only", []string{"hunter2-", "redact-"}, "hunter2-redact-"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var output strings.Builder
+			writer := NewRedactWriter(&output)
+
+			for _, write := range test.writes {
+				if n, err := writer.Write([]byte(write)); err != nil || n != len(write) {
+					t.Fatalf("Write(%q) = %d, %v", write, n, err)
+				}
+				if strings.Contains(output.String(), "hunter2-redact-writer") {
+					t.Fatalf("a secret was written: %q", output.String())
+				}
+			}
+			if err := writer.Flush(); err != nil {
+				t.Fatalf("Flush() returned an error: %v", err)
+			}
+
+			if output.String() != test.want {
+				t.Errorf("the output = %q, want %q", output.String(), test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,445 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// SchemaURL is the URL where the JSON schema of the config file is published
+const SchemaURL = "https://raw.githubusercontent.com/alabsi91/win-tools-go/main/config.schema.json"
+
+// Schema is a subset of the JSON schema specification, enough to describe and validate the config file
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	ID                   string             `json:"$id,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+
+	// Closed disallows properties which are not listed in Properties
+	Closed bool `json:"-"`
+}
+
+// MarshalJSON adds "additionalProperties": false to the closed objects
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	type plainSchema Schema
+
+	out := struct {
+		*plainSchema
+		AdditionalProperties any `json:"additionalProperties,omitempty"`
+	}{plainSchema: (*plainSchema)(s)}
+
+	if s.AdditionalProperties != nil {
+		out.AdditionalProperties = s.AdditionalProperties
+	} else if s.Closed {
+		out.AdditionalProperties = false
+	}
+
+	return json.Marshal(out)
+}
+
+// SchemaProvider is implemented by the config types which cannot be described by their Go type alone,
+// for example entries accepting either a string or an object
+type SchemaProvider interface {
+	JSONSchema() *Schema
+}
+
+// ConfigSchema returns the JSON schema of the config file
+func ConfigSchema() *Schema {
+	schema := GenerateSchema(reflect.TypeOf(ConfigYamlType{}))
+	schema.Schema = "https://json-schema.org/draft/2020-12/schema"
+	schema.ID = SchemaURL
+	schema.Title = "win-tools config"
+
+	return schema
+}
+
+// GenerateSchema generates the JSON schema of a Go type
+//   - Struct fields are named after their "yaml" tag
+//   - The "description", "enum" and "required" field tags are added to the schema
+//   - Types implementing SchemaProvider describe themselves
+func GenerateSchema(t reflect.Type) *Schema {
+	if provider, ok := reflect.New(t).Interface().(SchemaProvider); ok {
+		return provider.JSONSchema()
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return GenerateSchema(t.Elem())
+
+	case reflect.String:
+		return &Schema{Type: "string"}
+
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: GenerateSchema(t.Elem())}
+
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: GenerateSchema(t.Elem())}
+
+	case reflect.Struct:
+		schema := &Schema{Type: "object", Properties: map[string]*Schema{}, Closed: true}
+
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := yamlFieldName(field)
+			if name == "" {
+				continue
+			}
+
+			property := GenerateSchema(field.Type)
+			property.Description = field.Tag.Get("description")
+
+			if enum := field.Tag.Get("enum"); enum != "" {
+				target := property
+				if property.Type == "array" {
+					target = property.Items
+				}
+				target.Enum = strings.Split(enum, ",")
+			}
+
+			if field.Tag.Get("required") == "true" {
+				schema.Required = append(schema.Required, name)
+			}
+
+			schema.Properties[name] = property
+		}
+
+		return schema
+	}
+
+	return &Schema{}
+}
+
+// yamlFieldName returns the key of a struct field in the YAML file
+//
+// Returns: an empty string if the field is not part of the YAML file
+func yamlFieldName(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+
+	return name
+}
+
+// ValidationError is a problem found while validating a YAML file
+type ValidationError struct {
+	Path    string // e.g. "environmentVariables[0].scope"
+	Line    int
+	Column  int
+	Message string
+}
+
+// ValidateYaml validates a YAML document against a schema
+//   - Every problem is reported, the validation does not stop at the first one
+//
+// Returns:
+//   - The list of problems, sorted by position
+//   - An error if the YAML document cannot be parsed
+func ValidateYaml(data []byte, schema *Schema) ([]ValidationError, error) {
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []ValidationError
+	for _, doc := range file.Docs {
+		if doc.Body == nil {
+			continue
+		}
+		problems = append(problems, validateNode(doc.Body, schema, "")...)
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Line != problems[j].Line {
+			return problems[i].Line < problems[j].Line
+		}
+		return problems[i].Column < problems[j].Column
+	})
+
+	return problems, nil
+}
+
+// newValidationError creates a validation error at the position of the given node
+func newValidationError(node ast.Node, path string, format string, a ...any) ValidationError {
+	position := node.GetToken().Position
+	message := fmt.Sprintf(format, a...)
+	if path != "" {
+		message = fmt.Sprintf("%s: %s", path, message)
+	}
+
+	return ValidationError{Path: path, Line: position.Line, Column: position.Column, Message: message}
+}
+
+// validateNode validates a YAML node and its children against a schema
+func validateNode(node ast.Node, schema *Schema, path string) []ValidationError {
+	// unwrap nodes which do not change the value
+	switch n := node.(type) {
+	case *ast.AnchorNode:
+		return validateNode(n.Value, schema, path)
+	case *ast.AliasNode, *ast.NullNode:
+		return nil
+	}
+
+	if len(schema.OneOf) > 0 {
+		return validateOneOf(node, schema, path)
+	}
+
+	switch schema.Type {
+	case "object":
+		return validateObject(node, schema, path)
+
+	case "array":
+		sequence, ok := node.(*ast.SequenceNode)
+		if !ok {
+			return []ValidationError{newValidationError(node, path, "expected a list, got %s", describeNode(node))}
+		}
+
+		var problems []ValidationError
+		for i, item := range sequence.Values {
+			problems = append(problems, validateNode(item, schema.Items, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return problems
+
+	case "string":
+		value, ok := scalarValue(node)
+		if !ok {
+			return []ValidationError{newValidationError(node, path, "expected a string, got %s", describeNode(node))}
+		}
+		return validateEnum(node, schema, path, value)
+
+	case "integer":
+		if _, ok := node.(*ast.IntegerNode); !ok {
+			return []ValidationError{newValidationError(node, path, "expected an integer, got %s", describeNode(node))}
+		}
+
+	case "number":
+		switch node.(type) {
+		case *ast.IntegerNode, *ast.FloatNode:
+		default:
+			return []ValidationError{newValidationError(node, path, "expected a number, got %s", describeNode(node))}
+		}
+
+	case "boolean":
+		if _, ok := node.(*ast.BoolNode); !ok {
+			return []ValidationError{newValidationError(node, path, "expected true or false, got %s", describeNode(node))}
+		}
+	}
+
+	return nil
+}
+
+// validateObject validates a YAML mapping against an object schema
+func validateObject(node ast.Node, schema *Schema, path string) []ValidationError {
+	var values []*ast.MappingValueNode
+
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		values = n.Values
+	case *ast.MappingValueNode:
+		values = []*ast.MappingValueNode{n}
+	default:
+		return []ValidationError{newValidationError(node, path, "expected a mapping, got %s", describeNode(node))}
+	}
+
+	var problems []ValidationError
+	found := map[string]bool{}
+
+	for _, value := range values {
+		key := value.Key.String()
+		found[key] = true
+		keyPath := joinYamlPath(path, key)
+
+		if property, exists := schema.Properties[key]; exists {
+			problems = append(problems, validateNode(value.Value, property, keyPath)...)
+			continue
+		}
+
+		if schema.AdditionalProperties != nil {
+			problems = append(problems, validateNode(value.Value, schema.AdditionalProperties, keyPath)...)
+			continue
+		}
+
+		if schema.Closed {
+			message := fmt.Sprintf(`unknown key "%s"`, key)
+			if suggestion := closestKey(key, schema.Properties); suggestion != "" {
+				message += fmt.Sprintf(`, did you mean "%s"?`, suggestion)
+			}
+			problems = append(problems, newValidationError(value.Key, path, "%s", message))
+		}
+	}
+
+	for _, required := range schema.Required {
+		if !found[required] {
+			problems = append(problems, newValidationError(node, path, `missing required key "%s"`, required))
+		}
+	}
+
+	return problems
+}
+
+// validateOneOf validates a YAML node against a schema with alternatives
+//   - The node is valid if it matches one of the alternatives
+//   - Otherwise, the problems of the alternative with the same type as the node are reported
+func validateOneOf(node ast.Node, schema *Schema, path string) []ValidationError {
+	var best []ValidationError
+
+	for _, alternative := range schema.OneOf {
+		problems := validateNode(node, alternative, path)
+		if len(problems) == 0 {
+			return nil
+		}
+
+		if best == nil || matchesType(node, alternative.Type) {
+			best = problems
+		}
+	}
+
+	return best
+}
+
+// validateEnum checks that a scalar value is one of the allowed values
+func validateEnum(node ast.Node, schema *Schema, path string, value string) []ValidationError {
+	if len(schema.Enum) == 0 {
+		return nil
+	}
+
+	for _, allowed := range schema.Enum {
+		if value == allowed {
+			return nil
+		}
+	}
+
+	return []ValidationError{newValidationError(node, path, `invalid value "%s", expected one of: %s`, value, strings.Join(schema.Enum, ", "))}
+}
+
+// scalarValue returns the string value of a scalar node
+//
+// Returns: false if the node is not a scalar
+func scalarValue(node ast.Node) (string, bool) {
+	switch n := node.(type) {
+	case *ast.StringNode:
+		return n.Value, true
+	case *ast.LiteralNode:
+		return n.Value.Value, true
+	case *ast.IntegerNode, *ast.FloatNode, *ast.BoolNode, *ast.InfinityNode, *ast.NanNode:
+		return n.GetToken().Value, true
+	case *ast.TagNode:
+		return scalarValue(n.Value)
+	}
+
+	return "", false
+}
+
+// matchesType reports whether a node has the given JSON schema type
+func matchesType(node ast.Node, schemaType string) bool {
+	switch node.(type) {
+	case *ast.MappingNode, *ast.MappingValueNode:
+		return schemaType == "object"
+	case *ast.SequenceNode:
+		return schemaType == "array"
+	}
+
+	return schemaType != "object" && schemaType != "array"
+}
+
+// describeNode describes the type of a node for error messages
+func describeNode(node ast.Node) string {
+	switch node.(type) {
+	case *ast.MappingNode, *ast.MappingValueNode:
+		return "a mapping"
+	case *ast.SequenceNode:
+		return "a list"
+	}
+
+	if value, ok := scalarValue(node); ok {
+		return fmt.Sprintf(`"%s"`, value)
+	}
+
+	return node.Type().String()
+}
+
+// joinYamlPath appends a key to a YAML path
+func joinYamlPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// closestKey finds the known key closest to an unknown one to suggest a fix for typos
+//
+// Returns: an empty string if no key is close enough
+func closestKey(key string, properties map[string]*Schema) string {
+	best := ""
+	bestDistance := 3 // only suggest keys with at most 2 edits
+
+	for name := range properties {
+		distance := levenshtein(strings.ToLower(key), strings.ToLower(name))
+		if distance < bestDistance || (distance == bestDistance && best != "" && name < best) {
+			best = name
+			bestDistance = distance
+		}
+	}
+
+	if bestDistance >= 3 {
+		return ""
+	}
+
+	return best
+}
+
+// levenshtein computes the edit distance between two strings
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous = current
+	}
+
+	return previous[len(b)]
+}
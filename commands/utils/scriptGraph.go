@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ScriptDependencies returns, for each script, the indices of the scripts it needs
+//   - The scripts are referenced by their id, see ScriptEntry.Needs
+//
+// Returns: an error if an id is used twice, a script needs an unknown id or the needs form a cycle
+func ScriptDependencies(scripts []ScriptEntry) ([][]int, error) {
+	if err := checkScriptIDs(scripts); err != nil {
+		return nil, err
+	}
+
+	ids := map[string]int{}
+	for i, script := range scripts {
+		if script.ID != "" {
+			ids[script.ID] = i
+		}
+	}
+
+	dependencies := make([][]int, len(scripts))
+	for i, script := range scripts {
+		for _, id := range script.Needs {
+			index, found := ids[id]
+			if !found {
+				return nil, fmt.Errorf(`the script %s needs the unknown id "%s"`, script.DisplayName(i), id)
+			}
+
+			if !slices.Contains(dependencies[i], index) {
+				dependencies[i] = append(dependencies[i], index)
+			}
+		}
+	}
+
+	if cycle := findCycle(scripts, dependencies); cycle != nil {
+		return nil, fmt.Errorf(`the needs of the scripts form a cycle: %s`, strings.Join(cycle, " -> "))
+	}
+
+	return dependencies, nil
+}
+
+// checkScriptIDs checks that no id is used by more than one script
+func checkScriptIDs(scripts []ScriptEntry) error {
+	ids := map[string]int{}
+	for i, script := range scripts {
+		if script.ID == "" {
+			continue
+		}
+
+		if first, found := ids[script.ID]; found {
+			return fmt.Errorf(`the id "%s" is used by the scripts %d and %d`, script.ID, first, i)
+		}
+		ids[script.ID] = i
+	}
+
+	return nil
+}
+
+// findCycle looks for a cycle in the dependencies using a depth first search
+//
+// Returns: the labels of the scripts forming the first cycle found, the first one repeated at the end, or nil
+func findCycle(scripts []ScriptEntry, dependencies [][]int) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make([]int, len(scripts))
+	var stack []int
+
+	var visit func(i int) []string
+	visit = func(i int) []string {
+		state[i] = visiting
+		stack = append(stack, i)
+
+		for _, dependency := range dependencies[i] {
+			switch state[dependency] {
+			case visiting:
+				start := slices.Index(stack, dependency)
+
+				var cycle []string
+				for _, index := range append(stack[start:], dependency) {
+					cycle = append(cycle, scripts[index].Label(index))
+				}
+				return cycle
+
+			case unvisited:
+				if cycle := visit(dependency); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[i] = visited
+		return nil
+	}
+
+	for i := range scripts {
+		if state[i] == unvisited {
+			if cycle := visit(i); cycle != nil {
+				return cycle
+			}
+		}
+	}
+
+	return nil
+}
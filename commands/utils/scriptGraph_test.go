@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestScriptDependencies(t *testing.T) {
+	tests := []struct {
+		name    string
+		scripts []ScriptEntry
+		want    [][]int
+	}{
+		{"no scripts", nil, [][]int{}},
+		{"no needs", []ScriptEntry{{ID: "a"}, {}}, [][]int{nil, nil}},
+		{"chain", []ScriptEntry{{ID: "a"}, {ID: "b", Needs: []string{"a"}}, {Needs: []string{"b"}}}, [][]int{nil, {0}, {1}}},
+		{"need declared later", []ScriptEntry{{Needs: []string{"b"}}, {ID: "b"}}, [][]int{{1}, nil}},
+		{"diamond", []ScriptEntry{
+			{ID: "a"},
+			{ID: "b", Needs: []string{"a"}},
+			{ID: "c", Needs: []string{"a"}},
+			{ID: "d", Needs: []string{"c", "b"}},
+		}, [][]int{nil, {0}, {0}, {2, 1}}},
+		{"repeated need", []ScriptEntry{{ID: "a"}, {Needs: []string{"a", "a"}}}, [][]int{nil, {0}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ScriptDependencies(test.scripts)
+			if err != nil {
+				t.Fatalf("ScriptDependencies() returned an error: %v", err)
+			}
+			if !slices.EqualFunc(got, test.want, slices.Equal[[]int]) {
+				t.Errorf("ScriptDependencies() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestScriptDependenciesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		scripts []ScriptEntry
+		err     string
+	}{
+		{"duplicate id", []ScriptEntry{{ID: "a"}, {}, {ID: "a"}}, `the id "a" is used by the scripts 0 and 2`},
+		{"unknown id", []ScriptEntry{{ID: "a"}, {Name: "Build", Needs: []string{"nope"}}}, `the script "Build" needs the unknown id "nope"`},
+		{"unknown id without a name", []ScriptEntry{{Needs: []string{"nope"}}}, `the script with the index "0" needs the unknown id "nope"`},
+		{"needs itself", []ScriptEntry{{ID: "a", Needs: []string{"a"}}}, `cycle: a -> a`},
+		{"two scripts", []ScriptEntry{
+			{ID: "a", Needs: []string{"b"}},
+			{ID: "b", Needs: []string{"a"}},
+		}, `cycle: a -> b -> a`},
+		{"labels use the names", []ScriptEntry{
+			{ID: "a", Name: "Install", Needs: []string{"b"}},
+			{ID: "b", Needs: []string{"a"}},
+		}, `cycle: Install -> b -> Install`},
+		{"cycle after a valid prefix", []ScriptEntry{
+			{ID: "root"},
+			{ID: "a", Needs: []string{"root", "c"}},
+			{ID: "b", Needs: []string{"a"}},
+			{ID: "c", Needs: []string{"b"}},
+		}, `cycle: a -> c -> b -> a`},
+		{"cycle not reachable from the first script", []ScriptEntry{
+			{ID: "a"},
+			{ID: "b", Needs: []string{"a"}},
+			{ID: "c", Needs: []string{"d"}},
+			{ID: "d", Needs: []string{"c"}},
+		}, `cycle: c -> d -> c`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ScriptDependencies(test.scripts)
+			if err == nil {
+				t.Fatalf("ScriptDependencies() = %v, want an error", got)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("ScriptDependencies() error = %q, want it to contain %q", err.Error(), test.err)
+			}
+		})
+	}
+}
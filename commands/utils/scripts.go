@@ -0,0 +1,290 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/alabsi91/win-tools/commands/utils/shellquote"
+)
+
+// Shells supported by the script entries
+const (
+	ShellCmd        = "cmd"
+	ShellPowershell = "powershell"
+	ShellPwsh       = "pwsh"
+	ShellBash       = "bash"
+	ShellPython     = "python"
+)
+
+// ScriptEntry defines an entry of the "scripts" section of the config file
+//   - A plain string is a cmd script, or a PowerShell script when it starts with "powershell", see parseScriptString
+type ScriptEntry struct {
+	Name            string            `yaml:"name,omitempty" description:"Name of the script, shown in the logs and the summary"`
+	ID              string            `yaml:"id,omitempty" description:"Identifier of the script, used in the needs of the other scripts"`
+	Needs           []string          `yaml:"needs,omitempty" description:"Ids of the scripts that must succeed before this one starts"`
+	Shell           string            `yaml:"shell,omitempty" enum:"cmd,powershell,pwsh,bash,python" description:"Shell running the script, cmd when omitted"`
+	Run             string            `yaml:"run,omitempty" description:"The script to run, either run or file is required"`
+	File            string            `yaml:"file,omitempty" description:"Script file to run, relative paths are resolved against the config file"`
+	Use             string            `yaml:"use,omitempty" description:"Name of the snippet to run instead of run or file, see \"snippets\""`
+	With            map[string]string `yaml:"with,omitempty" description:"Values of the parameters of the snippet, quoted for the shell of the snippet"`
+	Cwd             string            `yaml:"cwd,omitempty" description:"Working directory of the script, relative paths are resolved against the config file"`
+	Env             map[string]string `yaml:"env,omitempty" description:"Environment variables added to the environment of the script"`
+	Timeout         int               `yaml:"timeout,omitempty" description:"Seconds to wait for the script before stopping it and failing"`
+	ContinueOnError bool              `yaml:"continueOnError,omitempty" description:"Keep running the next scripts when this one fails"`
+	ExitCodes       []int             `yaml:"exitCodes,omitempty" description:"Exit codes meaning success, [0] when omitted"`
+	Creates         string            `yaml:"creates,omitempty" description:"Skip the script when this path exists, relative paths are resolved against the config file"`
+	Unless          string            `yaml:"unless,omitempty" description:"Skip the script when this command exits with 0, it runs in the shell, cwd and env of the script"`
+	OnlyIf          string            `yaml:"onlyIf,omitempty" description:"Run the script only when this command exits with 0, it runs in the shell, cwd and env of the script"`
+	When            string            `yaml:"when,omitempty" description:"Condition deciding whether the entry is applied, e.g. admin && build >= 22000 && !env(\"CI\"), functions: admin, build, hostname, env(\"NAME\"), exists(\"path\"), profile(\"name\"), tag(\"name\")"`
+
+	// plain is set when the entry was written as a string, to print it back the same way
+	plain bool
+
+	// dir is the directory of the config file the entry was declared in
+	dir string
+}
+
+// JSONSchema describes a script entry, either a string or an object
+func (ScriptEntry) JSONSchema() *Schema {
+	type object ScriptEntry
+
+	return &Schema{
+		OneOf: []*Schema{
+			{Type: "string", Description: `A cmd script, or a PowerShell script when it starts with "powershell"`},
+			GenerateSchema(reflect.TypeOf(object{})),
+		},
+	}
+}
+
+// UnmarshalYAML reads a script entry from a string or an object
+func (s *ScriptEntry) UnmarshalYAML(unmarshal func(any) error) error {
+	var str string
+	if err := unmarshal(&str); err == nil {
+		*s = parseScriptString(str)
+		return nil
+	}
+
+	type object ScriptEntry
+	return unmarshal((*object)(s))
+}
+
+// MarshalYAML writes a script entry back the way it was read
+//   - A script using a snippet is written without the expanded script of the snippet
+func (s ScriptEntry) MarshalYAML() (any, error) {
+	if s.plain {
+		return s.String(), nil
+	}
+
+	if s.Use != "" {
+		s.Shell, s.Run = "", ""
+	}
+
+	type object ScriptEntry
+	return object(s), nil
+}
+
+// parseScriptString reads a script entry from the legacy string form
+//   - Scripts starting with "powershell" run in PowerShell, the others in cmd
+func parseScriptString(str string) ScriptEntry {
+	if run, isPowershell := strings.CutPrefix(str, "powershell"); isPowershell {
+		return ScriptEntry{Shell: ShellPowershell, Run: run, plain: true}
+	}
+
+	return ScriptEntry{Shell: ShellCmd, Run: str, plain: true}
+}
+
+// String returns the entry as written in the legacy string form, or a short description of it
+func (s ScriptEntry) String() string {
+	if s.plain {
+		if s.Shell == ShellPowershell {
+			return "powershell" + s.Run
+		}
+		return s.Run
+	}
+
+	str := fmt.Sprintf("%s: %s", s.shell(), s.Run)
+	switch {
+	case s.Use != "":
+		str = "use: " + s.Use
+		for _, key := range sortedKeys(s.With) {
+			str += fmt.Sprintf(` %s="%s"`, key, s.With[key])
+		}
+	case s.File != "":
+		str = fmt.Sprintf("%s: %s", s.shell(), s.File)
+	}
+
+	if s.Name != "" {
+		return fmt.Sprintf("%s (%s)", s.Name, str)
+	}
+
+	return str
+}
+
+// DisplayName returns the name of the script for the logs, its id when it has no name
+func (s ScriptEntry) DisplayName(index int) string {
+	if s.Name == "" && s.ID == "" {
+		return fmt.Sprintf(`with the index "%d"`, index)
+	}
+
+	return fmt.Sprintf(`"%s"`, s.Label(index))
+}
+
+// Label returns a short name of the script used as the prefix of its output, its name, its id or its index
+func (s ScriptEntry) Label(index int) string {
+	switch {
+	case s.Name != "":
+		return s.Name
+	case s.ID != "":
+		return s.ID
+	}
+
+	return fmt.Sprint(index)
+}
+
+// shell returns the shell of the script, cmd when omitted
+func (s ScriptEntry) shell() string {
+	if s.Shell == "" {
+		return ShellCmd
+	}
+
+	return s.Shell
+}
+
+// validate checks the values of the entry
+//
+// Returns: an error describing the first invalid value
+func (s ScriptEntry) validate() error {
+	// the scripts using a snippet are checked and expanded by expandSnippets
+	if s.Use == "" && (s.Run == "") == (s.File == "") {
+		return fmt.Errorf(`exactly one of "run", "file" or "use" is required`)
+	}
+
+	if s.Timeout < 0 {
+		return fmt.Errorf(`the timeout must not be negative`)
+	}
+
+	if err := validateCondition(s.When); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// IsSuccess reports whether an exit code of the script means success
+func (s ScriptEntry) IsSuccess(exitCode int) bool {
+	if len(s.ExitCodes) == 0 {
+		return exitCode == 0
+	}
+
+	return slices.Contains(s.ExitCodes, exitCode)
+}
+
+// resolvePath resolves a path relative to the config file the entry was declared in
+//   - The path variables are expanded first, see PathExpander
+func (s ScriptEntry) resolvePath(path string) (string, error) {
+	path, err := PathExpander.Expand(path)
+	if err != nil {
+		return "", err
+	}
+
+	if !filepath.IsAbs(path) && s.dir != "" {
+		path = filepath.Join(s.dir, path)
+	}
+
+	return path, nil
+}
+
+// WorkingDir returns the working directory of the script, empty to use the current one
+func (s ScriptEntry) WorkingDir() (string, error) {
+	if s.Cwd == "" {
+		return "", nil
+	}
+
+	return s.resolvePath(s.Cwd)
+}
+
+// Environ returns the environment of the script, the current environment followed by the env of the entry
+func (s ScriptEntry) Environ(environ []string) []string {
+	for _, key := range sortedKeys(s.Env) {
+		environ = append(environ, key+"="+s.Env[key])
+	}
+
+	return environ
+}
+
+// Command returns the executable and the arguments running the script
+//
+// Returns: an error if the executable of the shell cannot be found or the file path cannot be expanded
+func (s ScriptEntry) Command() (string, []string, error) {
+	if s.File == "" {
+		return s.shellCommand(s.Run, false)
+	}
+
+	file, err := s.resolvePath(s.File)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return s.shellCommand(file, true)
+}
+
+// GuardCommand returns the executable and the arguments running a guard command ("unless" or "onlyIf")
+// in the shell of the script
+//
+// Returns: an error if the executable of the shell cannot be found
+func (s ScriptEntry) GuardCommand(command string) (string, []string, error) {
+	return s.shellCommand(command, false)
+}
+
+// CreatesPath returns the expanded "creates" path of the script, empty when it is not set
+func (s ScriptEntry) CreatesPath() (string, error) {
+	if s.Creates == "" {
+		return "", nil
+	}
+
+	return s.resolvePath(s.Creates)
+}
+
+// shellCommand returns the executable and the arguments running a script or a script file in the shell of the entry
+func (s ScriptEntry) shellCommand(script string, isFile bool) (string, []string, error) {
+	switch s.shell() {
+	case ShellPowershell, ShellPwsh:
+		shell := s.shell()
+
+		// legacy scripts run in the newest PowerShell available
+		if s.plain {
+			shellName, err := Powershell.GetShellName()
+			if err != nil {
+				return "", nil, err
+			}
+			shell = shellName
+		}
+
+		if isFile {
+			return shell, []string{"-NoProfile", "-ExecutionPolicy", "Bypass", "-File", script}, nil
+		}
+		return shell, []string{"-Command", script}, nil
+
+	case ShellBash:
+		if isFile {
+			return "bash", []string{script}, nil
+		}
+		return "bash", []string{"-c", script}, nil
+
+	case ShellPython:
+		if isFile {
+			return "python", []string{script}, nil
+		}
+		return "python", []string{"-c", script}, nil
+
+	default:
+		// cmd.exe runs the text between the first and the last quote after /S /C as is, see SetCommandLine
+		if isFile {
+			return "cmd", []string{"/S", "/C", `"` + shellquote.Argv(script) + `"`}, nil
+		}
+		return "cmd", []string{"/S", "/C", `"` + script + `"`}, nil
+	}
+}
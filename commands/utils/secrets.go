@@ -0,0 +1,350 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/charmbracelet/huh"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"golang.org/x/crypto/scrypt"
+)
+
+// SecretPrefix marks an encrypted value of the config file, e.g. "enc:AbC..."
+const SecretPrefix = "enc:"
+
+// SecretTag marks an encrypted value of the config file, "!secret AbC..." is the same as "enc:AbC..."
+const SecretTag = "!secret"
+
+// PassphraseEnv is the environment variable holding the passphrase of the secrets
+const PassphraseEnv = "WIN_TOOLS_SECRETS_PASSPHRASE"
+
+// Format of an encrypted value, base64 encoded after the prefix:
+// version (1 byte) | scrypt salt (16 bytes) | AES-GCM nonce (12 bytes) | ciphertext
+const (
+	secretVersion  = 1
+	secretSaltSize = 16
+	scryptN        = 1 << 15
+	scryptR        = 8
+	scryptP        = 1
+	secretKeySize  = 32 // AES-256
+)
+
+type secrets struct {
+	passphrase *string
+	keys       map[string][]byte // derived keys by salt
+}
+
+var Secrets = &secrets{keys: map[string][]byte{}}
+
+// IsSecret reports whether a config value is encrypted
+func IsSecret(value string) bool {
+	return strings.HasPrefix(value, SecretPrefix)
+}
+
+// Passphrase returns the passphrase of the secrets
+//   - Read from the file passed with --secrets-key-file first, then from the WIN_TOOLS_SECRETS_PASSPHRASE environment variable
+//   - Otherwise the user is asked for it, twice when confirm is true
+//   - The result will be cached, so it will only be asked once per session
+//
+// Returns: an error of kind ErrConfig in non-interactive mode when no passphrase is provided
+func (secrets *secrets) Passphrase(confirm bool) (string, error) {
+
+	// try get from cache
+	if secrets.passphrase != nil {
+		return *secrets.passphrase, nil
+	}
+
+	passphrase, err := secrets.readPassphrase(confirm)
+	if err != nil {
+		return "", err
+	}
+
+	if passphrase == "" {
+		return "", NewError(ErrConfig, "the passphrase of the secrets cannot be empty")
+	}
+
+	secrets.passphrase = &passphrase
+	return passphrase, nil
+}
+
+// readPassphrase reads the passphrase from the key file, the environment or a prompt
+func (secrets *secrets) readPassphrase(confirm bool) (string, error) {
+	if Options.SecretsKeyFile != nil {
+		dat, err := os.ReadFile(*Options.SecretsKeyFile)
+		if err != nil {
+			return "", NewError(ErrConfig, `failed to read the secrets key file: "%s"`, *Options.SecretsKeyFile)
+		}
+
+		return strings.TrimRight(string(dat), "\r\n"), nil
+	}
+
+	if passphrase, ok := os.LookupEnv(PassphraseEnv); ok {
+		return passphrase, nil
+	}
+
+	if Options.NonInteractive {
+		return "", NewError(ErrConfig, "no passphrase provided for the secrets, use --secrets-key-file or set %s", PassphraseEnv)
+	}
+
+	var passphrase, again string
+
+	fields := []huh.Field{
+		huh.NewInput().
+			Title("Enter the passphrase of the config secrets:").
+			EchoMode(huh.EchoModePassword).
+			Value(&passphrase),
+	}
+
+	if confirm {
+		fields = append(fields, huh.NewInput().
+			Title("Enter the passphrase again:").
+			EchoMode(huh.EchoModePassword).
+			Validate(func(s string) error {
+				if s != passphrase {
+					return fmt.Errorf("the passphrases do not match")
+				}
+				return nil
+			}).
+			Value(&again))
+	}
+
+	err := huh.NewForm(huh.NewGroup(fields...)).Run()
+
+	return passphrase, PromptError(err)
+}
+
+// key derives the AES key of a salt from the passphrase
+//   - The derived keys are cached, since scrypt is slow on purpose
+func (secrets *secrets) key(salt []byte, confirm bool) ([]byte, error) {
+	if key, ok := secrets.keys[string(salt)]; ok {
+		return key, nil
+	}
+
+	passphrase, err := secrets.Passphrase(confirm)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, secretKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive the secrets key: %w", err)
+	}
+
+	secrets.keys[string(salt)] = key
+	return key, nil
+}
+
+// Encrypt encrypts a value with AES-GCM, the key is derived from the passphrase with scrypt and a random salt
+//
+// Returns: the encrypted value, starting with "enc:"
+func (secrets *secrets) Encrypt(plaintext string) (string, error) {
+	salt := make([]byte, secretSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate a salt: %w", err)
+	}
+
+	key, err := secrets.key(salt, true)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate a nonce: %w", err)
+	}
+
+	payload := append([]byte{secretVersion}, salt...)
+	payload = append(payload, nonce...)
+	payload = gcm.Seal(payload, nonce, []byte(plaintext), nil)
+
+	return SecretPrefix + base64.StdEncoding.EncodeToString(payload), nil
+}
+
+// Decrypt decrypts a value encrypted with Encrypt
+//   - The "enc:" prefix is optional
+//   - The decrypted value is redacted from the log output
+//
+// Returns: an error of kind ErrConfig if the value is malformed or the passphrase is wrong
+func (secrets *secrets) Decrypt(value string) (string, error) {
+	payload, err := base64.StdEncoding.DecodeString(strings.TrimSpace(strings.TrimPrefix(value, SecretPrefix)))
+	if err != nil {
+		return "", NewError(ErrConfig, "the secret is not valid base64")
+	}
+
+	if len(payload) < 1+secretSaltSize || payload[0] != secretVersion {
+		return "", NewError(ErrConfig, "the secret has an unknown format")
+	}
+
+	salt := payload[1 : 1+secretSaltSize]
+	key, err := secrets.key(salt, false)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	rest := payload[1+secretSaltSize:]
+	if len(rest) < gcm.NonceSize() {
+		return "", NewError(ErrConfig, "the secret has an unknown format")
+	}
+
+	plaintext, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", NewError(ErrConfig, "failed to decrypt the secret, the passphrase is wrong or the secret is corrupted")
+	}
+
+	Log.Redact(string(plaintext))
+
+	return string(plaintext), nil
+}
+
+// newGCM creates an AES-GCM cipher from a key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// decryptSecrets decrypts every encrypted string value under root, in memory
+//   - path is the YAML path of root and skip the keys not walked, see walkStrings
+//
+// Returns: an error of kind ErrConfig listing the secrets that failed to decrypt
+func decryptSecrets(root reflect.Value, path string, skip []string) error {
+	var problems []string
+	var cause error
+
+	walkStrings(root, path, skip, func(path, value string) string {
+		if !IsSecret(value) || cause != nil {
+			return value
+		}
+
+		// ask for the passphrase once, before the first secret
+		if _, err := Secrets.Passphrase(false); err != nil {
+			cause = err
+			return value
+		}
+
+		plaintext, err := Secrets.Decrypt(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", path, err.Error()))
+			return value
+		}
+
+		return plaintext
+	})
+
+	if cause != nil {
+		return cause
+	}
+
+	if len(problems) > 0 {
+		return NewError(ErrConfig, "invalid config secrets:\n%s", strings.Join(problems, "\n"))
+	}
+
+	return nil
+}
+
+// secretVarNames returns the names of the variables holding an encrypted value, they are used literally, see resolveVars
+func secretVarNames(vars map[string]string) map[string]bool {
+	names := map[string]bool{}
+	for name, value := range vars {
+		if IsSecret(value) {
+			names[name] = true
+		}
+	}
+
+	return names
+}
+
+// resolveSecretTags replaces the "!secret X" values of a YAML document with "enc:X"
+func resolveSecretTags(node ast.Node) {
+	ast.Walk(secretTagVisitor{}, node)
+}
+
+type secretTagVisitor struct{}
+
+func (v secretTagVisitor) Visit(node ast.Node) ast.Visitor {
+	if tag, ok := node.(*ast.TagNode); ok && tag.Start.Value == SecretTag {
+		if str, ok := tag.Value.(*ast.StringNode); ok {
+			str.Value = SecretPrefix + str.Value
+		}
+		tag.Start.Value = "!!str"
+	}
+
+	return v
+}
+
+// SecretLocation is an encrypted value found in a config file
+type SecretLocation struct {
+	Path  string // e.g. "environmentVariables[0].value"
+	Value string // the encrypted value as written in the file, without the "enc:" prefix
+	Line  int
+}
+
+// FindSecrets lists the encrypted values of a YAML file, in the order they appear
+func FindSecrets(data []byte) ([]SecretLocation, error) {
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var locations []SecretLocation
+	for _, doc := range file.Docs {
+		findSecrets(doc.Body, "", &locations)
+	}
+
+	return locations, nil
+}
+
+// findSecrets adds the encrypted values of a YAML node to locations, recursively
+func findSecrets(node ast.Node, path string, locations *[]SecretLocation) {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		for _, value := range n.Values {
+			findSecrets(value, path, locations)
+		}
+
+	case *ast.MappingValueNode:
+		findSecrets(n.Value, joinYamlPath(path, n.Key.String()), locations)
+
+	case *ast.SequenceNode:
+		for i, value := range n.Values {
+			findSecrets(value, fmt.Sprintf("%s[%d]", path, i), locations)
+		}
+
+	case *ast.AnchorNode:
+		findSecrets(n.Value, path, locations)
+
+	case *ast.TagNode:
+		if n.Start.Value == SecretTag {
+			if value, ok := scalarValue(n.Value); ok {
+				*locations = append(*locations, SecretLocation{Path: path, Value: value, Line: n.Start.Position.Line})
+			}
+			return
+		}
+		findSecrets(n.Value, path, locations)
+
+	case *ast.StringNode:
+		if IsSecret(n.Value) {
+			*locations = append(*locations, SecretLocation{Path: path, Value: strings.TrimPrefix(n.Value, SecretPrefix), Line: n.Token.Position.Line})
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Package shellquote quotes strings so a shell or a program reads them as a single literal argument
+//   - PowerShell: single-quoted literals, nothing inside them is expanded
+//   - Cmd: arguments of a cmd.exe command line, its special characters are escaped with ^
+//   - Argv: arguments of a CreateProcess command line, read back by the C runtime of the program
+//   - Posix: single-quoted words of bash and the other POSIX shells
+//   - EncodedCommand: PowerShell scripts passed with -EncodedCommand, out of reach of every command line in between
+package shellquote
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrLineBreak is returned when a string with a line break is quoted for cmd, a cmd command line cannot hold one
+var ErrLineBreak = errors.New("cmd cannot read a line break inside an argument")
+
+// powershellQuotes are the characters PowerShell reads as a single quote, the typographic ones included
+const powershellQuotes = "'‘’‚‛"
+
+// cmdSpecialChars are the characters cmd.exe reads before passing the command line to the program
+const cmdSpecialChars = "()%!^\"<>&|"
+
+// PowerShell quotes a string as a PowerShell single-quoted literal
+//   - Variables ($name), subexpressions ($(...)) and escapes (`n) are not expanded inside it
+//   - The single quotes inside the string, typographic ones included, are doubled
+func PowerShell(str string) string {
+	var builder strings.Builder
+
+	builder.WriteByte('\'')
+	for _, r := range str {
+		if strings.ContainsRune(powershellQuotes, r) {
+			builder.WriteRune(r)
+		}
+		builder.WriteRune(r)
+	}
+	builder.WriteByte('\'')
+
+	return builder.String()
+}
+
+// PowerShellList quotes every string as a PowerShell literal and joins them with commas, e.g. for -ArgumentList
+func PowerShellList(strs ...string) string {
+	quoted := make([]string, len(strs))
+	for i, str := range strs {
+		quoted[i] = PowerShell(str)
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+// EncodedCommand encodes a PowerShell script for the -EncodedCommand parameter, as base64 of its UTF-16LE bytes
+//   - The result only contains letters, digits, "+", "/" and "=", so it reaches PowerShell unchanged
+//     through Start-Process -ArgumentList and the CreateProcess command line of the new process
+func EncodedCommand(script string) string {
+	units := utf16.Encode([]rune(script))
+
+	bytes := make([]byte, 0, 2*len(units))
+	for _, unit := range units {
+		bytes = append(bytes, byte(unit), byte(unit>>8))
+	}
+
+	return base64.StdEncoding.EncodeToString(bytes)
+}
+
+// Argv quotes an argument of a CreateProcess command line, following the rules of the C runtime parsing it
+//   - Arguments without spaces, tabs or double quotes are returned as is, except the empty one which becomes ""
+//   - Backslashes are only doubled before a double quote, the escaped ones and the closing one
+func Argv(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\v\"") {
+		return arg
+	}
+
+	var builder strings.Builder
+	builder.WriteByte('"')
+
+	backslashes := 0
+	for i := 0; i < len(arg); i++ {
+		switch arg[i] {
+		case '\\':
+			backslashes++
+			continue
+		case '"':
+			builder.WriteString(strings.Repeat(`\`, 2*backslashes+1))
+		default:
+			builder.WriteString(strings.Repeat(`\`, backslashes))
+		}
+
+		backslashes = 0
+		builder.WriteByte(arg[i])
+	}
+
+	builder.WriteString(strings.Repeat(`\`, 2*backslashes))
+	builder.WriteByte('"')
+
+	return builder.String()
+}
+
+// Cmd quotes an argument of a cmd.exe command line, e.g. the command of "cmd /C"
+//   - The argument is quoted with Argv for the program, then the characters cmd.exe reads, %VAR% and !VAR! included,
+//     are escaped with ^ so they reach the program unchanged
+//
+// Returns: ErrLineBreak if the argument contains a line break
+func Cmd(arg string) (string, error) {
+	if strings.ContainsAny(arg, "\r\n") {
+		return "", ErrLineBreak
+	}
+
+	quoted := Argv(arg)
+
+	var builder strings.Builder
+	for _, r := range quoted {
+		if strings.ContainsRune(cmdSpecialChars, r) {
+			builder.WriteByte('^')
+		}
+		builder.WriteRune(r)
+	}
+
+	return builder.String(), nil
+}
+
+// Posix quotes a string as a single-quoted word of bash and the other POSIX shells
+//   - A single quote inside the string closes the quoted word, is escaped with a backslash and opens a new one
+func Posix(str string) string {
+	return "'" + strings.ReplaceAll(str, "'", `'\''`) + "'"
+}
@@ -0,0 +1,269 @@
+package shellquote
+
+import (
+	"errors"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPowerShell(t *testing.T) {
+	tests := []struct {
+		name string
+		str  string
+		want string
+	}{
+		{"empty", ``, `''`},
+		{"plain", `abc`, `'abc'`},
+		{"single quote", `it's`, `'it''s'`},
+		{"typographic quotes", `‘x’`, `'‘‘x’’'`},
+		{"double quotes", `say "hi"`, `'say "hi"'`},
+		{"subexpression", `$(Remove-Item C:\)`, `'$(Remove-Item C:\)'`},
+		{"variable", `$env:PATH`, `'$env:PATH'`},
+		{"backtick", "a`nb`", "'a`nb`'"},
+		{"cmd characters", `%PATH% ^&|<>`, `'%PATH% ^&|<>'`},
+		{"trailing backslash", `C:\dir\`, `'C:\dir\'`},
+		{"newline", "a\nb", "'a\nb'"},
+		{"closing the literal", `'; calc; '`, `'''; calc; '''`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := PowerShell(test.str); got != test.want {
+				t.Errorf("PowerShell(%q) = %q, want %q", test.str, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPowerShellList(t *testing.T) {
+	tests := []struct {
+		strs []string
+		want string
+	}{
+		{nil, ``},
+		{[]string{""}, `''`},
+		{[]string{"-C", "it's"}, `'-C', 'it''s'`},
+		{[]string{"a, b", "$(x)"}, `'a, b', '$(x)'`},
+	}
+
+	for _, test := range tests {
+		if got := PowerShellList(test.strs...); got != test.want {
+			t.Errorf("PowerShellList(%q) = %q, want %q", test.strs, got, test.want)
+		}
+	}
+}
+
+func TestEncodedCommand(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{``, ``},
+		{`pause`, `cABhAHUAcwBlAA==`},
+		{`'a"b'`, `JwBhACIAYgAnAA==`},
+		{`é€`, `6QCsIA==`},
+		{`😀`, `PdgA3g==`},
+	}
+
+	for _, test := range tests {
+		got := EncodedCommand(test.script)
+		if got != test.want {
+			t.Errorf("EncodedCommand(%q) = %q, want %q", test.script, got, test.want)
+		}
+		if strings.ContainsAny(got, ` '"$;&|`+"`") {
+			t.Errorf("EncodedCommand(%q) = %q holds a character a command line reads", test.script, got)
+		}
+	}
+}
+
+func TestArgv(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  string
+		want string
+	}{
+		{"empty", ``, `""`},
+		{"plain", `abc`, `abc`},
+		{"backslashes without spaces", `C:\dir\`, `C:\dir\`},
+		{"space", `a b`, `"a b"`},
+		{"tab", "a\tb", "\"a\tb\""},
+		{"newline", "a\nb", "\"a\nb\""},
+		{"trailing backslash", `C:\my dir\`, `"C:\my dir\\"`},
+		{"double quotes", `say "hi"`, `"say \"hi\""`},
+		{"backslash before a quote", `a\"b`, `"a\\\"b"`},
+		{"backslashes not before a quote", `a\\b c`, `"a\\b c"`},
+		{"single quote", `it's`, `it's`},
+		{"cmd characters", `%PATH%^&|<>`, `%PATH%^&|<>`},
+		{"subexpression", `$(calc)`, `$(calc)`},
+		{"backticks", "`id`", "`id`"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Argv(test.arg)
+			if got != test.want {
+				t.Errorf("Argv(%q) = %q, want %q", test.arg, got, test.want)
+			}
+
+			if args := parseArgv(got); !slices.Equal(args, []string{test.arg}) {
+				t.Errorf("Argv(%q) = %q is read back as %q", test.arg, got, args)
+			}
+		})
+	}
+}
+
+func TestCmd(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  string
+		want string
+	}{
+		{"empty", ``, `^"^"`},
+		{"plain", `abc`, `abc`},
+		{"variable", `%PATH%`, `^%PATH^%`},
+		{"delayed variable", `!PATH!`, `^!PATH^!`},
+		{"operators", `^&|<>`, `^^^&^|^<^>`},
+		{"parentheses", `(x)`, `^(x^)`},
+		{"command separator", `a & calc`, `^"a ^& calc^"`},
+		{"double quotes", `say "hi"`, `^"say \^"hi\^"^"`},
+		{"trailing backslash", `C:\my dir\`, `^"C:\my dir\\^"`},
+		{"single quote", `it's`, `it's`},
+		{"subexpression", `$(calc)`, `$^(calc^)`},
+		{"backticks", "`id`", "`id`"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Cmd(test.arg)
+			if err != nil {
+				t.Fatalf("Cmd(%q) returned an error: %v", test.arg, err)
+			}
+			if got != test.want {
+				t.Errorf("Cmd(%q) = %q, want %q", test.arg, got, test.want)
+			}
+
+			// cmd.exe removes the escaping carets before the program reads its arguments
+			if args := parseArgv(removeCarets(got)); !slices.Equal(args, []string{test.arg}) {
+				t.Errorf("Cmd(%q) = %q is read back as %q", test.arg, got, args)
+			}
+		})
+	}
+}
+
+func TestCmdLineBreak(t *testing.T) {
+	for _, arg := range []string{"a\nb", "a\r\nb", "a\r", "\n"} {
+		if got, err := Cmd(arg); !errors.Is(err, ErrLineBreak) {
+			t.Errorf("Cmd(%q) = %q, %v, want ErrLineBreak", arg, got, err)
+		}
+	}
+}
+
+func TestPosix(t *testing.T) {
+	tests := []struct {
+		name string
+		str  string
+		want string
+	}{
+		{"empty", ``, `''`},
+		{"plain", `abc`, `'abc'`},
+		{"single quote", `it's`, `'it'\''s'`},
+		{"only a single quote", `'`, `''\'''`},
+		{"double quotes", `say "hi"`, `'say "hi"'`},
+		{"subexpression", `$(rm -rf /)`, `'$(rm -rf /)'`},
+		{"variable", `$HOME ${PATH}`, `'$HOME ${PATH}'`},
+		{"backticks", "`id`", "'`id`'"},
+		{"cmd characters", `%PATH% ^&|<>`, `'%PATH% ^&|<>'`},
+		{"trailing backslash", `back\`, `'back\'`},
+		{"newline", "a\nb", "'a\nb'"},
+	}
+
+	sh, lookErr := exec.LookPath("sh")
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Posix(test.str)
+			if got != test.want {
+				t.Errorf("Posix(%q) = %q, want %q", test.str, got, test.want)
+			}
+
+			if lookErr != nil {
+				return
+			}
+			output, err := exec.Command(sh, "-c", "printf %s "+got).Output()
+			if err != nil {
+				t.Fatalf("sh -c printf %%s %s failed: %v", got, err)
+			}
+			if string(output) != test.str {
+				t.Errorf("Posix(%q) = %q is read back by sh as %q", test.str, got, output)
+			}
+		})
+	}
+}
+
+// parseArgv splits a command line the way the C runtime of a Windows program does
+func parseArgv(cmdLine string) []string {
+	var args []string
+	var arg strings.Builder
+	inArg, inQuotes := false, false
+
+	for i := 0; i < len(cmdLine); i++ {
+		c := cmdLine[i]
+
+		switch {
+		case c == '\\':
+			backslashes := 0
+			for i < len(cmdLine) && cmdLine[i] == '\\' {
+				backslashes++
+				i++
+			}
+			if i < len(cmdLine) && cmdLine[i] == '"' {
+				arg.WriteString(strings.Repeat(`\`, backslashes/2))
+				if backslashes%2 == 1 {
+					arg.WriteByte('"')
+				} else {
+					inQuotes = !inQuotes
+				}
+			} else {
+				arg.WriteString(strings.Repeat(`\`, backslashes))
+				i--
+			}
+			inArg = true
+
+		case c == '"':
+			inQuotes = !inQuotes
+			inArg = true
+
+		case (c == ' ' || c == '\t') && !inQuotes:
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+
+	if inArg {
+		args = append(args, arg.String())
+	}
+
+	return args
+}
+
+// removeCarets removes the escaping carets the way cmd.exe does, a caret escapes the next character
+func removeCarets(cmdLine string) string {
+	var builder strings.Builder
+	for i := 0; i < len(cmdLine); i++ {
+		if cmdLine[i] == '^' && i+1 < len(cmdLine) {
+			i++
+		}
+		builder.WriteByte(cmdLine[i])
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,339 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// snapshotTimeLayout is the layout of the time at the start of the name of a snapshot
+const snapshotTimeLayout = "2006-01-02_15-04-05"
+
+// snapshotNamePattern matches the name of a snapshot, the time followed by the hostname
+var snapshotNamePattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}_\d{2}-\d{2}-\d{2})_(.+)$`)
+
+// flatArchiveName is the name of the archive of a flat backup target, without its extension
+const flatArchiveName = "backup"
+
+// BackupSnapshot is a snapshot of the backup target, one per backup run, a directory or an archive file
+type BackupSnapshot struct {
+	Name     string // e.g. "2024-07-01_18-30-00_DESKTOP-1" or "2024-07-01_18-30-00_DESKTOP-1.zip"
+	Path     string
+	Time     time.Time
+	Hostname string
+	Format   string // BackupFormatFolder for a directory, the format of the archive otherwise
+}
+
+// ListSnapshots lists the snapshots of the backup target, the oldest first
+//   - The other files and directories of the target are ignored
+//
+// Returns: an empty list if the target does not exist
+func ListSnapshots(target string) ([]BackupSnapshot, error) {
+	entries, err := os.ReadDir(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf(`failed to list the snapshots of "%s": %w`, target, err)
+	}
+
+	var snapshots []BackupSnapshot
+	for _, entry := range entries {
+		name, format := entry.Name(), BackupFormatFolder
+		if !entry.IsDir() {
+			format = archiveFormatOf(name)
+			if format == "" {
+				continue
+			}
+			name = name[:len(name)-len(ArchiveExtension(format))]
+		}
+
+		match := snapshotNamePattern.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+
+		snapshotTime, err := time.ParseInLocation(snapshotTimeLayout, match[1], time.Local)
+		if err != nil {
+			continue
+		}
+
+		snapshots = append(snapshots, BackupSnapshot{
+			Name:     entry.Name(),
+			Path:     filepath.Join(target, entry.Name()),
+			Time:     snapshotTime,
+			Hostname: match[2],
+			Format:   format,
+		})
+	}
+
+	slices.SortStableFunc(snapshots, func(a, b BackupSnapshot) int { return a.Time.Compare(b.Time) })
+
+	return snapshots, nil
+}
+
+// LoadSnapshotManifest reads the manifest of a snapshot, from its directory or from its archive
+func LoadSnapshotManifest(snapshot BackupSnapshot) (*BackupManifest, error) {
+	if snapshot.Format != BackupFormatFolder {
+		return LoadArchiveManifest(snapshot.Path)
+	}
+
+	return LoadBackupManifest(snapshot.Path)
+}
+
+// latestSnapshot returns the newest snapshot taken on the given host, or on any host when hostname is empty
+//
+// Returns: false if there is none
+func latestSnapshot(snapshots []BackupSnapshot, hostname string) (BackupSnapshot, bool) {
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if hostname == "" || strings.EqualFold(snapshots[i].Hostname, hostname) {
+			return snapshots[i], true
+		}
+	}
+
+	return BackupSnapshot{}, false
+}
+
+// NewSnapshot creates the snapshot directory of a backup run in the target, named by the current time and the hostname
+//   - The files of the previous snapshot of this host are hard linked into the new one, so only the changed files are copied,
+//     the files which cannot be linked are copied again from the source by BackupManifest.Sync
+//   - Only the files of the given backup paths are reused, the paths removed from the config file are not carried over
+//   - In dry run mode, nothing is created and the previous snapshot is returned to compare the files against
+//
+// Returns: the directory to back up into and its manifest, with the backup paths set, see BackupManifest.SetBackupPaths
+func NewSnapshot(target string, sources []string) (string, *BackupManifest, error) {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "unknown"
+	}
+
+	snapshots, err := ListSnapshots(target)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// the files are only reused from a snapshot directory, not from an archive
+	snapshots = slices.DeleteFunc(snapshots, func(s BackupSnapshot) bool { return s.Format != BackupFormatFolder })
+	previous, hasPrevious := latestSnapshot(snapshots, hostname)
+
+	dir := newSnapshotPath(target, hostname, "")
+
+	manifest := newBackupManifest()
+	if hasPrevious {
+		manifest, err = LoadBackupManifest(previous.Path)
+		if err != nil {
+			Log.Warning(fmt.Sprintf(`%s, the files of the snapshot "%s" will not be reused`, err.Error(), previous.Name))
+		}
+	}
+
+	manifest.SetBackupPaths(sources)
+	manifest.dropOtherPaths()
+
+	if Options.DryRun {
+		Log.DryRun(fmt.Sprintf(`create the snapshot "%s"`, dir))
+		if hasPrevious {
+			return previous.Path, manifest, nil
+		}
+		return dir, manifest, nil
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", nil, fmt.Errorf(`failed to create the snapshot "%s": %w`, dir, err)
+	}
+
+	if hasPrevious {
+		Log.Info(fmt.Sprintf(`Reusing the unchanged files of the snapshot "%s"`, previous.Name))
+		linkSnapshotFiles(previous.Path, dir, manifest)
+	}
+
+	return dir, manifest, nil
+}
+
+// NewArchivePath returns the path of the archive of a backup run, see CreateBackupArchive
+//   - A flat target holds a single archive, replaced on each backup, e.g. "backup.zip"
+//   - Otherwise, the archive is a new snapshot named by the current time and the hostname, e.g. "2024-07-01_18-30-00_DESKTOP-1.zip"
+func NewArchivePath(backup BackupConfig, target string) string {
+	if backup.Flat {
+		return filepath.Join(target, flatArchiveName+ArchiveExtension(backup.Format))
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "unknown"
+	}
+
+	return newSnapshotPath(target, hostname, ArchiveExtension(backup.Format))
+}
+
+// newSnapshotPath returns the path of a new snapshot named by the current time and the hostname
+//   - A second backup in the same second is named after the next second
+func newSnapshotPath(target, hostname, extension string) string {
+	now := time.Now()
+	path := filepath.Join(target, now.Format(snapshotTimeLayout)+"_"+hostname+extension)
+	for IsPathExists(path) {
+		now = now.Add(time.Second)
+		path = filepath.Join(target, now.Format(snapshotTimeLayout)+"_"+hostname+extension)
+	}
+
+	return path
+}
+
+// linkSnapshotFiles hard links the files of the manifest from the previous snapshot into the new one
+//   - The files which cannot be linked, e.g. on a file system without hard links, are removed from the manifest
+func linkSnapshotFiles(previous, dir string, manifest *BackupManifest) {
+	for _, key := range sortedKeys(manifest.Files) {
+		source := filepath.Join(previous, filepath.FromSlash(key))
+		destination := filepath.Join(dir, filepath.FromSlash(key))
+
+		err := os.MkdirAll(filepath.Dir(destination), os.ModePerm)
+		if err == nil {
+			err = os.Link(source, destination)
+		}
+		if err != nil {
+			delete(manifest.Files, key)
+		}
+	}
+}
+
+// ResolveBackupSource returns the directory or the archive to restore the backup from
+//   - A flat backup target is used as is, or its archive when the backup has an archive format
+//   - name selects a snapshot by name, otherwise the newest snapshot of this host is used, or the newest of any host
+//   - A target without snapshots is used as is, it was written before the snapshots existed
+func ResolveBackupSource(backup BackupConfig, target, name string) (string, error) {
+	if backup.Flat {
+		if name != "" {
+			return "", NewError(ErrConfig, `the backup target is flat, it has no snapshots`)
+		}
+		if extension := ArchiveExtension(backup.Format); extension != "" {
+			return filepath.Join(target, flatArchiveName+extension), nil
+		}
+		return target, nil
+	}
+
+	snapshots, err := ListSnapshots(target)
+	if err != nil {
+		return "", err
+	}
+
+	if name != "" {
+		// the archives are also selected without their extension
+		index := slices.IndexFunc(snapshots, func(s BackupSnapshot) bool {
+			return strings.EqualFold(s.Name, name) || strings.EqualFold(strings.TrimSuffix(s.Name, ArchiveExtension(s.Format)), name)
+		})
+		if index < 0 {
+			return "", NewError(ErrConfig, `unknown snapshot "%s", run "win-tools backup list" to list the snapshots`, name)
+		}
+		return snapshots[index].Path, nil
+	}
+
+	hostname, _ := os.Hostname()
+	if snapshot, found := latestSnapshot(snapshots, hostname); found {
+		return snapshot.Path, nil
+	}
+	if snapshot, found := latestSnapshot(snapshots, ""); found {
+		return snapshot.Path, nil
+	}
+
+	return target, nil
+}
+
+// KeptSnapshots applies the retention rules to the snapshots, separately for each host
+//   - A snapshot is kept when one of the rules keeps it: one of the last N, or the newest of one of the last N days, weeks or months having a snapshot
+//   - Nothing is pruned when no rule is set
+//
+// Returns: the rules keeping each snapshot by name, the snapshots missing from the map are pruned
+func (r BackupRetention) KeptSnapshots(snapshots []BackupSnapshot) map[string][]string {
+	kept := map[string][]string{}
+
+	if !r.IsSet() {
+		for _, snapshot := range snapshots {
+			kept[snapshot.Name] = []string{"no retention rules"}
+		}
+		return kept
+	}
+
+	rules := []struct {
+		name   string
+		count  int
+		bucket func(time.Time) string
+	}{
+		{"last", r.Last, func(t time.Time) string { return t.String() }},
+		{"daily", r.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{"weekly", r.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%d", year, week)
+		}},
+		{"monthly", r.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+
+	hosts := map[string][]BackupSnapshot{}
+	for _, snapshot := range snapshots {
+		host := strings.ToLower(snapshot.Hostname)
+		hosts[host] = append(hosts[host], snapshot)
+	}
+
+	for _, host := range sortedKeys(hosts) {
+		newestFirst := slices.Clone(hosts[host])
+		slices.Reverse(newestFirst)
+
+		for _, rule := range rules {
+			buckets := map[string]bool{}
+			for _, snapshot := range newestFirst {
+				if len(buckets) >= rule.count {
+					break
+				}
+
+				bucket := rule.bucket(snapshot.Time)
+				if buckets[bucket] {
+					continue
+				}
+
+				buckets[bucket] = true
+				kept[snapshot.Name] = append(kept[snapshot.Name], rule.name)
+			}
+		}
+	}
+
+	return kept
+}
+
+// PruneSnapshots deletes the snapshots of the target which are not kept by the retention rules, see KeptSnapshots
+//   - In dry run mode, the snapshots are printed instead of being deleted
+//
+// Returns: the pruned snapshots, and an error joining the snapshots which could not be deleted
+func PruneSnapshots(target string, retention BackupRetention) ([]BackupSnapshot, error) {
+	snapshots, err := ListSnapshots(target)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := retention.KeptSnapshots(snapshots)
+
+	var pruned []BackupSnapshot
+	var errs []error
+	for _, snapshot := range snapshots {
+		if _, found := kept[snapshot.Name]; found {
+			continue
+		}
+
+		if Options.DryRun {
+			Log.DryRun(fmt.Sprintf(`delete the snapshot "%s"`, snapshot.Path))
+			pruned = append(pruned, snapshot)
+			continue
+		}
+
+		if err := os.RemoveAll(snapshot.Path); err != nil {
+			errs = append(errs, fmt.Errorf(`failed to delete the snapshot "%s": %w`, snapshot.Path, err))
+			continue
+		}
+		pruned = append(pruned, snapshot)
+	}
+
+	return pruned, errors.Join(errs...)
+}
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testSnapshot returns a snapshot of a host taken at a time written as "2006-01-02 15:04"
+func testSnapshot(t *testing.T, hostname, at string) BackupSnapshot {
+	t.Helper()
+
+	snapshotTime, err := time.ParseInLocation("2006-01-02 15:04", at, time.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := snapshotTime.Format(snapshotTimeLayout) + "_" + hostname
+	return BackupSnapshot{Name: name, Path: name, Time: snapshotTime, Hostname: hostname, Format: BackupFormatFolder}
+}
+
+func TestKeptSnapshots(t *testing.T) {
+	type snapshot struct{ host, at string }
+
+	tests := []struct {
+		name      string
+		retention BackupRetention
+		snapshots []snapshot
+		want      map[snapshot][]string
+	}{
+		{
+			"no rules keeps everything",
+			BackupRetention{},
+			[]snapshot{{"PC", "2024-07-01 10:00"}, {"PC", "2024-07-02 10:00"}},
+			map[snapshot][]string{{"PC", "2024-07-01 10:00"}: {"no retention rules"}, {"PC", "2024-07-02 10:00"}: {"no retention rules"}},
+		},
+		{
+			"last",
+			BackupRetention{Last: 2},
+			[]snapshot{{"PC", "2024-07-01 10:00"}, {"PC", "2024-07-01 11:00"}, {"PC", "2024-07-01 12:00"}, {"PC", "2024-07-01 13:00"}},
+			map[snapshot][]string{{"PC", "2024-07-01 12:00"}: {"last"}, {"PC", "2024-07-01 13:00"}: {"last"}},
+		},
+		{
+			"more rules than snapshots",
+			BackupRetention{Last: 5},
+			[]snapshot{{"PC", "2024-07-01 10:00"}},
+			map[snapshot][]string{{"PC", "2024-07-01 10:00"}: {"last"}},
+		},
+		{
+			"daily keeps the newest of each day",
+			BackupRetention{Daily: 2},
+			[]snapshot{{"PC", "2024-07-01 10:00"}, {"PC", "2024-07-02 09:00"}, {"PC", "2024-07-02 21:00"}, {"PC", "2024-07-03 08:00"}, {"PC", "2024-07-03 20:00"}},
+			map[snapshot][]string{{"PC", "2024-07-02 21:00"}: {"daily"}, {"PC", "2024-07-03 20:00"}: {"daily"}},
+		},
+		{
+			"daily counts the days having snapshots",
+			BackupRetention{Daily: 2},
+			[]snapshot{{"PC", "2024-06-01 10:00"}, {"PC", "2024-07-05 10:00"}, {"PC", "2024-07-30 10:00"}},
+			map[snapshot][]string{{"PC", "2024-07-05 10:00"}: {"daily"}, {"PC", "2024-07-30 10:00"}: {"daily"}},
+		},
+		{
+			"weekly uses iso weeks across the new year",
+			BackupRetention{Weekly: 2},
+			// 2024-12-30 and 2025-01-02 are both in the first week of 2025
+			[]snapshot{{"PC", "2024-12-21 10:00"}, {"PC", "2024-12-28 10:00"}, {"PC", "2024-12-30 10:00"}, {"PC", "2025-01-02 10:00"}},
+			map[snapshot][]string{{"PC", "2024-12-28 10:00"}: {"weekly"}, {"PC", "2025-01-02 10:00"}: {"weekly"}},
+		},
+		{
+			"monthly",
+			BackupRetention{Monthly: 2},
+			[]snapshot{{"PC", "2024-01-10 10:00"}, {"PC", "2024-01-20 10:00"}, {"PC", "2024-02-05 10:00"}, {"PC", "2024-02-28 10:00"}, {"PC", "2024-03-01 10:00"}},
+			map[snapshot][]string{{"PC", "2024-02-28 10:00"}: {"monthly"}, {"PC", "2024-03-01 10:00"}: {"monthly"}},
+		},
+		{
+			"rules combined",
+			BackupRetention{Last: 1, Daily: 2, Monthly: 2},
+			[]snapshot{{"PC", "2024-05-31 10:00"}, {"PC", "2024-06-01 10:00"}, {"PC", "2024-06-02 09:00"}, {"PC", "2024-06-02 10:00"}},
+			map[snapshot][]string{
+				{"PC", "2024-05-31 10:00"}: {"monthly"},
+				{"PC", "2024-06-01 10:00"}: {"daily"},
+				{"PC", "2024-06-02 10:00"}: {"last", "daily", "monthly"},
+			},
+		},
+		{
+			"each host separately, ignoring the case",
+			BackupRetention{Last: 1},
+			[]snapshot{{"LAPTOP", "2024-07-01 10:00"}, {"desktop", "2024-07-01 11:00"}, {"DESKTOP", "2024-07-01 12:00"}, {"LAPTOP", "2024-07-01 09:00"}},
+			map[snapshot][]string{{"LAPTOP", "2024-07-01 10:00"}: {"last"}, {"DESKTOP", "2024-07-01 12:00"}: {"last"}},
+		},
+		{
+			"no snapshots",
+			BackupRetention{Last: 1},
+			nil,
+			map[snapshot][]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var snapshots []BackupSnapshot
+			for _, s := range test.snapshots {
+				snapshots = append(snapshots, testSnapshot(t, s.host, s.at))
+			}
+			// the snapshots are listed the oldest first, see ListSnapshots
+			slices.SortStableFunc(snapshots, func(a, b BackupSnapshot) int { return a.Time.Compare(b.Time) })
+
+			want := map[string][]string{}
+			for s, rules := range test.want {
+				want[testSnapshot(t, s.host, s.at).Name] = rules
+			}
+
+			got := test.retention.KeptSnapshots(snapshots)
+			if !maps.EqualFunc(got, want, slices.Equal[[]string]) {
+				t.Errorf("KeptSnapshots() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestNewSnapshotDropsRemovedPaths(t *testing.T) {
+	target := t.TempDir()
+	kept := filepath.Join(t.TempDir(), "kept")
+	removed := filepath.Join(t.TempDir(), "removed")
+	writeTestFiles(t, kept, map[string]string{"a.txt": "a"})
+	writeTestFiles(t, removed, map[string]string{"b.txt": "b"})
+
+	dir, manifest, err := NewSnapshot(target, []string{kept, removed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	syncTestPath(t, manifest, kept, dir, nil)
+	syncTestPath(t, manifest, removed, dir, nil)
+	manifest.SetEntry(removed, "removed")
+	if err := manifest.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second snapshot only backs up the kept path
+	next, manifest, err := NewSnapshot(target, []string{kept})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == dir {
+		t.Fatal("NewSnapshot() returned the previous snapshot")
+	}
+
+	keptRoot, removedRoot := backupRoot(kept), backupRoot(removed)
+	if _, found := manifest.Files[keptRoot+"/a.txt"]; !found || !IsPathExists(filepath.Join(next, filepath.FromSlash(keptRoot), "a.txt")) {
+		t.Error("the file of the kept path was not reused")
+	}
+	if _, found := manifest.Files[removedRoot+"/b.txt"]; found || IsPathExists(filepath.Join(next, filepath.FromSlash(removedRoot))) {
+		t.Error("the file of the removed path was carried over")
+	}
+	if _, found := manifest.Paths[removedRoot]; found || manifest.Entries[removedRoot] != "" {
+		t.Errorf("the removed path is still in the manifest: %v, %v", manifest.Paths, manifest.Entries)
+	}
+	if manifest.Paths[keptRoot] != kept {
+		t.Errorf("Paths[%q] = %q, want %q", keptRoot, manifest.Paths[keptRoot], kept)
+	}
+}
@@ -0,0 +1,317 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/alabsi91/win-tools/commands/utils/shellquote"
+)
+
+// Types of the snippet parameters
+const (
+	ParamString = "string"
+	ParamInt    = "int"
+	ParamBool   = "bool"
+)
+
+// SnippetEntry defines an entry of the "snippets" section of the config file, a script reused by the scripts with "use"
+//   - The parameters are written as {{name}} in the script, they are replaced with the values quoted for the shell of the snippet
+type SnippetEntry struct {
+	Description string                  `yaml:"description,omitempty" description:"What the snippet does"`
+	Shell       string                  `yaml:"shell,omitempty" enum:"cmd,powershell,pwsh,bash,python" description:"Shell running the snippet, cmd when omitted"`
+	Run         string                  `yaml:"run,omitempty" description:"The script of the snippet, the parameters are written as {{name}}, either run or file is required"`
+	File        string                  `yaml:"file,omitempty" description:"File holding the script of the snippet, relative paths are resolved against the config file"`
+	Params      map[string]SnippetParam `yaml:"params,omitempty" description:"Parameters of the snippet, passed with \"with\" by the scripts using it"`
+
+	// dir is the directory of the config file the snippet was declared in
+	dir string
+}
+
+// SnippetParam defines a parameter of a snippet
+type SnippetParam struct {
+	Type        string   `yaml:"type,omitempty" enum:"string,int,bool" description:"Type of the value, string when omitted"`
+	Description string   `yaml:"description,omitempty" description:"What the parameter is for"`
+	Required    bool     `yaml:"required,omitempty" description:"The scripts using the snippet must pass a value"`
+	Default     string   `yaml:"default,omitempty" description:"Value used when the script does not pass one"`
+	Enum        []string `yaml:"enum,omitempty" description:"The allowed values"`
+	Pattern     string   `yaml:"pattern,omitempty" description:"Regular expression the whole value must match"`
+}
+
+// snippetParamPattern matches a {{name}} parameter in the script of a snippet
+var snippetParamPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_-]*)\s*\}\}`)
+
+// expandSnippets replaces the scripts using a snippet with the script of the snippet
+//   - The values of "with" are checked against the parameters of the snippet and quoted for its shell
+//   - The script keeps "use" and "with", it is printed back the way it was written
+//
+// Returns: an error of kind ErrConfig listing every invalid snippet and every invalid use of a snippet
+func expandSnippets(config *ConfigYamlType) error {
+	var problems []string
+
+	bodies := map[string]string{}
+	for _, name := range sortedKeys(config.Snippets) {
+		body, err := config.Snippets[name].body()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("snippets.%s: %s", name, err.Error()))
+			continue
+		}
+		bodies[name] = body
+	}
+
+	for i := range config.Scripts {
+		script := &config.Scripts[i]
+		if script.Use == "" {
+			continue
+		}
+
+		if script.Run != "" || script.File != "" || script.Shell != "" {
+			problems = append(problems, fmt.Sprintf(`scripts[%d]: "use" cannot be combined with "run", "file" or "shell"`, i))
+			continue
+		}
+
+		snippet, found := config.Snippets[script.Use]
+		if !found {
+			problems = append(problems, fmt.Sprintf(`scripts[%d]: unknown snippet "%s", available snippets: %s`, i, script.Use, snippetNames(config.Snippets)))
+			continue
+		}
+
+		body, found := bodies[script.Use]
+		if !found {
+			continue // already reported
+		}
+
+		run, errs := snippet.expand(body, script.With)
+		for _, err := range errs {
+			problems = append(problems, fmt.Sprintf(`scripts[%d]: snippet "%s": %s`, i, script.Use, err.Error()))
+		}
+
+		script.Shell = snippet.shell()
+		script.Run = run
+	}
+
+	if len(problems) > 0 {
+		return NewError(ErrConfig, "invalid snippets:\n%s", strings.Join(problems, "\n"))
+	}
+
+	return nil
+}
+
+// snippetNames lists the names of the snippets for error messages
+func snippetNames(snippets map[string]SnippetEntry) string {
+	if len(snippets) == 0 {
+		return "none"
+	}
+
+	return strings.Join(sortedKeys(snippets), ", ")
+}
+
+// shell returns the shell of the snippet, cmd when omitted
+func (s SnippetEntry) shell() string {
+	if s.Shell == "" {
+		return ShellCmd
+	}
+
+	return s.Shell
+}
+
+// body returns the script of the snippet, read from its file when it has one
+//
+// Returns: an error if the snippet is invalid, uses an undeclared parameter or its file cannot be read
+func (s SnippetEntry) body() (string, error) {
+	if (s.Run == "") == (s.File == "") {
+		return "", fmt.Errorf(`exactly one of "run" or "file" is required`)
+	}
+
+	for _, name := range sortedKeys(s.Params) {
+		if err := s.Params[name].validate(); err != nil {
+			return "", fmt.Errorf("params.%s: %s", name, err.Error())
+		}
+	}
+
+	body := s.Run
+	if s.File != "" {
+		path, err := PathExpander.Expand(s.File)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(path) && s.dir != "" {
+			path = filepath.Join(s.dir, path)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf(`failed to read the file "%s"`, path)
+		}
+		body = string(data)
+	}
+
+	for _, match := range snippetParamPattern.FindAllStringSubmatch(body, -1) {
+		if _, declared := s.Params[match[1]]; !declared {
+			return "", fmt.Errorf(`the parameter "%s" used in the script is not declared in "params"`, match[1])
+		}
+	}
+
+	return body, nil
+}
+
+// expand replaces the parameters in the script of the snippet with the given values
+//
+// Returns: the script, and an error for every missing, unknown or invalid value
+func (s SnippetEntry) expand(body string, with map[string]string) (string, []error) {
+	var errs []error
+
+	for _, name := range sortedKeys(with) {
+		if _, declared := s.Params[name]; !declared {
+			errs = append(errs, fmt.Errorf(`unknown parameter "%s", available parameters: %s`, name, strings.Join(sortedKeys(s.Params), ", ")))
+		}
+	}
+
+	values := map[string]string{}
+	for _, name := range sortedKeys(s.Params) {
+		param := s.Params[name]
+
+		value, found := with[name]
+		if !found {
+			if param.Required {
+				errs = append(errs, fmt.Errorf(`missing the required parameter "%s"`, name))
+				continue
+			}
+			value = param.Default
+		}
+
+		quoted, err := param.quote(value, s.shell())
+		if err != nil {
+			errs = append(errs, fmt.Errorf(`parameter "%s": %s`, name, err.Error()))
+			continue
+		}
+		values[name] = quoted
+
+		// quoting escapes some characters of a secret, the quoted form no longer matches the redacted secret
+		if len(redactedSpans(value)) > 0 {
+			Log.Redact(quoted)
+		}
+	}
+
+	if len(errs) > 0 {
+		return "", errs
+	}
+
+	return snippetParamPattern.ReplaceAllStringFunc(body, func(match string) string {
+		return values[snippetParamPattern.FindStringSubmatch(match)[1]]
+	}), nil
+}
+
+// validate checks the definition of the parameter and its default value
+func (p SnippetParam) validate() error {
+	if p.Pattern != "" {
+		if _, err := regexp.Compile(p.Pattern); err != nil {
+			return fmt.Errorf(`invalid pattern "%s": %s`, p.Pattern, err.Error())
+		}
+	}
+
+	if p.Required && p.Default != "" {
+		return fmt.Errorf(`a required parameter cannot have a default value`)
+	}
+
+	if !p.Required {
+		if err := p.check(p.Default); err != nil {
+			return fmt.Errorf("default: %s", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// check checks a value of the parameter against its type, enum and pattern
+//   - An empty value is allowed for the optional parameters
+func (p SnippetParam) check(value string) error {
+	if value == "" && !p.Required {
+		return nil
+	}
+
+	switch p.Type {
+	case ParamInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf(`"%s" is not an integer`, value)
+		}
+	case ParamBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf(`"%s" is not true or false`, value)
+		}
+	}
+
+	if len(p.Enum) > 0 && !slices.Contains(p.Enum, value) {
+		return fmt.Errorf(`invalid value "%s", expected one of: %s`, value, strings.Join(p.Enum, ", "))
+	}
+
+	if p.Pattern != "" && !regexp.MustCompile(`^(?:`+p.Pattern+`)$`).MatchString(value) {
+		return fmt.Errorf(`"%s" does not match the pattern "%s"`, value, p.Pattern)
+	}
+
+	return nil
+}
+
+// quote checks a value of the parameter and writes it as a literal of the given shell
+//   - Integers are written as is, booleans as the boolean literal of the shell
+//   - Strings are quoted so the shell reads them as a single literal argument
+func (p SnippetParam) quote(value, shell string) (string, error) {
+	if err := p.check(value); err != nil {
+		return "", err
+	}
+
+	switch p.Type {
+	case ParamInt:
+		if value == "" {
+			return "0", nil
+		}
+		n, _ := strconv.Atoi(value)
+		return strconv.Itoa(n), nil
+
+	case ParamBool:
+		b, _ := strconv.ParseBool(value)
+		return boolLiteral(b, shell), nil
+	}
+
+	return quoteForShell(value, shell)
+}
+
+// boolLiteral returns the boolean literal of a shell
+func boolLiteral(b bool, shell string) string {
+	switch shell {
+	case ShellPowershell, ShellPwsh:
+		return "$" + strconv.FormatBool(b)
+	case ShellPython:
+		if b {
+			return "True"
+		}
+		return "False"
+	}
+
+	return strconv.FormatBool(b)
+}
+
+// quoteForShell quotes a string so the shell reads it as a single literal argument, see shellquote
+//
+// Returns: an error if the string cannot be quoted for cmd
+func quoteForShell(value, shell string) (string, error) {
+	switch shell {
+	case ShellPowershell, ShellPwsh:
+		return shellquote.PowerShell(value), nil
+	case ShellBash:
+		return shellquote.Posix(value), nil
+	case ShellPython:
+		return strconv.Quote(value), nil
+	}
+
+	quoted, err := shellquote.Cmd(value)
+	if err != nil {
+		return "", fmt.Errorf(`"%s" cannot be quoted for cmd: %s`, value, err.Error())
+	}
+
+	return quoted, nil
+}
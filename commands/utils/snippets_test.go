@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/alabsi91/win-tools/commands/utils/shellquote"
+)
+
+// hostileValues are "with" values trying to break out of the quoting of a snippet parameter
+var hostileValues = []string{
+	``,
+	`plain`,
+	`two words`,
+	`"; touch pwned; echo "`,
+	`'; touch pwned; echo '`,
+	`$(touch pwned)`,
+	"`touch pwned`",
+	`${HOME} $HOME $env:PATH`,
+	`%PATH% %%`,
+	`!PATH!`,
+	`^&|<>()`,
+	`a & whoami`,
+	`C:\dir\`,
+	`C:\my dir\\`,
+	`\"`,
+	`it's "quoted"`,
+	`‘typographic’ quotes`,
+	`#not a comment`,
+}
+
+// printSnippets print their "value" parameter as is, without a trailing newline but for cmd
+var printSnippets = map[string]SnippetEntry{
+	ShellCmd:        {Shell: ShellCmd, Run: `echo {{value}}`},
+	ShellPowershell: {Shell: ShellPowershell, Run: `[Console]::Out.Write({{value}})`},
+	ShellPwsh:       {Shell: ShellPwsh, Run: `[Console]::Out.Write({{value}})`},
+	ShellBash:       {Shell: ShellBash, Run: `printf '%s' {{value}}`},
+	ShellPython:     {Shell: ShellPython, Run: `import sys; sys.stdout.write({{value}})`},
+}
+
+// expandPrintSnippet returns the script using the print snippet of a shell with a value
+func expandPrintSnippet(t *testing.T, shell, value string) ScriptEntry {
+	t.Helper()
+
+	snippet := printSnippets[shell]
+	snippet.Params = map[string]SnippetParam{"value": {}}
+
+	config := ConfigYamlType{
+		Snippets: map[string]SnippetEntry{"print": snippet},
+		Scripts:  []ScriptEntry{{Use: "print", With: map[string]string{"value": value}}},
+	}
+	if err := expandSnippets(&config); err != nil {
+		t.Fatalf("expandSnippets() with %q returned an error: %v", value, err)
+	}
+
+	return config.Scripts[0]
+}
+
+func TestSnippetQuotesHostileValues(t *testing.T) {
+	for shell := range printSnippets {
+		for _, value := range hostileValues {
+			script := expandPrintSnippet(t, shell, value)
+			if script.Shell != shell {
+				t.Errorf("expandSnippets() set the shell %q, want %q", script.Shell, shell)
+			}
+
+			quoted, err := quoteForShell(value, shell)
+			if err != nil {
+				t.Fatalf("quoteForShell(%q, %s) returned an error: %v", value, shell, err)
+			}
+			want := strings.Replace(printSnippets[shell].Run, "{{value}}", quoted, 1)
+			if script.Run != want {
+				t.Errorf("%s snippet with %q = %q, want %q", shell, value, script.Run, want)
+			}
+		}
+	}
+}
+
+func TestSnippetRunsHostileValues(t *testing.T) {
+	for shell := range printSnippets {
+		t.Run(shell, func(t *testing.T) {
+			executable, _, err := expandPrintSnippet(t, shell, "").Command()
+			if err != nil {
+				t.Skipf("%s is not available: %v", shell, err)
+			}
+			if _, err := exec.LookPath(executable); err != nil {
+				t.Skipf("%s is not available: %v", executable, err)
+			}
+
+			for _, value := range hostileValues {
+				script := expandPrintSnippet(t, shell, value)
+
+				executable, args, err := script.Command()
+				if err != nil {
+					t.Fatalf("Command() returned an error: %v", err)
+				}
+
+				cmd := CommandContext(context.Background(), executable, args...)
+				if shell == ShellCmd {
+					SetCommandLine(cmd, executable+" "+strings.Join(args, " "))
+				}
+
+				output, err := cmd.Output()
+				if err != nil {
+					t.Fatalf("%s %q failed with %q: %v", executable, args, value, err)
+				}
+
+				// echo prints its arguments as cmd passes them to a program
+				want := value
+				if shell == ShellCmd {
+					want = shellquote.Argv(value) + "\r\n"
+				}
+				if string(output) != want {
+					t.Errorf("%s snippet with %q printed %q, want %q", shell, value, output, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSnippetCmdRejectsLineBreaks(t *testing.T) {
+	config := ConfigYamlType{
+		Snippets: map[string]SnippetEntry{"print": {Run: `echo {{value}}`, Params: map[string]SnippetParam{"value": {}}}},
+		Scripts:  []ScriptEntry{{Use: "print", With: map[string]string{"value": "a\r\ndel /q C:\\x"}}},
+	}
+
+	err := expandSnippets(&config)
+	if err == nil {
+		t.Fatalf("expandSnippets() = %q, want an error", config.Scripts[0].Run)
+	}
+	if !strings.Contains(err.Error(), "cannot be quoted for cmd") {
+		t.Errorf("expandSnippets() error = %q, want it to mention cmd", err.Error())
+	}
+}
@@ -5,10 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 
 	"github.com/charmbracelet/huh"
-	"github.com/goccy/go-yaml"
 )
 
 // AssetsPath is the path to the assets directory which lives alongside the executable
@@ -24,45 +22,19 @@ var AssetsPath = func() string {
 	return filepath.Join(execDir, "assets")
 }()
 
-// ConfigYamlType defines the structure of the config YAML file
-type ConfigYamlType struct {
-	Backup struct {
-		Paths  []string
-		Target string
-	}
-	EnvironmentVariables []struct {
-		Key   string
-		Value string
-		Scope string
-	} `yaml:"environmentVariables"`
-	Packages []string
-	Scripts  []string
-}
-
-// ReadConfigFile reads and unmarshal the config file of type YAML
-//   - On error, the program will exit with a fatal error message
-//
-// Returns: ConfigYamlType
-func ReadConfigFile(path string) ConfigYamlType {
-	dat, err := os.ReadFile(path)
-	if err != nil {
-		Log.Fatal(fmt.Sprintf(`Failed to read config file: "%s"`, path))
-	}
-
-	var config ConfigYamlType
-
-	if err := yaml.Unmarshal(dat, &config); err != nil {
-		Log.Fatal(fmt.Sprintf(`Failed to unmarshal config file: "%s"`, path))
-	}
-
-	return config
-}
-
 // AskForConfigFilePath prompts the user to enter a config file path
 //   - Accepts relative and absolute paths
 //   - Validates if the path exists
+//   - Uses the "configPath" answer from the answers file when provided
 //   - Returns an error if the user cancels the prompt
 func AskForConfigFilePath() (string, error) {
+	if answer, found, err := AnswerFor("configPath", Answers.ConfigPath); found || err != nil {
+		if err == nil && !IsPathExists(answer) {
+			err = NewError(ErrConfig, `config file from the answers file not found: "%s"`, answer)
+		}
+		return answer, err
+	}
+
 	var results string
 
 	println("")
@@ -84,18 +56,7 @@ func AskForConfigFilePath() (string, error) {
 		),
 	).Run()
 
-	return results, err
-}
-
-// PreparePathsString prepares paths with environment variables by replacing them with their values
-func PreparePathsString(paths []string) {
-	r := regexp.MustCompile("%.+%")
-
-	for i, path := range paths {
-		paths[i] = r.ReplaceAllStringFunc(path, func(m string) string {
-			return os.Getenv(m[1 : len(m)-1])
-		})
-	}
+	return results, PromptError(err)
 }
 
 // IsPathExists checks if a path exists in the system
@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// varPattern matches a ${name} variable, or $${name} which is replaced by a literal ${name}
+//   - Other ${...} expressions like PowerShell's ${env:PATH} are left untouched
+var varPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_.-]*)\}`)
+
+// scriptBodyPattern matches the paths of the script bodies, an undefined ${name} is left there for the shell, e.g. bash's ${HOME}
+var scriptBodyPattern = regexp.MustCompile(`^(scripts\[\d+\]|snippets\..+)\.run$`)
+
+// VarEnvPrefix is the prefix of the environment variables overriding the config variables
+const VarEnvPrefix = "WIN_TOOLS_VAR_"
+
+// interpolateConfig replaces the ${name} variables in every string value of the config
+//   - The variables come from the "vars" section, then the WIN_TOOLS_VAR_name environment variables, then --var, the last one wins
+//   - Variables may use other variables
+//   - The resolved variables are stored back in config.Vars
+//   - In the script bodies, an undefined ${name} is left as is for the shell, e.g. bash's ${HOME},
+//     $${name} writes a literal ${name} when name is also a config variable
+//   - The literal variables are not interpolated, e.g. the decrypted secrets, unless overridden by the environment or --var
+//
+// Returns: an error of kind ErrConfig listing every undefined variable outside of the script bodies, or a variable using itself
+func interpolateConfig(config *ConfigYamlType, literal map[string]bool) error {
+	vars := map[string]string{}
+	for name, value := range config.Vars {
+		vars[name] = value
+	}
+
+	literal = maps.Clone(literal)
+
+	for _, env := range os.Environ() {
+		key, value, _ := strings.Cut(env, "=")
+		if name, found := strings.CutPrefix(key, VarEnvPrefix); found && name != "" {
+			vars[name] = value
+			delete(literal, name)
+			config.setOrigin("vars", name, fmt.Sprintf(`%s: "%s"`, name, value), source{File: key})
+		}
+	}
+
+	for _, name := range sortedKeys(Options.Vars) {
+		vars[name] = Options.Vars[name]
+		delete(literal, name)
+		config.setOrigin("vars", name, fmt.Sprintf(`%s: "%s"`, name, Options.Vars[name]), source{File: "--var"})
+	}
+
+	resolved, err := resolveVars(vars, literal)
+	if err != nil {
+		return err
+	}
+
+	if len(resolved) > 0 {
+		config.Vars = resolved
+	}
+
+	var problems []string
+	walkStrings(reflect.ValueOf(config).Elem(), "", []string{"vars"}, func(path, value string) string {
+		result, undefined := interpolate(value, resolved)
+		if scriptBodyPattern.MatchString(path) {
+			return result
+		}
+
+		for _, name := range undefined {
+			problems = append(problems, fmt.Sprintf(`%s: undefined variable "%s"`, path, name))
+		}
+
+		return result
+	})
+
+	if len(problems) > 0 {
+		return NewError(ErrConfig, "invalid config variables:\n%s", strings.Join(problems, "\n"))
+	}
+
+	return nil
+}
+
+// interpolate replaces the ${name} variables in a string
+//
+// Returns:
+//   - The new string, undefined variables are left as is
+//   - The names of the undefined variables
+func interpolate(s string, vars map[string]string) (string, []string) {
+	var undefined []string
+
+	result := varPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+
+		name := varPattern.FindStringSubmatch(match)[1]
+		value, ok := vars[name]
+		if !ok {
+			undefined = append(undefined, name)
+			return match
+		}
+
+		return value
+	})
+
+	return result, undefined
+}
+
+// resolveVars replaces the variables used in the values of other variables
+//   - The values of the literal variables are kept as is
+//
+// Returns: an error of kind ErrConfig if a variable is undefined or uses itself
+func resolveVars(vars map[string]string, literal map[string]bool) (map[string]string, error) {
+	resolved := map[string]string{}
+	for name := range literal {
+		if value, found := vars[name]; found {
+			resolved[name] = value
+		}
+	}
+
+	var resolve func(name string, stack []string) error
+	resolve = func(name string, stack []string) error {
+		if _, done := resolved[name]; done {
+			return nil
+		}
+
+		if slices.Contains(stack, name) {
+			return NewError(ErrConfig, "variable cycle detected: %s", strings.Join(append(stack, name), " -> "))
+		}
+		stack = append(stack, name)
+
+		for _, match := range varPattern.FindAllStringSubmatch(vars[name], -1) {
+			if strings.HasPrefix(match[0], "$$") {
+				continue
+			}
+
+			if _, ok := vars[match[1]]; !ok {
+				return NewError(ErrConfig, `vars.%s: undefined variable "%s"`, name, match[1])
+			}
+
+			if err := resolve(match[1], stack); err != nil {
+				return err
+			}
+		}
+
+		resolved[name], _ = interpolate(vars[name], resolved)
+		return nil
+	}
+
+	for _, name := range sortedKeys(vars) {
+		if err := resolve(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return resolved, nil
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package utils
+
+// windowsBuildNumber returns the build number of Windows
+//   - Outside of Windows, the build number is always 0
+func windowsBuildNumber() int {
+	return 0
+}
@@ -0,0 +1,8 @@
+package utils
+
+import "golang.org/x/sys/windows"
+
+// windowsBuildNumber returns the build number of Windows, e.g. 22631 for Windows 11 23H2
+func windowsBuildNumber() int {
+	return int(windows.RtlGetVersion().BuildNumber)
+}
@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/alabsi91/win-tools/commands/utils"
+)
+
+// validateCommand implements the "validate" command
+type validateCommand struct {
+	args ConfigPathArg
+}
+
+func (*validateCommand) Name() string  { return "validate" }
+func (*validateCommand) Title() string { return "Validate config" }
+func (*validateCommand) Help() string {
+	return "Check a YAML configuration file against the config schema and report every problem with its line and column."
+}
+func (c *validateCommand) Flags() any                { return &c.args }
+func (c *validateCommand) Run(context.Context) error { return ValidateConfig(c.args.ConfigPath) }
+
+// ValidateConfig validates a YAML config file and prints every problem found
+//   - The included files are validated as well
+//   - Returns an error of kind ErrConfig if the config file is invalid
+func ValidateConfig(configFilePath *string) error {
+	path, err := resolveConfigPath(configFilePath)
+	if err != nil {
+		return err
+	}
+
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return utils.NewError(utils.ErrConfig, `failed to read config file: "%s"`, path)
+	}
+
+	problems, err := utils.ValidateYaml(dat, utils.ConfigSchema())
+	if err != nil {
+		return utils.NewError(utils.ErrConfig, "failed to parse config file: \"%s\"\n%s", path, err.Error())
+	}
+
+	if len(problems) > 0 {
+		Log.Error("\n"+utils.FormatValidationErrors(path, problems), "\n")
+		return utils.NewError(utils.ErrConfig, `found %d problems in the config file: "%s"`, len(problems), path)
+	}
+
+	// validate the included files
+	if _, err := utils.ReadConfigFile(path, false); err != nil {
+		return err
+	}
+
+	Log.Success("\n" + fmt.Sprintf(`the config file is valid: "%s"`, path) + "\n")
+
+	return nil
+}
@@ -8,6 +8,8 @@ require (
 	github.com/alexflint/go-arg v1.5.1
 	github.com/charmbracelet/huh v0.5.2
 	github.com/charmbracelet/lipgloss v0.12.1
+	golang.org/x/crypto v0.7.0
+	golang.org/x/sys v0.23.0
 )
 
 require (
@@ -42,6 +44,5 @@ require (
 	github.com/rivo/uniseg v0.4.7 // indirect
 	github.com/stretchr/testify v1.9.0 // indirect
 	golang.org/x/sync v0.7.0 // indirect
-	golang.org/x/sys v0.23.0 // indirect
 	golang.org/x/text v0.16.0 // indirect
 )
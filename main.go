@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
 	"reflect"
-	"strings"
+	"strconv"
+	"syscall"
 
 	"github.com/alabsi91/win-tools/commands"
 	"github.com/alabsi91/win-tools/commands/utils"
@@ -12,184 +18,189 @@ import (
 
 var Log = utils.Log
 
-type ConfigPathArg struct {
-	ConfigPath *string `arg:"--config" placeholder:"[PATH]" help:"YAML config file path"`
-}
-
-type CreateTemplateArgs struct {
-	TemplatePath *string `arg:"--save-path" placeholder:"[PATH]" help:"Output path for the template"`
-}
+// programInfo adds the program wide texts to the help message
+type programInfo struct{}
 
-type AutoLogonArgs struct {
-	Username     *string `arg:"--username" placeholder:"" help:"The username of the user to automatically logon as"`
-	Domain       *string `arg:"--domain" placeholder:"" help:"The domain of the user to automatically logon as"`
-	AutoLogon    *int    `arg:"--logon-count" placeholder:"" help:"The number of logons that auto logon will be enabled"`
-	RemovePrompt *bool   `arg:"--remove-prompt" help:"Removes the system banner to ensure interventionless logon"`
-	BackupFile   *string `arg:"--backup-file" placeholder:"" help:"If specified the existing settings such as the system banner text will be backed up to the specified file"`
+// Epilogue is printed at the end of the help message
+func (programInfo) Epilogue() string {
+	return utils.ExitCodesHelp
 }
 
-type NoArgs struct{}
-
-type ArgsType struct {
-	Backup               *ConfigPathArg      `arg:"subcommand:backup" help:"Create a backup of specified paths as defined in a YAML configuration file."`
-	Restore              *ConfigPathArg      `arg:"subcommand:restore" help:"Restore files and directories from a backup using the paths specified in a YAML configuration file."`
-	Install              *ConfigPathArg      `arg:"subcommand:choco-install" help:"Install Chocolatey packages according to the list provided in a YAML configuration file."`
-	RunScripts           *ConfigPathArg      `arg:"subcommand:run-scripts" help:"Execute a series of scripts defined in a YAML configuration file."`
-	SetEnvs              *ConfigPathArg      `arg:"subcommand:set-envs" help:"Set environment variables as defined in a YAML configuration file."`
-	CreateConfigTemplate *CreateTemplateArgs `arg:"subcommand:create-template" help:"Generate a new YAML template for configuration, including placeholders for paths, scripts, and environment variables."`
-	SetRegistry          *NoArgs             `arg:"subcommand:set-registry" help:"Select multiple predefined registry keys to set."`
-	CleanStartMenu       *NoArgs             `arg:"subcommand:clean-menu" help:"Clean start menu from all icons."`
-	AutoLogon            *AutoLogonArgs      `arg:"subcommand:auto-logon" help:"Enables auto logon when the computer starts."`
-	DisableFirewall      *NoArgs             `arg:"subcommand:disable-firewall" help:"Disable Windows firewall, Windows Defender, and Windows Defender Cloud."`
-	UninstallBloat       *NoArgs             `arg:"subcommand:uninstall-bloat" help:"Select multiple predefined Windows apps to uninstall."`
-}
-
-var args ArgsType
-
 func main() {
-
-	parsedArg := arg.MustParse(&args)
-
-	enteredSubcommands := parsedArg.SubcommandNames()
-	if len(enteredSubcommands) > 0 {
-		runCommand(enteredSubcommands[0], &args)
-		return
+	ctx, stop := withInterrupt()
+	err := run(ctx)
+	cancelled := ctx.Err() != nil
+	stop()
+
+	// a command stopped by Ctrl+C may fail with its own error, the exit code still reports the cancellation
+	if cancelled && !errors.Is(err, utils.ErrCancelled) {
+		if err == nil {
+			err = utils.NewError(utils.ErrCancelled, "cancelled by the user")
+		} else {
+			err = utils.NewError(utils.ErrCancelled, "cancelled by the user: %s", err.Error())
+		}
 	}
 
-	// * No command provided, ask to select one
-	Log.Info("\nRun `win-tools --help` for more information.\n")
-	chosenCommand, err := askToSelectCommand()
 	if err != nil {
-		Log.Error("failed to get user selection\n")
-		return
+		Log.Error("\n"+err.Error(), "\n")
 	}
 
-	runCommand(chosenCommand, &args)
+	os.Exit(utils.ExitCode(err))
 }
 
-func runCommand(command string, args *ArgsType) {
+// withInterrupt creates the context of the command, cancelled on Ctrl+C or SIGTERM
+//   - The first signal cancels the context, the running steps stop and kill their child processes
+//   - The second signal exits immediately
+//
+// Returns: the context and a function releasing the signal handler
+func withInterrupt() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
 
-	switch command {
+		Log.Warning("\nCancelling, waiting for the running steps to stop, press Ctrl+C again to exit immediately\n")
+		cancel()
 
-	case "backup":
-		if args.Backup == nil {
-			commands.BackupData(nil)
-			break
+		select {
+		case <-signals:
+			os.Exit(utils.ExitCancelled)
+		case <-done:
 		}
-		commands.BackupData(args.Backup.ConfigPath)
+	}()
 
-	case "restore":
-		if args.Restore == nil {
-			commands.RestoreData(nil)
-			break
-		}
-		commands.RestoreData(args.Restore.ConfigPath)
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+}
 
-	case "install":
-		if args.Install == nil {
-			commands.InstallPackages(nil)
-			break
-		}
-		commands.InstallPackages(args.Install.ConfigPath)
+// run parses the arguments and runs the selected command
+//
+// Returns: the error returned by the command, it decides the exit code of the program
+func run(ctx context.Context) error {
 
-	case "run-scripts":
-		if args.RunScripts == nil {
-			commands.RunScripts(nil)
-			break
-		}
-		commands.RunScripts(args.RunScripts.ConfigPath)
+	args := newArgs()
+	arg.MustParse(args.Interface(), utils.Options, &programInfo{})
 
-	case "set-envs":
-		if args.SetEnvs == nil {
-			commands.SetEnvs(nil)
-			break
-		}
-		commands.SetEnvs(args.SetEnvs.ConfigPath)
+	// --yes never prompts
+	if utils.Options.AssumeYes {
+		utils.Options.NonInteractive = true
+	}
 
-	case "create-template":
-		if args.CreateConfigTemplate == nil {
-			commands.CreateConfigTemplate(nil)
-			break
+	if utils.Options.AnswersFile != nil {
+		if err := utils.ReadAnswersFile(*utils.Options.AnswersFile); err != nil {
+			return err
 		}
-		commands.CreateConfigTemplate(args.CreateConfigTemplate.TemplatePath)
-
-	case "set-registry":
-		commands.SetRegistry()
+	}
 
-	case "clean-menu":
-		commands.CleanStartMenu()
+	if utils.Options.DryRun {
+		Log.DryRun("\nDry run mode is enabled, no changes will be made to the system\n")
+	}
 
-	case "auto-logon":
-		if args.AutoLogon == nil {
-			commands.AutoLogon(nil, nil, nil, nil, nil)
-			break
-		}
-		commands.AutoLogon(args.AutoLogon.Username, args.AutoLogon.Domain, args.AutoLogon.AutoLogon, args.AutoLogon.RemovePrompt, args.AutoLogon.BackupFile)
+	if command := selectedCommand(args); command != nil {
+		return command.Run(ctx)
+	}
 
-	case "disable-firewall":
-		commands.DisableFirewall()
+	// * No command provided, ask to select one
+	Log.Info("\nRun `win-tools --help` for more information.\n")
+	chosenCommand, err := askToSelectCommand()
+	if err != nil {
+		return fmt.Errorf("failed to get user selection: %w", err)
+	}
 
-	case "uninstall-bloat":
-		commands.UninstallBloat()
+	command := commands.FindCommand(chosenCommand)
+	if command == nil {
+		return utils.NewError(utils.ErrConfig, `unknown command "%s"`, chosenCommand)
 	}
+
+	return command.Run(ctx)
 }
 
-// getHelpMessages
-// parses the help message for a given subcommand
-// from the 'args' struct tag.
+// newArgs creates the struct parsed by go-arg
+//   - Has one subcommand field per registered command, in the same order
+//   - Each field is a pointer to the flags struct of the command
 //
-// Returns: help message string
-func getHelpMessages(command string) string {
-	v := reflect.TypeOf(args)
+// Returns: a pointer to the new struct
+func newArgs() reflect.Value {
+	fields := make([]reflect.StructField, len(commands.Commands))
 
-	for i := 0; i < v.NumField(); i++ {
-		field := v.Field(i)
-		subcommand, _ := strings.CutPrefix(field.Tag.Get("arg"), "subcommand:")
-		help := field.Tag.Get("help")
+	for i, command := range commands.Commands {
+		tag := fmt.Sprintf(`arg:%s help:%s`, strconv.Quote("subcommand:"+command.Name()), strconv.Quote(command.Help()))
 
-		if subcommand == command {
-			return help
+		fields[i] = reflect.StructField{
+			Name: fmt.Sprintf("Command%d", i),
+			Type: reflect.TypeOf(command.Flags()),
+			Tag:  reflect.StructTag(tag),
 		}
 	}
 
-	return ""
+	return reflect.New(reflect.StructOf(fields))
+}
+
+// selectedCommand finds the command entered on the command line
+//   - Copies the parsed flags into the command
+//
+// Returns: nil if no command was entered
+func selectedCommand(args reflect.Value) commands.Command {
+	for i, command := range commands.Commands {
+		field := args.Elem().Field(i)
+		if field.IsNil() {
+			continue
+		}
+
+		reflect.ValueOf(command.Flags()).Elem().Set(field.Elem())
+		return command
+	}
+
+	return nil
 }
 
 // askToSelectCommand prompts the user to select a command
+//   - Uses the "command" answer from the answers file when provided
 //   - Returns an error if the user cancels the prompt
 func askToSelectCommand() (string, error) {
+	if answer, found, err := utils.AnswerFor("command", utils.Answers.Command); found || err != nil {
+		return answer, err
+	}
+
 	var chosenCommand string
 
+	options := make([]huh.Option[string], len(commands.Commands))
+	for i, command := range commands.Commands {
+		options[i] = huh.NewOption(command.Title(), command.Name())
+	}
+
 	err := huh.NewForm(
 		huh.NewGroup(
 			huh.NewSelect[string]().
 				Title("What would you like to do?").
 				Description("Select a command to run:").
-				Options(
-					huh.NewOption("Backup", "backup"),
-					huh.NewOption("Restore", "restore"),
-					huh.NewOption("Chocolatey install", "choco-install"),
-					huh.NewOption("Run scripts", "run-scripts"),
-					huh.NewOption("Set environment variables", "set-envs"),
-					huh.NewOption("Create config template", "create-template"),
-					huh.NewOption("Set registry", "set-registry"),
-					huh.NewOption("Clean start menu", "clean-menu"),
-					huh.NewOption("Enable auto logon", "auto-logon"),
-					huh.NewOption("Disable Windows firewall", "disable-firewall"),
-					huh.NewOption("Uninstall bloatware", "uninstall-bloat"),
-				).
+				Options(options...).
 				Value(&chosenCommand),
 
 			// Print help message for selected subcommand
 			huh.NewNote().
 				DescriptionFunc(
 					func() string {
-						return getHelpMessages(chosenCommand)
+						if command := commands.FindCommand(chosenCommand); command != nil {
+							return command.Help()
+						}
+						return ""
 					},
 					&chosenCommand,
 				),
 		),
 	).Run()
 
-	return chosenCommand, err
+	return chosenCommand, utils.PromptError(err)
 }